@@ -184,10 +184,17 @@ type BackupConfig struct {
 	SourcePaths         []string          `json:"sourcePaths"`
 	DestinationDir      string            `json:"destinationDir"`
 	Filters             core.FilterConfig `json:"filters"`
-	UseCompression      bool              `json:"useCompression"`
+	Compression         string            `json:"compression"` // 压缩方式: store、huffman、deflate、lzh
 	UseEncryption       bool              `json:"useEncryption"`
 	EncryptionAlgorithm string            `json:"encryptionAlgorithm"`
 	EncryptionPassword  string            `json:"encryptionPassword"`
+	// 分卷大小 (bytes)，大于 0 时输出 name.qbak.001、name.qbak.002 ...
+	VolumeSize int64 `json:"volumeSize"`
+	// 可复现备份: 相同的源文件、密码和 Salt 总是生成相同的备份文件
+	Deterministic bool   `json:"deterministic"`
+	Salt          string `json:"salt"`
+	// 压缩时按原样保存哪些文件，为空时使用默认策略
+	CompressionPolicy *core.CompressionPolicy `json:"compressionPolicy"`
 }
 
 func (a *App) StartBackup(config BackupConfig) (string, error) {
@@ -221,11 +228,17 @@ func (a *App) StartBackup(config BackupConfig) (string, error) {
 	}
 
 	manager := core.NewBackupManager(opCtx)
+	manager.VolumeSize = config.VolumeSize
+	manager.Deterministic = config.Deterministic
+	manager.CompressionPolicy = config.CompressionPolicy
+	if config.Salt != "" {
+		manager.Salt = []byte(config.Salt)
+	}
 	err := manager.Backup(
 		config.SourcePaths,
 		destinationFile,
 		config.Filters,
-		config.UseCompression,
+		config.Compression,
 		config.UseEncryption,
 		algoID,
 		config.EncryptionPassword,
@@ -258,6 +271,19 @@ type RestoreConfig struct {
 	BackupFile string `json:"backupFile"`
 	RestoreDir string `json:"restoreDir"`
 	Password   string `json:"password"`
+	// 选择性恢复: 归档内的相对路径或 Glob 模式，留空表示全部恢复
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// 目标文件系统不支持扩展属性时可以跳过
+	SkipXattrs bool `json:"skipXattrs"`
+	// 重建 FIFO 和设备节点 (例如恢复容器根文件系统)
+	SpecialFiles bool `json:"specialFiles"`
+	// 不创建指向恢复目录之外的符号链接 (恢复来自其他机器的备份时使用)
+	RefuseEscapingSymlinks bool `json:"refuseEscapingSymlinks"`
+	// 属主恢复方式: "ignore" (默认)、"asIs"、"byName" 或 "map"；map 模式使用 UIDMap/GIDMap
+	Ownership string      `json:"ownership"`
+	UIDMap    map[int]int `json:"uidMap"`
+	GIDMap    map[int]int `json:"gidMap"`
 }
 
 // ResolveConflict is called by the frontend to resolve a file conflict.
@@ -266,6 +292,11 @@ type conflictRequest struct {
 	responseChan chan core.ConflictAction
 }
 
+// GetDefaultCompressionPolicy 返回默认的压缩策略，供界面预填
+func (a *App) GetDefaultCompressionPolicy() *core.CompressionPolicy {
+	return core.DefaultCompressionPolicy()
+}
+
 func (a *App) ResolveConflict(requestID string, resolution string) error {
 	a.conflictMutex.Lock()
 	defer a.conflictMutex.Unlock()
@@ -297,19 +328,54 @@ func (a *App) StartRestore(config RestoreConfig) (string, error) {
 	a.cancel = cancel
 	defer func() {
 		a.cancel = nil
-		// 清理任何悬而未决的冲突请求
-		a.conflictMutex.Lock()
-		for id, req := range a.conflictRequests {
-			close(req.responseChan)
-			delete(a.conflictRequests, id)
-		}
-		a.conflictMutex.Unlock()
+		a.clearConflictRequests()
 	}()
 
 	log.Printf("Starting restore of %s to %s", config.BackupFile, config.RestoreDir)
 	manager := core.NewBackupManager(opCtx)
+	manager.ConflictHandler = a.conflictHandler(opCtx)
+
+	opts := config.restoreOptions()
+	err := manager.RestoreWithOptions(config.BackupFile, config.RestoreDir, config.Password, opts)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Println("Restore was cancelled by user.")
+			return "Restore cancelled.", nil
+		}
+		if errors.Is(err, core.ErrPasswordRequired) {
+			log.Println("Password required for restore")
+			return "", fmt.Errorf("password_required")
+		}
+		if errors.Is(err, core.ErrInvalidPassword) {
+			log.Println("Incorrect password for restore")
+			return "", fmt.Errorf("password_incorrect")
+		}
+		log.Printf("Restore failed: %v\n", err)
+		return "", fmt.Errorf("Restore failed: %w", err)
+	}
+
+	log.Println("Restore completed successfully.")
+	return "恢复备份成功！", nil
+}
+
+// restoreOptions 把前端的恢复配置转换为 core.RestoreOptions
+func (c RestoreConfig) restoreOptions() core.RestoreOptions {
+	return core.RestoreOptions{
+		Include:      c.Include,
+		Exclude:      c.Exclude,
+		SkipXattrs:   c.SkipXattrs,
+		SpecialFiles: c.SpecialFiles,
+		Ownership:    core.OwnershipMode(c.Ownership),
+		UIDMap:       c.UIDMap,
+		GIDMap:       c.GIDMap,
 
-	manager.ConflictHandler = func(path string) (core.ConflictAction, error) {
+		RefuseEscapingSymlinks: c.RefuseEscapingSymlinks,
+	}
+}
+
+// conflictHandler 把恢复时的文件冲突转发给前端，并等待用户的选择
+func (a *App) conflictHandler(opCtx context.Context) core.ConflictHandler {
+	return func(path string) (core.ConflictAction, error) {
 		a.conflictMutex.Lock()
 		a.requestIDCounter++
 		requestID := strconv.FormatInt(a.requestIDCounter, 10)
@@ -332,27 +398,116 @@ func (a *App) StartRestore(config RestoreConfig) (string, error) {
 			return action, nil
 		}
 	}
+}
+
+// clearConflictRequests 清理任何悬而未决的冲突请求
+func (a *App) clearConflictRequests() {
+	a.conflictMutex.Lock()
+	for id, req := range a.conflictRequests {
+		close(req.responseChan)
+		delete(a.conflictRequests, id)
+	}
+	a.conflictMutex.Unlock()
+}
+
+// SalvageRestore restores whatever is still readable from a damaged or truncated backup
+// and reports which files were recovered and which were lost.
+func (a *App) SalvageRestore(config RestoreConfig) (*core.SalvageReport, error) {
+	opCtx, cancel := context.WithCancel(a.ctx)
+	a.cancel = cancel
+	defer func() {
+		a.cancel = nil
+		a.clearConflictRequests()
+	}()
+
+	log.Printf("Starting salvage restore of %s to %s", config.BackupFile, config.RestoreDir)
+	manager := core.NewBackupManager(opCtx)
+	manager.ConflictHandler = a.conflictHandler(opCtx)
 
-	err := manager.Restore(config.BackupFile, config.RestoreDir, config.Password)
+	report, err := manager.SalvageRestore(config.BackupFile, config.RestoreDir, config.Password, config.restoreOptions())
 	if err != nil {
+		if errors.Is(err, core.ErrPasswordRequired) {
+			return nil, fmt.Errorf("password_required")
+		}
+		if errors.Is(err, core.ErrInvalidPassword) {
+			return nil, fmt.Errorf("password_incorrect")
+		}
 		if errors.Is(err, context.Canceled) {
-			log.Println("Restore was cancelled by user.")
-			return "Restore cancelled.", nil
+			log.Println("Salvage restore was cancelled by user.")
+			return nil, fmt.Errorf("Salvage restore cancelled.")
 		}
+		log.Printf("Salvage restore failed: %v\n", err)
+		return nil, fmt.Errorf("Salvage restore failed: %w", err)
+	}
+	log.Printf("Salvage restore finished: %d recovered, %d lost", len(report.Recovered), len(report.Lost))
+	return report, nil
+}
+
+// ListBackup returns the content tree of a backup without extracting it.
+func (a *App) ListBackup(backupFile, password string) (*core.BackupEntryNode, error) {
+	manager := core.NewBackupManager(a.ctx)
+	manager.DisableEvents()
+
+	root, err := manager.ListBackup(backupFile, password)
+	if err != nil {
 		if errors.Is(err, core.ErrPasswordRequired) {
-			log.Println("Password required for restore")
-			return "", fmt.Errorf("password_required")
+			return nil, fmt.Errorf("password_required")
 		}
 		if errors.Is(err, core.ErrInvalidPassword) {
-			log.Println("Incorrect password for restore")
-			return "", fmt.Errorf("password_incorrect")
+			return nil, fmt.Errorf("password_incorrect")
 		}
-		log.Printf("Restore failed: %v\n", err)
-		return "", fmt.Errorf("Restore failed: %w", err)
+		log.Printf("List backup failed: %v\n", err)
+		return nil, fmt.Errorf("List backup failed: %w", err)
 	}
+	return root, nil
+}
 
-	log.Println("Restore completed successfully.")
-	return "恢复备份成功！", nil
+// VerifyBackup checks a backup (and its incremental chain) without restoring it.
+// Progress is reported through the usual progress events.
+func (a *App) VerifyBackup(backupFile, password string) (*core.VerifyReport, error) {
+	opCtx, cancel := context.WithCancel(a.ctx)
+	a.cancel = cancel
+	defer func() { a.cancel = nil }()
+
+	log.Printf("Starting verification of %s", backupFile)
+	manager := core.NewBackupManager(opCtx)
+
+	report, err := manager.Verify(backupFile, password)
+	if err != nil {
+		if errors.Is(err, core.ErrPasswordRequired) {
+			return nil, fmt.Errorf("password_required")
+		}
+		if errors.Is(err, core.ErrInvalidPassword) {
+			return nil, fmt.Errorf("password_incorrect")
+		}
+		if errors.Is(err, context.Canceled) {
+			log.Println("Verification was cancelled by user.")
+			return nil, fmt.Errorf("Verification cancelled.")
+		}
+		log.Printf("Verify backup failed: %v\n", err)
+		return nil, fmt.Errorf("Verify backup failed: %w", err)
+	}
+	log.Printf("Verification finished: %d entries, %d issues", report.Entries, len(report.Issues))
+	return report, nil
+}
+
+// DiffBackups compares what two backups (full or incremental) would restore.
+func (a *App) DiffBackups(oldBackup, newBackup, password string) (*core.BackupDiff, error) {
+	manager := core.NewBackupManager(a.ctx)
+	manager.DisableEvents()
+
+	diff, err := manager.DiffBackups(oldBackup, newBackup, password)
+	if err != nil {
+		if errors.Is(err, core.ErrPasswordRequired) {
+			return nil, fmt.Errorf("password_required")
+		}
+		if errors.Is(err, core.ErrInvalidPassword) {
+			return nil, fmt.Errorf("password_incorrect")
+		}
+		log.Printf("Diff backups failed: %v\n", err)
+		return nil, fmt.Errorf("Diff backups failed: %w", err)
+	}
+	return diff, nil
 }
 
 // --- Database Functions ---
@@ -400,7 +555,7 @@ func (a *App) GetBackupHistory() ([]BackupRecord, error) {
 
 	// 检查文件是否存在
 	for _, record := range records {
-		if _, err := os.Stat(record.BackupPath); err == nil {
+		if core.BackupExists(record.BackupPath) {
 			validRecords = append(validRecords, record)
 		} else {
 			invalidIDs = append(invalidIDs, record.ID)
@@ -2,7 +2,9 @@
 package core
 
 import (
+	"bytes"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"hash"
@@ -12,7 +14,33 @@ import (
 	"time"
 )
 
-const maxArchiveHeaderLen = 1 << 20 // 1 MiB safety limit for JSON header
+const maxArchiveHeaderLen = 1 << 20 // 1 MiB safety limit for entry headers
+
+// 归档末尾的索引条目: JSON 负载后紧跟 "QIDX" + 索引条目头部偏移 (uint64)，再由 CRC32 收尾。
+// 因此归档明文流的最后 16 字节总是 [QIDX][offset][crc32]，可以从尾部直接定位索引。
+var archiveIndexMagic = []byte("QIDX")
+
+const (
+	archiveIndexLocatorLen = 4 + 8
+	archiveIndexTailLen    = archiveIndexLocatorLen + 4
+)
+
+// archiveIndexEntry 记录一个条目头部在归档明文流中的偏移
+type archiveIndexEntry struct {
+	Path    string `json:"path"`
+	Offset  int64  `json:"offset"`
+	Size    int64  `json:"size"`
+	Deleted bool   `json:"deleted,omitempty"`
+
+	prevPath string // 写入顺序中上一个条目的路径，v2 头部的路径前缀以它为基准
+}
+
+type archiveIndex struct {
+	Version int                 `json:"version"`
+	Entries []archiveIndexEntry `json:"entries"`
+	// Manifest 是数据之后那份带内容哈希的清单的头部偏移，读取清单时借助它直接定位。旧版本的备份只有第一个条目中的清单，没有这个字段
+	Manifest int64 `json:"manifest,omitempty"`
+}
 
 // FileMetadata 存储文件的元数据
 type FileMetadata struct {
@@ -25,44 +53,117 @@ type FileMetadata struct {
 	LinkDest string      `json:"linkDest"` // 符号链接目标
 	HasCRC   bool        `json:"hasCrc,omitempty"`
 	Deleted  bool        `json:"deleted,omitempty"`
+
+	Xattrs   map[string][]byte `json:"xattrs,omitempty"`   // 扩展属性，包括 ACL、SELinux 标签和文件能力
+	HardLink string            `json:"hardLink,omitempty"` // 硬链接指向的归档路径，此时条目没有数据
+	Owner    *FileOwner        `json:"owner,omitempty"`    // 属主，Windows 上为空
+	DevMajor uint32            `json:"devMajor,omitempty"` // 设备节点的主设备号
+	DevMinor uint32            `json:"devMinor,omitempty"` // 设备节点的次设备号
+
+	// 稀疏文件只保存 Extents 中的数据，其余部分为空洞；Size 仍为文件的逻辑大小
+	Sparse  bool           `json:"sparse,omitempty"`
+	Extents []SparseExtent `json:"extents,omitempty"`
+
+	SHA256 string `json:"sha256,omitempty"` // 普通文件完整内容的 SHA-256 (十六进制)，读取数据之后才可用
+	hashed bool   // 数据的 CRC32 之后跟随 32 字节的 SHA-256 尾部 (v2 头部的 headerFlagSHA256)
+
+	// Compression 是条目数据使用的压缩方式 (编解码器名称，见 CompressionPolicy)，
+	// 空表示与备份流相同 (旧版本的备份以及没有数据的条目)
+	Compression string `json:"compression,omitempty"`
+}
+
+// SparseExtent 是稀疏文件中的一段数据
+type SparseExtent struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// countingWriter 统计写入的字节数，用于计算条目偏移
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
 }
 
 // ArchiveWriter 写入自定义格式的归档文件
 type ArchiveWriter struct {
-	w io.Writer
+	w     *countingWriter
+	index []archiveIndexEntry
+
+	manifestOffset int64
+	hashFiles      bool // 为普通文件写入内容哈希尾部，备份时启用
+
+	version  int
+	started  bool
+	prevPath string
 }
 
 func NewArchiveWriter(w io.Writer) *ArchiveWriter {
-	return &ArchiveWriter{w: w}
+	return &ArchiveWriter{w: &countingWriter{w: w}, version: archiveVersion2}
 }
 
 // WriteEntry 将一个文件或目录写入归档
 func (aw *ArchiveWriter) WriteEntry(meta FileMetadata, data io.Reader, buffer []byte, onWrite func(wrote int64)) error {
-	headerBytes, err := json.Marshal(meta)
-	if err != nil {
-		return fmt.Errorf("failed to marshal header: %w", err)
+	return aw.writeEntry(&meta, data, buffer, onWrite)
+}
+
+// writeEntry 与 WriteEntry 相同；启用 hashFiles 时，v2 归档中的普通文件在写入数据的同时计算内容哈希，
+// 写在 CRC32 之后并保存到 meta.SHA256，调用方据此填写之后写入的清单
+func (aw *ArchiveWriter) writeEntry(meta *FileMetadata, data io.Reader, buffer []byte, onWrite func(wrote int64)) error {
+	// 在写入头部之前切换，条目的头部和数据都属于同一个压缩块；Compression 为空的条目使用流的编解码器。
+	// 每次切换都会结束当前的块，因此只为带数据的文件切换，归档魔数、没有数据的条目和内部条目留在当前的块中
+	if sw, ok := aw.w.w.(storeSwitcher); ok && meta.carriesData() {
+		if err := sw.setStored(meta.Compression == CodecStore); err != nil {
+			return err
+		}
 	}
 
-	headerLen := uint32(len(headerBytes))
-	if err := binary.Write(aw.w, binary.BigEndian, headerLen); err != nil {
-		return fmt.Errorf("failed to write header length: %w", err)
+	if !aw.started && aw.version == archiveVersion2 {
+		if _, err := aw.w.Write(archiveMagicV2); err != nil {
+			return fmt.Errorf("failed to write archive magic: %w", err)
+		}
 	}
+	aw.started = true
 
-	if _, err := aw.w.Write(headerBytes); err != nil {
-		return fmt.Errorf("failed to write header json: %w", err)
+	if meta.Path == manifestEntryPath {
+		aw.manifestOffset = aw.w.n
+	}
+	if !isInternalPath(meta.Path) {
+		aw.index = append(aw.index, archiveIndexEntry{
+			Path:    meta.Path,
+			Offset:  aw.w.n,
+			Size:    meta.Size,
+			Deleted: meta.Deleted,
+		})
+	}
+
+	meta.hashed = aw.hashFiles && aw.version == archiveVersion2 && meta.hasCRCTrailer() && meta.HardLink == "" && !isInternalPath(meta.Path)
+	if err := aw.writeHeader(meta); err != nil {
+		return err
 	}
 
 	var crcHash hash.Hash32
 	var dataWriter io.Writer = aw.w
-	if meta.HasCRC && meta.Mode.IsRegular() && !meta.Deleted {
+	if meta.hasCRCTrailer() {
 		crcHash = crc32.NewIEEE()
 		dataWriter = io.MultiWriter(aw.w, crcHash)
 	}
+	var contentHash *contentHasher
+	if meta.hasSHA256Trailer() {
+		contentHash = newContentHasher(meta)
+		dataWriter = io.MultiWriter(dataWriter, contentHash)
+	}
 
-	if data != nil && meta.Size > 0 {
-		limitedReader := io.LimitReader(data, meta.Size)
+	payloadSize := meta.payloadSize()
+	if data != nil && payloadSize > 0 {
+		limitedReader := io.LimitReader(data, payloadSize)
 		var written int64
-		for written < meta.Size {
+		for written < payloadSize {
 			nr, readErr := limitedReader.Read(buffer)
 			if nr > 0 {
 				nw, writeErr := dataWriter.Write(buffer[:nr])
@@ -84,8 +185,8 @@ func (aw *ArchiveWriter) WriteEntry(meta FileMetadata, data io.Reader, buffer []
 				return fmt.Errorf("failed to read file data: %w", readErr)
 			}
 		}
-		if written != meta.Size {
-			return fmt.Errorf("file size mismatch for %s: expected %d, wrote %d", meta.Path, meta.Size, written)
+		if written != payloadSize {
+			return fmt.Errorf("file size mismatch for %s: expected %d, wrote %d", meta.Path, payloadSize, written)
 		}
 	}
 
@@ -94,29 +195,154 @@ func (aw *ArchiveWriter) WriteEntry(meta FileMetadata, data io.Reader, buffer []
 			return fmt.Errorf("failed to write crc32: %w", err)
 		}
 	}
+	if contentHash != nil {
+		sum, err := contentHash.sum()
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", meta.Path, err)
+		}
+		meta.SHA256 = hex.EncodeToString(sum)
+		if _, err := aw.w.Write(sum); err != nil {
+			return fmt.Errorf("failed to write sha256: %w", err)
+		}
+	}
 
 	return nil
 }
 
-// ArchiveReader 读取自定义格式的归档文件
-type ArchiveReader struct {
+func (aw *ArchiveWriter) writeHeader(meta *FileMetadata) error {
+	if aw.version == archiveVersion1 {
+		headerBytes, err := json.Marshal(meta)
+		if err != nil {
+			return fmt.Errorf("failed to marshal header: %w", err)
+		}
+		if err := binary.Write(aw.w, binary.BigEndian, uint32(len(headerBytes))); err != nil {
+			return fmt.Errorf("failed to write header length: %w", err)
+		}
+		if _, err := aw.w.Write(headerBytes); err != nil {
+			return fmt.Errorf("failed to write header json: %w", err)
+		}
+		return nil
+	}
+
+	headerBytes := encodeHeaderV2(meta, aw.prevPath)
+	if len(headerBytes) > maxArchiveHeaderLen {
+		return fmt.Errorf("entry header too large for %s: %d bytes", meta.Path, len(headerBytes))
+	}
+	if !isInternalPath(meta.Path) {
+		aw.prevPath = meta.Path
+	}
+	header := binary.AppendUvarint(make([]byte, 0, len(headerBytes)+binary.MaxVarintLen32), uint64(len(headerBytes)))
+	header = append(header, headerBytes...)
+	if _, err := aw.w.Write(header); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	return nil
+}
+
+// WriteIndex 在归档末尾写入随机访问索引，必须在所有条目写完之后调用
+func (aw *ArchiveWriter) WriteIndex() error {
+	indexBytes, err := json.Marshal(archiveIndex{Version: 1, Entries: aw.index, Manifest: aw.manifestOffset})
+	if err != nil {
+		return fmt.Errorf("failed to marshal archive index: %w", err)
+	}
+
+	payload := make([]byte, 0, len(indexBytes)+archiveIndexLocatorLen)
+	payload = append(payload, indexBytes...)
+	payload = append(payload, archiveIndexMagic...)
+	payload = binary.BigEndian.AppendUint64(payload, uint64(aw.w.n))
+
+	meta := FileMetadata{
+		Path:   archiveIndexPath,
+		Size:   int64(len(payload)),
+		Mode:   0644,
+		HasCRC: true,
+	}
+	if err := aw.WriteEntry(meta, bytes.NewReader(payload), make([]byte, copyBufferSize), nil); err != nil {
+		return fmt.Errorf("failed to write archive index: %w", err)
+	}
+	return nil
+}
+
+// countingReader 统计已读取的字节数，用于记录条目偏移
+type countingReader struct {
 	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func (cr *countingReader) ReadByte() (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(cr, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// ArchiveReader 读取自定义格式的归档文件，格式版本在读取第一个条目时自动识别
+type ArchiveReader struct {
+	r *countingReader
+
+	version  int    // 0 表示尚未识别
+	prevPath string // 上一个非内部条目的路径，用于还原 v2 头部中的路径前缀
 }
 
 func NewArchiveReader(r io.Reader) *ArchiveReader {
-	return &ArchiveReader{r: r}
+	return &ArchiveReader{r: &countingReader{r: r}}
+}
+
+// Offset 返回当前在归档流中的位置 (相对于创建 ArchiveReader 时的起点)
+func (ar *ArchiveReader) Offset() int64 {
+	return ar.r.n
 }
 
 // NextEntry 读取下一个文件条目。如果到文件末尾，返回 io.EOF
 func (ar *ArchiveReader) NextEntry() (*FileMetadata, error) {
-	var headerLen uint32
-	if err := binary.Read(ar.r, binary.BigEndian, &headerLen); err != nil {
-		if err == io.EOF {
-			return nil, io.EOF // 正常结束
+	var meta *FileMetadata
+	var err error
+	switch ar.version {
+	case 0:
+		meta, err = ar.detectVersion()
+	case archiveVersion1:
+		var lenBuf [4]byte
+		if _, err := io.ReadFull(ar.r, lenBuf[:]); err != nil {
+			return nil, err // 在条目边界上结束时为 io.EOF
+		}
+		meta, err = ar.readHeaderV1(binary.BigEndian.Uint32(lenBuf[:]))
+	default:
+		meta, err = ar.readHeaderV2()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.Sparse {
+		if err := meta.validateExtents(); err != nil {
+			return nil, err
 		}
+	}
+	return meta, nil
+}
+
+// detectVersion 读取流开头的 4 个字节: v2 归档以 "QAR2" 开头，v1 归档则是第一个条目的头部长度
+func (ar *ArchiveReader) detectVersion() (*FileMetadata, error) {
+	var start [4]byte
+	if _, err := io.ReadFull(ar.r, start[:]); err != nil {
 		return nil, err
 	}
+	if bytes.Equal(start[:], archiveMagicV2) {
+		ar.version = archiveVersion2
+		return ar.readHeaderV2()
+	}
+	ar.version = archiveVersion1
+	return ar.readHeaderV1(binary.BigEndian.Uint32(start[:]))
+}
 
+func (ar *ArchiveReader) readHeaderV1(headerLen uint32) (*FileMetadata, error) {
 	if headerLen == 0 || headerLen > maxArchiveHeaderLen {
 		return nil, fmt.Errorf("invalid archive header length: %d", headerLen)
 	}
@@ -130,6 +356,148 @@ func (ar *ArchiveReader) NextEntry() (*FileMetadata, error) {
 	if err := json.Unmarshal(headerBytes, &meta); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal header: %w", err)
 	}
-
 	return &meta, nil
 }
+
+func (ar *ArchiveReader) readHeaderV2() (*FileMetadata, error) {
+	headerLen, err := binary.ReadUvarint(ar.r)
+	if err != nil {
+		return nil, err // 在条目边界上结束时为 io.EOF
+	}
+	if headerLen == 0 || headerLen > maxArchiveHeaderLen {
+		return nil, fmt.Errorf("invalid archive header length: %d", headerLen)
+	}
+
+	headerBytes := make([]byte, headerLen)
+	if _, err := io.ReadFull(ar.r, headerBytes); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	meta, err := decodeHeaderV2(headerBytes, ar.prevPath)
+	if err != nil {
+		return nil, err
+	}
+	if !isInternalPath(meta.Path) {
+		ar.prevPath = meta.Path
+	}
+	return meta, nil
+}
+
+// payloadSize 返回条目在归档中实际保存的数据长度
+// carriesData 判断条目是否是带有数据的文件 (不包括内部条目)
+func (meta *FileMetadata) carriesData() bool {
+	return !meta.Deleted && meta.HardLink == "" && !isInternalPath(meta.Path) && meta.payloadSize() > 0
+}
+
+func (meta *FileMetadata) payloadSize() int64 {
+	if !meta.Sparse {
+		return meta.Size
+	}
+	var n int64
+	for _, e := range meta.Extents {
+		n += e.Length
+	}
+	return n
+}
+
+// validateExtents 检查稀疏文件的数据段是否有序、互不重叠且位于文件范围内
+func (meta *FileMetadata) validateExtents() error {
+	var end int64
+	for _, e := range meta.Extents {
+		if e.Offset < end || e.Length < 0 || e.Offset+e.Length > meta.Size {
+			return fmt.Errorf("invalid sparse extent for %s: offset %d, length %d", meta.Path, e.Offset, e.Length)
+		}
+		end = e.Offset + e.Length
+	}
+	return nil
+}
+
+// hasCRCTrailer 判断条目数据之后是否跟随 CRC32 尾部
+func (meta *FileMetadata) hasCRCTrailer() bool {
+	return meta.HasCRC && meta.Mode.IsRegular() && !meta.Deleted
+}
+
+// hasSHA256Trailer 判断 CRC32 尾部之后是否还跟随内容哈希
+func (meta *FileMetadata) hasSHA256Trailer() bool {
+	return meta.hashed && meta.hasCRCTrailer()
+}
+
+// readTrailer 读取数据之后的 CRC32 与内容哈希尾部，内容哈希保存到 meta.SHA256
+func readTrailer(r io.Reader, meta *FileMetadata) (uint32, error) {
+	var crc uint32
+	if err := binary.Read(r, binary.BigEndian, &crc); err != nil {
+		return 0, fmt.Errorf("failed to read crc32 for %s: %w", meta.Path, err)
+	}
+	if meta.hasSHA256Trailer() {
+		sum := make([]byte, sha256Size)
+		if _, err := io.ReadFull(r, sum); err != nil {
+			return 0, fmt.Errorf("failed to read sha256 for %s: %w", meta.Path, err)
+		}
+		meta.SHA256 = hex.EncodeToString(sum)
+	}
+	return crc, nil
+}
+
+// SkipEntry 跳过当前条目的数据与尾部 (不校验 CRC 和内容哈希，但内容哈希仍会保存到 meta.SHA256)
+func (ar *ArchiveReader) SkipEntry(meta *FileMetadata) error {
+	if meta.Size < 0 {
+		return fmt.Errorf("invalid entry size for %s: %d", meta.Path, meta.Size)
+	}
+	if n := meta.payloadSize(); n > 0 {
+		if _, err := io.CopyN(io.Discard, ar.r, n); err != nil {
+			return fmt.Errorf("failed to skip entry %s: %w", meta.Path, err)
+		}
+	}
+	if meta.hasCRCTrailer() {
+		if _, err := readTrailer(ar.r, meta); err != nil {
+			return fmt.Errorf("failed to skip entry %s: %w", meta.Path, err)
+		}
+	}
+	return nil
+}
+
+// copyEntryData 将当前条目的数据写入 w；若条目带有 CRC 则读取尾部并校验，带有内容哈希时同样校验
+func (ar *ArchiveReader) copyEntryData(meta *FileMetadata, w io.Writer, buffer []byte) error {
+	if meta.Size < 0 {
+		return fmt.Errorf("invalid entry size for %s: %d", meta.Path, meta.Size)
+	}
+
+	hasCRC := meta.hasCRCTrailer()
+	var crcHash hash.Hash32
+	if hasCRC {
+		crcHash = crc32.NewIEEE()
+		w = io.MultiWriter(w, crcHash)
+	}
+	var contentHash *contentHasher
+	if meta.hasSHA256Trailer() {
+		contentHash = newContentHasher(meta)
+		w = io.MultiWriter(w, contentHash)
+	}
+
+	if size := meta.payloadSize(); size > 0 {
+		if buffer == nil {
+			buffer = make([]byte, copyBufferSize)
+		}
+		n, err := io.CopyBuffer(w, io.LimitReader(ar.r, size), buffer)
+		if err != nil {
+			return fmt.Errorf("failed to copy data for %s: %w", meta.Path, err)
+		}
+		if n != size {
+			return fmt.Errorf("failed to copy data for %s: %w", meta.Path, io.ErrUnexpectedEOF)
+		}
+	}
+
+	if hasCRC {
+		// 先读完整个尾部再校验，校验失败时流仍然对齐
+		expected, err := readTrailer(ar.r, meta)
+		if err != nil {
+			return err
+		}
+		if crcHash.Sum32() != expected {
+			return fmt.Errorf("%w for %s", ErrChecksumMismatch, meta.Path)
+		}
+	}
+	if contentHash != nil {
+		return contentHash.check(meta)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BackupFS 是备份 (增量备份则为整条备份链合并后的状态) 的只读 fs.FS 视图，
+// 可以直接用于 fs.WalkDir、http.FS、template.ParseFS 等标准库工具。
+// 目录结构来自清单 (没有清单的旧版本备份读取条目头部)；打开文件时借助归档索引从备份中流式读取数据，不会解压其他文件。
+// 符号链接在 Open 和 Stat 时被跟随，指向备份之外的链接视为不存在；ReadDir 返回链接本身。
+type BackupFS struct {
+	m        *BackupManager
+	chain    []string
+	password string
+	nodes    map[string]*BackupEntryNode // 以 fs 路径为键，根目录为 "."
+}
+
+var (
+	_ fs.ReadDirFS = (*BackupFS)(nil)
+	_ fs.StatFS    = (*BackupFS)(nil)
+)
+
+// maxSymlinkHops 是解析一个路径时最多跟随的符号链接数
+const maxSymlinkHops = 40
+
+// OpenFS 解析备份链并返回备份内容的 fs.FS 视图
+func (m *BackupManager) OpenFS(backupFile, password string) (*BackupFS, error) {
+	chain, manifests, err := m.resolveManifestChain(backupFile, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []ManifestFile
+	if manifest := manifests[len(manifests)-1]; manifest != nil {
+		files = manifest.Files
+	} else {
+		log.Println("Backup has no manifest, listing entry headers.")
+		files, err = m.listEntries(backupFile, password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fsys := &BackupFS{m: m, chain: chain, password: password, nodes: make(map[string]*BackupEntryNode, len(files)+1)}
+	var add func(node *BackupEntryNode)
+	add = func(node *BackupEntryNode) {
+		key := node.Path
+		if key == "" {
+			key = "."
+		}
+		fsys.nodes[key] = node
+		sort.Slice(node.Children, func(i, j int) bool { return node.Children[i].Name < node.Children[j].Name })
+		for _, child := range node.Children {
+			add(child)
+		}
+	}
+	add(buildEntryTree(files))
+	return fsys, nil
+}
+
+// Open 打开文件或目录。文件的数据在第一次读取时才开始从备份中读取。
+func (fsys *BackupFS) Open(name string) (fs.File, error) {
+	node, err := fsys.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info := backupFileInfo{node: node}
+	if node.IsDir {
+		return &backupDir{info: info, entries: node.Children}, nil
+	}
+	return &backupFSFile{fsys: fsys, info: info}, nil
+}
+
+// Stat 返回文件信息，符号链接会被跟随
+func (fsys *BackupFS) Stat(name string) (fs.FileInfo, error) {
+	node, err := fsys.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return backupFileInfo{node: node}, nil
+}
+
+// ReadDir 返回目录中按名称排序的条目
+func (fsys *BackupFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	node, err := fsys.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !node.IsDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries := make([]fs.DirEntry, len(node.Children))
+	for i, child := range node.Children {
+		entries[i] = backupFileInfo{node: child}
+	}
+	return entries, nil
+}
+
+// resolve 查找 name 对应的节点，路径中的符号链接 (包括最后一个元素) 都会被跟随
+func (fsys *BackupFS) resolve(op, name string) (*BackupEntryNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	notExist := &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+
+	current := name
+	for hops := 0; hops <= maxSymlinkHops; hops++ {
+		if current == "." {
+			return fsys.nodes["."], nil
+		}
+		parts := strings.Split(current, "/")
+		dir := ""
+		var node *BackupEntryNode
+		followed := false
+		for i, part := range parts {
+			p := path.Join(dir, part)
+			var ok bool
+			if node, ok = fsys.nodes[p]; !ok {
+				return nil, notExist
+			}
+			if node.IsLink {
+				target := path.Join(dir, node.LinkDest)
+				if path.IsAbs(node.LinkDest) || !fs.ValidPath(target) {
+					return nil, notExist
+				}
+				current = path.Join(append([]string{target}, parts[i+1:]...)...)
+				followed = true
+				break
+			}
+			if i < len(parts)-1 && !node.IsDir {
+				return nil, notExist
+			}
+			dir = p
+		}
+		if !followed {
+			return node, nil
+		}
+	}
+	return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many levels of symbolic links")}
+}
+
+// openData 在后台从备份链中提取文件内容，读取端关闭时提取随之停止
+func (fsys *BackupFS) openData(relPath string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(fsys.m.extractFromChain(fsys.chain, relPath, fsys.password, pw))
+	}()
+	return pr
+}
+
+// backupFileInfo 同时实现 fs.FileInfo 和 fs.DirEntry
+type backupFileInfo struct {
+	node *BackupEntryNode
+}
+
+func (fi backupFileInfo) Name() string {
+	if fi.node.Path == "" {
+		return "."
+	}
+	return fi.node.Name
+}
+
+func (fi backupFileInfo) Size() int64 {
+	if fi.node.IsDir {
+		return 0
+	}
+	return fi.node.Size
+}
+
+func (fi backupFileInfo) Mode() fs.FileMode          { return fi.node.Mode }
+func (fi backupFileInfo) ModTime() time.Time         { return fi.node.ModTime }
+func (fi backupFileInfo) IsDir() bool                { return fi.node.IsDir }
+func (fi backupFileInfo) Sys() any                   { return fi.node.ManifestFile }
+func (fi backupFileInfo) Type() fs.FileMode          { return fi.node.Mode.Type() }
+func (fi backupFileInfo) Info() (fs.FileInfo, error) { return fi, nil }
+func (fi backupFileInfo) String() string             { return fs.FormatDirEntry(fi) }
+
+// backupDir 是打开的目录，实现 fs.ReadDirFile
+type backupDir struct {
+	info    backupFileInfo
+	entries []*BackupEntryNode
+	offset  int
+}
+
+func (d *backupDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *backupDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *backupDir) Close() error { return nil }
+
+func (d *backupDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n > 0 && len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(remaining) {
+		remaining = remaining[:n]
+	}
+	entries := make([]fs.DirEntry, len(remaining))
+	for i, child := range remaining {
+		entries[i] = backupFileInfo{node: child}
+	}
+	d.offset += len(remaining)
+	return entries, nil
+}
+
+// backupFSFile 是打开的文件。数据只能顺序读取，Seek 到其他位置时会重新从头读取并跳过前面的数据。
+type backupFSFile struct {
+	fsys   *BackupFS
+	info   backupFileInfo
+	pos    int64
+	data   io.ReadCloser
+	offset int64 // data 当前的读取位置
+	closed bool
+}
+
+func (f *backupFSFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *backupFSFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.info.node.Path, Err: fs.ErrClosed}
+	}
+	if f.pos >= f.info.Size() {
+		return 0, io.EOF
+	}
+	if f.data == nil || f.offset != f.pos {
+		if f.data != nil {
+			_ = f.data.Close()
+		}
+		f.data = f.fsys.openData(f.info.node.Path)
+		f.offset = 0
+		if f.pos > 0 {
+			n, err := io.CopyN(io.Discard, f.data, f.pos)
+			f.offset = n
+			if err != nil {
+				return 0, &fs.PathError{Op: "read", Path: f.info.node.Path, Err: err}
+			}
+		}
+	}
+	n, err := f.data.Read(p)
+	f.pos += int64(n)
+	f.offset += int64(n)
+	if err != nil && err != io.EOF {
+		err = &fs.PathError{Op: "read", Path: f.info.node.Path, Err: err}
+	}
+	return n, err
+}
+
+func (f *backupFSFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.node.Path, Err: fs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.info.Size()
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.info.node.Path, Err: fmt.Errorf("invalid whence %d", whence)}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.info.node.Path, Err: fs.ErrInvalid}
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *backupFSFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.info.node.Path, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	if f.data != nil {
+		return f.data.Close()
+	}
+	return nil
+}
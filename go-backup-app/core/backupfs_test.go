@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupFS(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "dir", "sub"), 0755))
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), []byte(content), 0644))
+	}
+	big := strings.Repeat("0123456789", 20000)
+	write("a.txt", "alpha")
+	write("dir/b.txt", "beta")
+	write("dir/sub/big.bin", big)
+	write("old.txt", "removed later")
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	filters := FilterConfig{MaxSize: -1}
+
+	full := filepath.Join(tempDir, "full.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, full, filters, CodecHuffman, true, AlgoChaCha20, "pw"))
+
+	write("a.txt", "alpha v2")
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "old.txt")))
+	require.NoError(t, os.Link(filepath.Join(srcDir, "dir", "b.txt"), filepath.Join(srcDir, "hard.txt")))
+	incr := filepath.Join(tempDir, "incr.qbak")
+	require.NoError(t, manager.BackupIncremental([]string{srcDir}, incr, full, filters, CodecHuffman, true, AlgoChaCha20, "pw"))
+
+	fsys, err := manager.OpenFS(incr, "pw")
+	require.NoError(t, err)
+	require.NoError(t, fstest.TestFS(fsys, "a.txt", "dir/b.txt", "dir/sub/big.bin", "hard.txt"))
+
+	var walked []string
+	require.NoError(t, fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		require.NoError(t, err)
+		walked = append(walked, p)
+		return nil
+	}))
+	require.Equal(t, []string{".", "a.txt", "dir", "dir/b.txt", "dir/sub", "dir/sub/big.bin", "hard.txt"}, walked)
+
+	// 增量备份中未变化的文件从完整备份读取
+	for name, want := range map[string]string{"a.txt": "alpha v2", "dir/b.txt": "beta", "hard.txt": "beta", "dir/sub/big.bin": big} {
+		data, err := fs.ReadFile(fsys, name)
+		require.NoError(t, err, name)
+		require.Equal(t, want, string(data), name)
+	}
+
+	_, err = fsys.Open("old.txt")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fsys.Stat("../a.txt")
+	require.ErrorIs(t, err, fs.ErrInvalid)
+
+	info, err := fsys.Stat("dir/sub/big.bin")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(big)), info.Size())
+	require.Equal(t, "big.bin", info.Name())
+	require.True(t, info.Mode().IsRegular())
+
+	// 部分读取后关闭，后台提取随之停止
+	f, err := fsys.Open("dir/sub/big.bin")
+	require.NoError(t, err)
+	buf := make([]byte, 10)
+	_, err = io.ReadFull(f, buf)
+	require.NoError(t, err)
+	seeker := f.(io.Seeker)
+	_, err = seeker.Seek(-10, io.SeekEnd)
+	require.NoError(t, err)
+	_, err = io.ReadFull(f, buf)
+	require.NoError(t, err)
+	require.Equal(t, big[len(big)-10:], string(buf))
+	require.NoError(t, f.Close())
+
+	_, err = manager.OpenFS(incr, "wrong")
+	require.ErrorIs(t, err, ErrInvalidPassword)
+}
+
+func TestBackupFS_Symlinks(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "dir"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "dir", "file.txt"), []byte("target"), 0644))
+	require.NoError(t, os.Symlink("dir/file.txt", filepath.Join(srcDir, "file-link")))
+	require.NoError(t, os.Symlink("dir", filepath.Join(srcDir, "dir-link")))
+	require.NoError(t, os.Symlink("../../outside", filepath.Join(srcDir, "dir", "escape")))
+	require.NoError(t, os.Symlink("loop", filepath.Join(srcDir, "loop")))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	backupFile := filepath.Join(tempDir, "links.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, FilterConfig{MaxSize: -1}, CodecStore, false, 0, ""))
+
+	fsys, err := manager.OpenFS(backupFile, "")
+	require.NoError(t, err)
+
+	data, err := fs.ReadFile(fsys, "file-link")
+	require.NoError(t, err)
+	require.Equal(t, "target", string(data))
+	data, err = fs.ReadFile(fsys, "dir-link/file.txt")
+	require.NoError(t, err)
+	require.Equal(t, "target", string(data))
+
+	info, err := fsys.Stat("dir-link")
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+
+	// ReadDir 返回链接本身
+	entries, err := fsys.ReadDir(".")
+	require.NoError(t, err)
+	types := map[string]fs.FileMode{}
+	for _, e := range entries {
+		types[e.Name()] = e.Type()
+	}
+	require.Equal(t, fs.ModeSymlink, types["file-link"])
+	require.Equal(t, fs.ModeDir, types["dir"])
+
+	_, err = fsys.Open("dir/escape")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fsys.Stat("loop")
+	require.Error(t, err)
+}
@@ -0,0 +1,317 @@
+// core/canonical.go
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// 范式 Huffman 编码: 码长相同的符号按符号值递增分配编码，因此只需保存每个符号的码长就能还原编码表。
+// huffman 编解码器 (huffman.go) 与 LZ77 编解码器 (lz77.go) 共用这里的编码和解码。
+const (
+	maxCodeLen = 15
+	// huffmanTableBits 是解码查找表一次查看的位数，更长的编码退回逐位解码
+	huffmanTableBits = 10
+)
+
+// huffmanCodeLengths 按频率计算码长，最长不超过 maxLen；频率为 0 的符号码长为 0。
+// 超长时把频率减半后重新计算，直到满足限制。
+func huffmanCodeLengths(freqs []int64, maxLen int) []uint8 {
+	lengths := make([]uint8, len(freqs))
+	syms := make([]int, 0, len(freqs))
+	for s, f := range freqs {
+		if f > 0 {
+			syms = append(syms, s)
+		}
+	}
+	switch len(syms) {
+	case 0:
+		return lengths
+	case 1:
+		lengths[syms[0]] = 1
+		return lengths
+	}
+
+	weights := make([]int64, len(freqs))
+	copy(weights, freqs)
+	for {
+		sort.Slice(syms, func(i, j int) bool {
+			if weights[syms[i]] != weights[syms[j]] {
+				return weights[syms[i]] < weights[syms[j]]
+			}
+			return syms[i] < syms[j]
+		})
+
+		// 双队列构建: 叶子已按权重排序，新建的内部节点权重单调不减
+		n := len(syms)
+		weight := make([]int64, 2*n-1)
+		parent := make([]int, 2*n-1)
+		for i, s := range syms {
+			weight[i] = weights[s]
+		}
+		leaf, node := 0, n
+		pick := func(next int) int {
+			if leaf < n && (node >= next || weight[leaf] <= weight[node]) {
+				leaf++
+				return leaf - 1
+			}
+			node++
+			return node - 1
+		}
+		for next := n; next < 2*n-1; next++ {
+			a := pick(next)
+			b := pick(next)
+			weight[next] = weight[a] + weight[b]
+			parent[a], parent[b] = next, next
+		}
+
+		depth := make([]int, 2*n-1)
+		tooLong := false
+		for i := 2*n - 3; i >= 0; i-- {
+			depth[i] = depth[parent[i]] + 1
+			if i < n && depth[i] > maxLen {
+				tooLong = true
+			}
+		}
+		if !tooLong {
+			for i, s := range syms {
+				lengths[s] = uint8(depth[i])
+			}
+			return lengths
+		}
+		for _, s := range syms {
+			weights[s] = weights[s]/2 + 1
+		}
+	}
+}
+
+// canonicalCodes 按码长分配范式 Huffman 编码
+func canonicalCodes(lengths []uint8) []uint32 {
+	var count [maxCodeLen + 1]uint32
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [maxCodeLen + 1]uint32
+	code := uint32(0)
+	for l := 1; l <= maxCodeLen; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	codes := make([]uint32, len(lengths))
+	for s, l := range lengths {
+		if l > 0 {
+			codes[s] = next[l]
+			next[l]++
+		}
+	}
+	return codes
+}
+
+// packCodes 把每个符号的编码和码长打包为 code<<8 | length 写入 dst，编码时查一次表即可得到两者
+func packCodes(dst []uint32, lengths []uint8) {
+	for s, code := range canonicalCodes(lengths) {
+		dst[s] = code<<8 | uint32(lengths[s])
+	}
+}
+
+// appendCodeLengths 把码长表追加到 dst，每个符号 4 bit (符号数必须为偶数)
+func appendCodeLengths(dst []byte, lengths []uint8) []byte {
+	for i := 0; i < len(lengths); i += 2 {
+		dst = append(dst, lengths[i]<<4|lengths[i+1])
+	}
+	return dst
+}
+
+// readCodeLengths 解析 appendCodeLengths 写入的码长表
+func readCodeLengths(table []byte) []uint8 {
+	lengths := make([]uint8, 0, 2*len(table))
+	for _, b := range table {
+		lengths = append(lengths, b>>4, b&0x0F)
+	}
+	return lengths
+}
+
+// huffmanDecoder 解码范式 Huffman 编码。
+// 查找表以接下来的 huffmanTableBits 位为下标，一次得到符号和码长；更长的编码在表中标记为 0，改为逐位解码。
+type huffmanDecoder struct {
+	table   [1 << huffmanTableBits]uint16 // 符号<<4 | 码长
+	count   [maxCodeLen + 1]int
+	symbols []int // 按 (码长, 符号) 排序
+}
+
+func newHuffmanDecoder(lengths []uint8) (*huffmanDecoder, error) {
+	d := &huffmanDecoder{}
+	for _, l := range lengths {
+		if l > maxCodeLen {
+			return nil, fmt.Errorf("invalid huffman code length: %d", l)
+		}
+		d.count[l]++
+	}
+	// 编码空间不能被超额分配
+	left := 1
+	for l := 1; l <= maxCodeLen; l++ {
+		left = left<<1 - d.count[l]
+		if left < 0 {
+			return nil, fmt.Errorf("invalid huffman code lengths")
+		}
+	}
+	for l := 1; l <= maxCodeLen; l++ {
+		for s, sl := range lengths {
+			if int(sl) == l {
+				d.symbols = append(d.symbols, s)
+			}
+		}
+	}
+
+	codes := canonicalCodes(lengths)
+	for s, l := range lengths {
+		if l == 0 || l > huffmanTableBits {
+			continue
+		}
+		shift := huffmanTableBits - uint(l)
+		start := codes[s] << shift
+		for i := start; i < start+1<<shift; i++ {
+			d.table[i] = uint16(s)<<4 | uint16(l)
+		}
+	}
+	return d, nil
+}
+
+func (d *huffmanDecoder) decode(br *bitUnpacker) (int, error) {
+	if e := d.table[br.peek(huffmanTableBits)]; e != 0 {
+		if err := br.skip(uint(e & 0xF)); err != nil {
+			return 0, err
+		}
+		return int(e >> 4), nil
+	}
+	return d.decodeSlow(br)
+}
+
+// decodeSlow 逐位解码
+func (d *huffmanDecoder) decodeSlow(br *bitUnpacker) (int, error) {
+	code, first, index := 0, 0, 0
+	for l := 1; l <= maxCodeLen; l++ {
+		bit, err := br.read(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= int(bit)
+		if code-first < d.count[l] {
+			return d.symbols[index+code-first], nil
+		}
+		index += d.count[l]
+		first = (first + d.count[l]) << 1
+		code <<= 1
+	}
+	return 0, fmt.Errorf("invalid huffman code")
+}
+
+// bitPacker 按 MSB 优先把位追加到 buf。位先从高位开始累积在 64 位的 acc 中，攒满一个字后一次写出 8 字节。
+type bitPacker struct {
+	buf []byte
+	acc uint64
+	n   uint // acc 中已有的位数，始终小于 64
+}
+
+// write 写入 v 的低 n 位 (n <= 32)，v 的其余位必须为 0
+func (b *bitPacker) write(v uint32, n uint) {
+	free := 64 - b.n
+	if n < free {
+		b.acc |= uint64(v) << (free - n)
+		b.n += n
+		return
+	}
+	// 填满当前字并写出，剩下的位留在新的字中
+	rest := n - free
+	b.acc |= uint64(v) >> rest
+	b.buf = binary.BigEndian.AppendUint64(b.buf, b.acc)
+	b.acc = uint64(v) << (64 - rest)
+	b.n = rest
+}
+
+// writeCode 写入 packCodes 打包的编码
+func (b *bitPacker) writeCode(c uint32) {
+	b.write(c>>8, uint(c&0xFF))
+}
+
+// writeBytes 用 packCodes 打包的编码表逐字节编码 data。与逐个调用 writeCode 的结果相同，
+// 但累积器保存在局部变量中，是 Huffman 编码的热点循环。
+func (b *bitPacker) writeBytes(codes *[256]uint32, data []byte) {
+	acc, n, buf := b.acc, b.n, b.buf
+	for _, c := range data {
+		code := codes[c]
+		v, l := uint64(code>>8), uint(code&0xFF)
+		if free := 64 - n; l < free {
+			acc |= v << (free - l)
+			n += l
+			continue
+		}
+		rest := l - (64 - n)
+		buf = binary.BigEndian.AppendUint64(buf, acc|v>>rest)
+		acc = v << (64 - rest)
+		n = rest
+	}
+	b.acc, b.n, b.buf = acc, n, buf
+}
+
+// flush 用 0 补齐最后一个字节并返回全部数据
+func (b *bitPacker) flush() []byte {
+	for b.n > 0 {
+		b.buf = append(b.buf, byte(b.acc>>56))
+		b.acc <<= 8
+		b.n -= min(b.n, 8)
+	}
+	return b.buf
+}
+
+// bitUnpacker 按 MSB 优先读取 bitPacker 写入的位
+type bitUnpacker struct {
+	data []byte
+	pos  int
+	acc  uint64
+	n    uint // acc 低位中尚未读取的位数
+}
+
+// fill 尽量把 acc 填满
+func (b *bitUnpacker) fill() {
+	for b.n <= 56 && b.pos < len(b.data) {
+		b.acc = b.acc<<8 | uint64(b.data[b.pos])
+		b.pos++
+		b.n += 8
+	}
+}
+
+// peek 返回接下来的 n 位 (n <= 32) 而不移动位置，数据不足时以 0 补齐
+func (b *bitUnpacker) peek(n uint) uint32 {
+	if b.n < n {
+		b.fill()
+		if b.n < n {
+			return uint32(b.acc<<(n-b.n)) & (1<<n - 1)
+		}
+	}
+	return uint32(b.acc>>(b.n-n)) & (1<<n - 1)
+}
+
+// skip 跳过 peek 看到的 n 位
+func (b *bitUnpacker) skip(n uint) error {
+	if b.n < n {
+		return io.ErrUnexpectedEOF
+	}
+	b.n -= n
+	return nil
+}
+
+// read 读取 n 位 (n <= 32)
+func (b *bitUnpacker) read(n uint) (uint32, error) {
+	if b.n < n {
+		b.fill()
+		if b.n < n {
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+	b.n -= n
+	return uint32(b.acc>>b.n) & (1<<n - 1), nil
+}
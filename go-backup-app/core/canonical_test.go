@@ -0,0 +1,98 @@
+package core
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHuffmanCodeLengths_Limit(t *testing.T) {
+	// 斐波那契频率会生成最深的树
+	freqs := make([]int64, 40)
+	a, b := int64(1), int64(1)
+	for i := range freqs {
+		freqs[i] = a
+		a, b = b, a+b
+	}
+	lengths := huffmanCodeLengths(freqs, maxCodeLen)
+	kraft := 0
+	for _, l := range lengths {
+		require.NotZero(t, l)
+		require.LessOrEqual(t, int(l), maxCodeLen)
+		kraft += 1 << (maxCodeLen - l)
+	}
+	require.LessOrEqual(t, kraft, 1<<maxCodeLen)
+
+	_, err := newHuffmanDecoder(lengths)
+	require.NoError(t, err)
+	_, err = newHuffmanDecoder([]uint8{1, 1, 1})
+	require.Error(t, err)
+}
+
+func TestHuffmanDecoder_TableMatchesSlowPath(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	for round := 0; round < 20; round++ {
+		// 指数分布的频率会同时产生短于和长于 huffmanTableBits 的编码
+		freqs := make([]int64, 1+rng.Intn(300))
+		for i := range freqs {
+			if rng.Intn(4) > 0 {
+				freqs[i] = 1 + int64(rng.ExpFloat64()*float64(int64(1)<<rng.Intn(20)))
+			}
+		}
+		lengths := huffmanCodeLengths(freqs, maxCodeLen)
+		codes := canonicalCodes(lengths)
+
+		var symbols []int
+		bw := bitPacker{}
+		for i := 0; i < 2000; i++ {
+			s := rng.Intn(len(freqs))
+			if lengths[s] == 0 {
+				continue
+			}
+			symbols = append(symbols, s)
+			bw.write(codes[s], uint(lengths[s]))
+		}
+		data := bw.flush()
+
+		dec, err := newHuffmanDecoder(lengths)
+		require.NoError(t, err)
+		fast := bitUnpacker{data: data}
+		slow := bitUnpacker{data: data}
+		for _, want := range symbols {
+			got, err := dec.decode(&fast)
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+			got, err = dec.decodeSlow(&slow)
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+		}
+	}
+}
+
+func TestBitPacker_RoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	type field struct {
+		v uint32
+		n uint
+	}
+	var fields []field
+	bw := bitPacker{}
+	for i := 0; i < 5000; i++ {
+		n := uint(rng.Intn(33))
+		v := rng.Uint32() & (1<<n - 1)
+		fields = append(fields, field{v, n})
+		bw.write(v, n)
+	}
+	br := bitUnpacker{data: bw.flush()}
+	for _, f := range fields {
+		if f.n > 0 {
+			require.Equal(t, f.v>>(f.n-min(f.n, 3)), br.peek(min(f.n, 3)))
+		}
+		got, err := br.read(f.n)
+		require.NoError(t, err)
+		require.Equal(t, f.v, got)
+	}
+	_, err := br.read(8)
+	require.Error(t, err)
+}
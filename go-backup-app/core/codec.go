@@ -0,0 +1,256 @@
+package core
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Codec 是备份流的压缩方式。压缩流以 codecMagic 和 1 字节的编解码器 ID 开头，之后的数据由编解码器自行定义；
+// 旧版本的 Huffman 流直接以 "HUFF" 开头，没有 ID，仍然可以读取。
+// ID 和名称都会被持久化 (ID 写入备份文件，名称保存在任务配置中)，注册后不能再改变。
+type Codec interface {
+	ID() byte
+	Name() string
+	// NewWriter 返回压缩后写入 w 的 writer，Close 时同时关闭 w。流头由调用方写入。
+	NewWriter(w io.WriteCloser) io.WriteCloser
+	// NewReader 顺序解压流头之后的数据
+	NewReader(r io.Reader) (io.ReadCloser, error)
+	// NewReaderAt 随机访问流头之后的数据 (长度为 size)，返回解压后的数据及其长度
+	NewReaderAt(r io.ReaderAt, size int64) (io.ReaderAt, int64, error)
+}
+
+// salvageCodec 是支持抢救恢复的编解码器: 跳过无法解压的数据而不是报错，跳过的部分通过 onLoss 报告
+type salvageCodec interface {
+	newSalvageReader(r io.Reader, onLoss func(offset, skipped int64, reason string)) io.ReadCloser
+}
+
+// storeSwitcher 是可以按条目跳过压缩的压缩层: setStored(true) 之后写入的数据按原样保存，
+// 读取时不需要知道切换的位置 (见 CompressionPolicy)
+type storeSwitcher interface {
+	setStored(stored bool) error
+}
+
+// 内置编解码器的名称
+const (
+	CodecStore   = "store"   // 不压缩
+	CodecHuffman = "huffman" // 按 256 KB 分块的 Huffman 编码，压缩率低但不依赖数据中的重复
+	CodecDeflate = "deflate" // 按 256 KB 分块的 DEFLATE (compress/flate)，适合文本和源代码
+	CodecLZH     = "lzh"     // 按 256 KB 分块的 LZ77 + Huffman (见 lz77.go)，适合日志、JSON 等重复较多的数据
+)
+
+var codecMagic = []byte("QCDC")
+
+var ErrUnknownCodec = errors.New("unknown compression codec")
+
+var (
+	codecMu      sync.RWMutex
+	codecsByName = make(map[string]Codec)
+	codecsByID   = make(map[byte]Codec)
+)
+
+func init() {
+	RegisterCodec(storeCodec{})
+	RegisterCodec(&chunkCodec{id: 1, name: CodecHuffman, compress: compressChunk, decompress: decompressChunk, entropyLimit: huffmanEntropyLimit})
+	RegisterCodec(&chunkCodec{id: 2, name: CodecDeflate, compress: compressDeflateChunk, decompress: decompressDeflateChunk})
+	RegisterCodec(&chunkCodec{id: 3, name: CodecLZH, compress: compressLZChunk, decompress: decompressLZChunk})
+}
+
+// RegisterCodec 注册编解码器；ID 或名称重复时 panic
+func RegisterCodec(c Codec) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	if _, dup := codecsByName[c.Name()]; dup {
+		panic(fmt.Sprintf("core: codec %q registered twice", c.Name()))
+	}
+	if other, dup := codecsByID[c.ID()]; dup {
+		panic(fmt.Sprintf("core: codec %q uses the id %d of %q", c.Name(), c.ID(), other.Name()))
+	}
+	codecsByName[c.Name()] = c
+	codecsByID[c.ID()] = c
+}
+
+// CodecByName 返回已注册的编解码器，空名称等同于 CodecStore
+func CodecByName(name string) (Codec, error) {
+	if name == "" {
+		name = CodecStore
+	}
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	c, ok := codecsByName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, name)
+	}
+	return c, nil
+}
+
+// Codecs 返回所有已注册编解码器的名称，按 ID 排序
+func Codecs() []string {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	ids := make([]int, 0, len(codecsByID))
+	for id := range codecsByID {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = codecsByID[byte(id)].Name()
+	}
+	return names
+}
+
+func codecByID(id byte) (Codec, error) {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	c, ok := codecsByID[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: id %d", ErrUnknownCodec, id)
+	}
+	return c, nil
+}
+
+// codecHeaderLen 是 codecMagic 加上 ID 的长度
+const codecHeaderLen = 5
+
+// newCodecWriter 写入流头并返回 c 的压缩 writer
+func newCodecWriter(w io.WriteCloser, c Codec) (io.WriteCloser, error) {
+	header := append(append(make([]byte, 0, codecHeaderLen), codecMagic...), c.ID())
+	if _, err := w.Write(header); err != nil {
+		return nil, fmt.Errorf("failed to write codec header: %w", err)
+	}
+	return c.NewWriter(w), nil
+}
+
+// detectCodec 识别数据开头的压缩流头，返回编解码器和流头的长度；不是压缩流时返回 nil。
+// 旧版本的 Huffman 流以 "HUFF" 开头，它之后的分块与 huffman 编解码器相同。
+func detectCodec(head []byte) (Codec, int, error) {
+	switch {
+	case bytes.HasPrefix(head, huffmanMagic):
+		c, err := CodecByName(CodecHuffman)
+		return c, len(huffmanMagic), err
+	case bytes.HasPrefix(head, codecMagic) && len(head) >= codecHeaderLen:
+		c, err := codecByID(head[len(codecMagic)])
+		return c, codecHeaderLen, err
+	}
+	return nil, 0, nil
+}
+
+// newCodecReaderAt 返回压缩流 (包括长度为 headerLen 的流头) 解压后的随机访问视图
+func newCodecReaderAt(c Codec, headerLen int, r io.ReaderAt, size int64) (io.ReaderAt, int64, error) {
+	if headerLen == len(huffmanMagic) {
+		// 旧版本 Huffman 流的块索引偏移从 "HUFF" 开始计算
+		hr, err := newHuffmanReaderAt(r, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return hr, hr.Size(), nil
+	}
+	body := size - int64(headerLen)
+	return c.NewReaderAt(io.NewSectionReader(r, int64(headerLen), body), body)
+}
+
+// storeCodec 不压缩。备份时不添加压缩层，也不写流头，输出与旧版本不压缩的备份相同。
+type storeCodec struct{}
+
+func (storeCodec) ID() byte                                     { return 0 }
+func (storeCodec) Name() string                                 { return CodecStore }
+func (storeCodec) NewWriter(w io.WriteCloser) io.WriteCloser    { return w }
+func (storeCodec) NewReader(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil }
+
+func (storeCodec) NewReaderAt(r io.ReaderAt, size int64) (io.ReaderAt, int64, error) {
+	return r, size, nil
+}
+
+// chunkCodec 使用 HCHK 分块格式 (见 huffman.go): 数据按 huffmanChunkSize 分块并行压缩，
+// 每个块以 uint64 原始长度开头，流末尾的块索引用于随机访问。无法压缩的块按原样保存。
+type chunkCodec struct {
+	id         byte
+	name       string
+	compress   func([]byte) ([]byte, error)
+	decompress func([]byte) ([]byte, error)
+	// entropyLimit 大于 0 时跳过零阶熵过高的块。只适用于零阶编码:
+	// 字典压缩能利用重复的数据，熵很高的块也可能被压缩。
+	entropyLimit float64
+}
+
+func (c *chunkCodec) ID() byte     { return c.id }
+func (c *chunkCodec) Name() string { return c.name }
+
+func (c *chunkCodec) NewWriter(w io.WriteCloser) io.WriteCloser {
+	return newChunkWriter(w, nil, c.compress, c.entropyLimit)
+}
+
+func (c *chunkCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return newChunkReader(r, c.decompress), nil
+}
+
+func (c *chunkCodec) NewReaderAt(r io.ReaderAt, size int64) (io.ReaderAt, int64, error) {
+	hr, err := newChunkReaderAt(r, size, 0, c.decompress)
+	if err != nil {
+		return nil, 0, err
+	}
+	return hr, hr.Size(), nil
+}
+
+func (c *chunkCodec) newSalvageReader(r io.Reader, onLoss func(offset, skipped int64, reason string)) io.ReadCloser {
+	return newSalvageChunkReader(r, 0, c.decompress, onLoss)
+}
+
+// --- DEFLATE ---
+
+var flateWriterPool = sync.Pool{New: func() any {
+	fw, _ := flate.NewWriter(nil, flate.DefaultCompression)
+	return fw
+}}
+
+// compressDeflateChunk 压缩单个块: uint64 原始长度 + DEFLATE 数据
+func compressDeflateChunk(originalData []byte) ([]byte, error) {
+	if len(originalData) == 0 {
+		return []byte{}, nil
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(originalData)/2 + 64)
+	_ = binary.Write(&buf, binary.BigEndian, uint64(len(originalData)))
+
+	fw := flateWriterPool.Get().(*flate.Writer)
+	defer flateWriterPool.Put(fw)
+	fw.Reset(&buf)
+	if _, err := fw.Write(originalData); err != nil {
+		return nil, err
+	}
+	if err := fw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompressDeflateChunk(chunkData []byte) ([]byte, error) {
+	if len(chunkData) < 8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	originalLen := binary.BigEndian.Uint64(chunkData)
+	if originalLen == 0 {
+		return []byte{}, nil
+	}
+	if originalLen > uint64(huffmanChunkSize) {
+		return nil, fmt.Errorf("invalid deflate original length: %d", originalLen)
+	}
+
+	fr := flate.NewReader(bytes.NewReader(chunkData[8:]))
+	defer fr.Close()
+	out := make([]byte, originalLen)
+	if _, err := io.ReadFull(fr, out); err != nil {
+		return nil, fmt.Errorf("failed to inflate chunk: %w", err)
+	}
+	// 数据必须正好在原始长度处结束
+	if n, err := fr.Read(make([]byte, 1)); n > 0 || err != io.EOF {
+		return nil, fmt.Errorf("deflate chunk longer than its original length")
+	}
+	return out, nil
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecs_Registered(t *testing.T) {
+	require.Equal(t, []string{CodecStore, CodecHuffman, CodecDeflate, CodecLZH}, Codecs())
+
+	c, err := CodecByName("")
+	require.NoError(t, err)
+	require.Equal(t, CodecStore, c.Name())
+
+	_, err = CodecByName("zstd")
+	require.ErrorIs(t, err, ErrUnknownCodec)
+	require.Panics(t, func() { RegisterCodec(storeCodec{}) })
+}
+
+func TestCodecs_BackupRestore(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "src"), 0755))
+
+	var text strings.Builder
+	for i := 0; text.Len() < 2*huffmanChunkSize; i++ {
+		text.WriteString("func handler" + strings.Repeat("x", i%7) + "(w http.ResponseWriter, r *http.Request) {\n\treturn\n}\n")
+	}
+	random := make([]byte, huffmanChunkSize+77)
+	rand.New(rand.NewSource(2)).Read(random)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "src", "main.go"), []byte(text.String()), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "random.bin"), random, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "empty.txt"), nil, 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	sizes := make(map[string]int64)
+	for _, codec := range Codecs() {
+		for _, encrypt := range []bool{false, true} {
+			backupFile := filepath.Join(tempDir, codec+boolName(encrypt)+".qbak")
+			require.NoError(t, manager.Backup([]string{srcDir}, backupFile, FilterConfig{MaxSize: -1}, codec, encrypt, AlgoChaCha20, "pw"))
+			if !encrypt {
+				info, err := os.Stat(backupFile)
+				require.NoError(t, err)
+				sizes[codec] = info.Size()
+			}
+
+			restoreDir := filepath.Join(tempDir, "restore-"+codec+boolName(encrypt))
+			require.NoError(t, manager.Restore(backupFile, restoreDir, "pw"), codec)
+			data, err := os.ReadFile(filepath.Join(restoreDir, "src", "main.go"))
+			require.NoError(t, err)
+			require.Equal(t, text.String(), string(data))
+			data, err = os.ReadFile(filepath.Join(restoreDir, "random.bin"))
+			require.NoError(t, err)
+			require.True(t, bytes.Equal(random, data))
+
+			var buf bytes.Buffer
+			require.NoError(t, manager.ExtractFile(backupFile, "random.bin", "pw", &buf), codec)
+			require.True(t, bytes.Equal(random, buf.Bytes()))
+		}
+	}
+	require.Less(t, sizes[CodecDeflate], sizes[CodecHuffman])
+	require.Less(t, sizes[CodecHuffman], sizes[CodecStore])
+}
+
+func TestCodecs_LegacyHuffmanStream(t *testing.T) {
+	tempDir := t.TempDir()
+	backupFile := filepath.Join(tempDir, "legacy.qbak")
+
+	// 旧版本的压缩备份直接以 "HUFF" 开头
+	archive := writeCraftedArchive(t, []FileMetadata{
+		{Path: "a.txt", Mode: 0644},
+		{Path: "b.txt", Mode: 0644},
+	}, map[string]string{"a.txt": "alpha", "b.txt": strings.Repeat("bravo", 1000)})
+	out, err := os.Create(backupFile)
+	require.NoError(t, err)
+	cw := NewCompressedWriter(out)
+	_, err = cw.Write(archive)
+	require.NoError(t, err)
+	require.NoError(t, cw.Close())
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	require.NoError(t, manager.Restore(backupFile, restoreDir, ""))
+	data, err := os.ReadFile(filepath.Join(restoreDir, "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "alpha", string(data))
+
+	var buf bytes.Buffer
+	require.NoError(t, manager.ExtractFile(backupFile, "b.txt", "", &buf))
+	require.Equal(t, strings.Repeat("bravo", 1000), buf.String())
+}
+
+func TestCodecs_UnknownID(t *testing.T) {
+	tempDir := t.TempDir()
+	srcFile := filepath.Join(tempDir, "a.txt")
+	require.NoError(t, os.WriteFile(srcFile, []byte("a"), 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	err := manager.Backup([]string{srcFile}, filepath.Join(tempDir, "out.qbak"), FilterConfig{MaxSize: -1}, "zstd", false, 0, "")
+	require.ErrorIs(t, err, ErrUnknownCodec)
+
+	// 由更新版本写入、本版本不认识的编解码器
+	backupFile := filepath.Join(tempDir, "future.qbak")
+	require.NoError(t, os.WriteFile(backupFile, append(append([]byte{}, codecMagic...), 0xEE, 1, 2, 3), 0644))
+	err = manager.Restore(backupFile, filepath.Join(tempDir, "restore"), "")
+	require.ErrorIs(t, err, ErrUnknownCodec)
+	err = manager.ExtractFile(backupFile, "a.txt", "", &bytes.Buffer{})
+	require.ErrorIs(t, err, ErrUnknownCodec)
+}
+
+func TestSalvageRestore_DamagedDeflateChunk(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	contents := writeSalvageSource(t, srcDir, 200*1024)
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	backupFile := filepath.Join(tempDir, "deflate.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, FilterConfig{MaxSize: -1}, CodecDeflate, false, 0, ""))
+
+	raw, err := os.ReadFile(backupFile)
+	require.NoError(t, err)
+	// 破坏第二个块的 DEFLATE 数据
+	pos := 0
+	for i := 0; i < 2; i++ {
+		next := bytes.Index(raw[pos:], chunkMagic)
+		require.GreaterOrEqual(t, next, 0)
+		pos += next + len(chunkMagic)
+	}
+	copy(raw[pos+4+8:], bytes.Repeat([]byte{0xFF}, 64))
+	require.NoError(t, os.WriteFile(backupFile, raw, 0644))
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	report, err := manager.SalvageRestore(backupFile, restoreDir, "", RestoreOptions{})
+	require.NoError(t, err)
+	lost := checkSalvage(t, report, restoreDir, contents)
+	require.NotEmpty(t, lost)
+	require.Contains(t, report.Recovered, "alpha.txt")
+	require.Greater(t, report.SkippedBytes, int64(0))
+}
@@ -0,0 +1,103 @@
+// core/compression_policy.go
+package core
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// CompressionPolicy 决定哪些文件按原样保存而不经过压缩。已经压缩过的格式 (图片、视频、压缩包)
+// 几乎无法再压缩，跳过它们可以节省压缩 worker 的 CPU；其余文件仍使用备份选择的编解码器。
+// 同一个备份中可以同时包含压缩和未压缩的条目，每个条目使用的方式记录在 FileMetadata.Compression 中。
+type CompressionPolicy struct {
+	// StoreExtensions 中的扩展名按原样保存，不区分大小写，例如 ".jpg"
+	StoreExtensions []string `json:"storeExtensions"`
+	// StoreTypes 按文件开头的内容识别类型 (http.DetectContentType 返回的 MIME 类型，不含参数)，
+	// 匹配的文件按原样保存，用于识别扩展名不可靠的文件
+	StoreTypes []string `json:"storeTypes"`
+}
+
+// DefaultStoreExtensions 是默认按原样保存的扩展名
+var DefaultStoreExtensions = []string{
+	".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic", ".avif",
+	".mp3", ".aac", ".m4a", ".ogg", ".opus", ".flac",
+	".mp4", ".m4v", ".mov", ".mkv", ".webm", ".avi",
+	".zip", ".gz", ".tgz", ".bz2", ".xz", ".zst", ".7z", ".rar",
+	".jar", ".apk", ".docx", ".xlsx", ".pptx", ".woff2",
+}
+
+// DefaultStoreTypes 是默认按原样保存的内容类型
+var DefaultStoreTypes = []string{
+	"image/jpeg", "image/png", "image/gif", "image/webp",
+	"audio/mpeg", "application/ogg", "video/mp4", "video/webm",
+	"application/zip", "application/x-gzip", "application/x-rar-compressed", "font/woff2",
+}
+
+// DefaultCompressionPolicy 返回使用默认列表的策略
+func DefaultCompressionPolicy() *CompressionPolicy {
+	return &CompressionPolicy{
+		StoreExtensions: append([]string(nil), DefaultStoreExtensions...),
+		StoreTypes:      append([]string(nil), DefaultStoreTypes...),
+	}
+}
+
+const (
+	// compressionPolicyMinSize 以下的文件总是使用备份的编解码器: 省下的 CPU 很少，
+	// 而每次切换压缩方式都会提前结束当前的压缩块
+	compressionPolicyMinSize = 16 * 1024
+	// sniffLen 是识别内容类型时读取的字节数，与 http.DetectContentType 一致
+	sniffLen = 512
+)
+
+// stores 判断文件是否应该按原样保存；readHead 只在需要按内容识别时调用，返回文件开头的数据
+func (p *CompressionPolicy) stores(name string, readHead func() []byte) bool {
+	if ext := path.Ext(name); ext != "" {
+		for _, e := range p.StoreExtensions {
+			if strings.EqualFold(ext, e) {
+				return true
+			}
+		}
+	}
+	if len(p.StoreTypes) == 0 || readHead == nil {
+		return false
+	}
+	head := readHead()
+	if len(head) == 0 {
+		return false
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	for _, t := range p.StoreTypes {
+		if strings.EqualFold(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// entryCompression 返回条目数据使用的压缩方式: 按 m.CompressionPolicy (为 nil 时使用默认策略)
+// 应该按原样保存时为 CodecStore，否则为备份的编解码器名称
+func (m *BackupManager) entryCompression(codec string, meta *FileMetadata, readHead func() []byte) string {
+	if codec == "" || codec == CodecStore {
+		return CodecStore
+	}
+	if meta.payloadSize() < compressionPolicyMinSize {
+		return codec
+	}
+	policy := m.CompressionPolicy
+	if policy == nil {
+		policy = DefaultCompressionPolicy()
+	}
+	if policy.stores(meta.Path, readHead) {
+		return CodecStore
+	}
+	return codec
+}
+
+// readFileHead 读取文件开头用于识别内容类型的数据，不改变文件的读取位置
+func readFileHead(f *os.File) []byte {
+	head := make([]byte, sniffLen)
+	n, _ := f.ReadAt(head, 0)
+	return head[:n]
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionPolicy_Stores(t *testing.T) {
+	policy := &CompressionPolicy{StoreExtensions: DefaultStoreExtensions, StoreTypes: DefaultStoreTypes}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte("hello"))
+	require.NoError(t, zw.Close())
+	head := func(data []byte) func() []byte { return func() []byte { return data } }
+
+	require.True(t, policy.stores("photos/IMG_0001.JPG", nil))
+	require.True(t, policy.stores("archive.tar.gz", nil))
+	require.False(t, policy.stores("notes.txt", head([]byte("plain text"))))
+	require.False(t, policy.stores("jpg", nil), "a bare name is not an extension")
+
+	// 扩展名不可靠时按内容识别
+	require.True(t, policy.stores("download", head(gz.Bytes())))
+	require.True(t, policy.stores("cover.bin", head([]byte("\xFF\xD8\xFF\xE0\x00\x10JFIF\x00"))))
+	require.False(t, policy.stores("download", head(nil)))
+
+	empty := &CompressionPolicy{}
+	require.False(t, empty.stores("photo.jpg", head(gz.Bytes())))
+}
+
+// readEntryMetas 顺序读取备份中所有非内部条目的头部
+func readEntryMetas(t *testing.T, manager *BackupManager, backupFile string) map[string]*FileMetadata {
+	reader, err := manager.getReaderPipe(backupFile, "")
+	require.NoError(t, err)
+	defer reader.Close()
+	ar := NewArchiveReader(reader)
+	metas := make(map[string]*FileMetadata)
+	for {
+		meta, err := ar.NextEntry()
+		if err == io.EOF {
+			return metas
+		}
+		require.NoError(t, err)
+		require.NoError(t, ar.SkipEntry(meta))
+		if !isInternalPath(meta.Path) {
+			metas[meta.Path] = meta
+		}
+	}
+}
+
+func TestCompressionPolicy_MixedArchive(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+
+	// 内容都可以压缩，只有策略决定是否按原样保存
+	text := strings.Repeat("INFO request served in 12ms status=200 path=/api/v1/items\n", 6000)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte(text))
+	require.NoError(t, zw.Close())
+	noise := make([]byte, 64*1024)
+	rand.New(rand.NewSource(5)).Read(noise)
+	files := map[string]string{
+		"app.log":      text,
+		"photo.JPG":    text,                               // 按扩展名
+		"download":     string(gz.Bytes()) + string(noise), // 按内容类型
+		"small.png":    text[:1000],                        // 太小，仍然压缩
+		"sub/data.csv": text[:100000],
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(srcDir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), []byte(content), 0644))
+	}
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	mixedFile := filepath.Join(tempDir, "mixed.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, mixedFile, FilterConfig{MaxSize: -1}, CodecLZH, false, 0, ""))
+
+	metas := readEntryMetas(t, manager, mixedFile)
+	require.Equal(t, CodecLZH, metas["app.log"].Compression)
+	require.Equal(t, CodecStore, metas["photo.JPG"].Compression)
+	require.Equal(t, CodecStore, metas["download"].Compression)
+	require.Equal(t, CodecLZH, metas["small.png"].Compression)
+	require.Equal(t, CodecLZH, metas["sub/data.csv"].Compression)
+	require.Empty(t, metas["sub"].Compression, "entries without data keep the stream codec")
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	require.NoError(t, manager.Restore(mixedFile, restoreDir, ""))
+	for name, content := range files {
+		data, err := os.ReadFile(filepath.Join(restoreDir, name))
+		require.NoError(t, err)
+		require.True(t, content == string(data), name)
+
+		var buf bytes.Buffer
+		require.NoError(t, manager.ExtractFile(mixedFile, name, "", &buf), name)
+		require.True(t, content == buf.String(), name)
+	}
+
+	// 关闭策略后所有文件都被压缩，备份更小
+	manager.CompressionPolicy = &CompressionPolicy{}
+	allFile := filepath.Join(tempDir, "all.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, allFile, FilterConfig{MaxSize: -1}, CodecLZH, false, 0, ""))
+	require.Equal(t, CodecLZH, readEntryMetas(t, manager, allFile)["photo.JPG"].Compression)
+	mixedInfo, err := os.Stat(mixedFile)
+	require.NoError(t, err)
+	allInfo, err := os.Stat(allFile)
+	require.NoError(t, err)
+	require.Greater(t, mixedInfo.Size(), allInfo.Size()+int64(len(text))/2)
+
+	// 不压缩的备份中每个条目都是 store
+	storeFile := filepath.Join(tempDir, "store.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, storeFile, FilterConfig{MaxSize: -1}, CodecStore, false, 0, ""))
+	require.Equal(t, CodecStore, readEntryMetas(t, manager, storeFile)["app.log"].Compression)
+}
+
+func TestCompressionPolicy_SwitchKeepsChunksSeparate(t *testing.T) {
+	var out bytes.Buffer
+	hw := newChunkWriter(nopWriteCloser{&out}, nil, compressChunk, 0)
+	text := bytes.Repeat([]byte("compressible "), 1000)
+	_, err := hw.Write(text)
+	require.NoError(t, err)
+	require.NoError(t, hw.setStored(true))
+	_, err = hw.Write(text)
+	require.NoError(t, err)
+	require.NoError(t, hw.setStored(false))
+	_, err = hw.Write(text)
+	require.NoError(t, err)
+	require.NoError(t, hw.Close())
+
+	chunks, err := readChunkIndex(bytes.NewReader(out.Bytes()), int64(out.Len()), 0)
+	require.NoError(t, err)
+	require.Len(t, chunks, 3)
+	var flags []bool
+	for _, c := range chunks {
+		require.Equal(t, int64(len(text)), c.rawLen)
+		header := out.Bytes()[c.dataOffset : c.dataOffset+8]
+		flags = append(flags, header[0]&byte(chunkFlagStored>>56) != 0)
+	}
+	require.Equal(t, []bool{false, true, false}, flags)
+
+	r := newChunkReader(bytes.NewReader(out.Bytes()), decompressChunk)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, bytes.Repeat(text, 3), data)
+}
+
+func TestCompressionPolicy_EmptyCompressionUsesStreamCodec(t *testing.T) {
+	var out bytes.Buffer
+	hw := newChunkWriter(nopWriteCloser{&out}, nil, compressChunk, 0)
+	aw := NewArchiveWriter(hw)
+	buffer := make([]byte, copyBufferSize)
+	data := bytes.Repeat([]byte("compressible "), 2000)
+	require.NoError(t, aw.WriteEntry(FileMetadata{Path: "photo.jpg", Size: int64(len(data)), Mode: 0644, HasCRC: true, Compression: CodecStore}, bytes.NewReader(data), buffer, nil))
+	require.NoError(t, aw.WriteEntry(FileMetadata{Path: "sub", Mode: os.ModeDir | 0755, IsDir: true}, nil, buffer, nil))
+	require.NoError(t, aw.WriteEntry(FileMetadata{Path: "sub/copy.jpg", Mode: 0644, HasCRC: true, HardLink: "photo.jpg"}, nil, buffer, nil))
+	require.NoError(t, aw.WriteEntry(FileMetadata{Path: "sub/notes.txt", Size: int64(len(data)), Mode: 0644, HasCRC: true}, bytes.NewReader(data), buffer, nil))
+	require.NoError(t, aw.WriteIndex())
+	require.NoError(t, hw.Close())
+
+	chunks, err := readChunkIndex(bytes.NewReader(out.Bytes()), int64(out.Len()), 0)
+	require.NoError(t, err)
+	var flags []bool
+	for _, c := range chunks {
+		flags = append(flags, out.Bytes()[c.dataOffset]&byte(chunkFlagStored>>56) != 0)
+	}
+	// 归档魔术字、按原样保存的文件以及之后没有数据的目录和硬链接在同一个块中；压缩的文件和索引在第二个块中
+	require.Equal(t, []bool{true, false}, flags)
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// 普通文件的内容哈希是文件完整内容 (稀疏文件的空洞按零计算) 的 SHA-256，在写入条目数据的同时计算，
+// 作为条目的尾部跟在 CRC32 之后，并以十六进制保存在写在数据之后的清单中。
+// 与 CRC32 不同，它可以发现有意的篡改，也可以用来比较不同备份中的文件内容。
+
+// contentHasher 计算条目内容的 SHA-256；稀疏条目只写入数据段，空洞部分由 sparseExpander 补齐
+type contentHasher struct {
+	digest *digest
+	w      io.Writer
+	sparse *sparseExpander
+	size   int64
+}
+
+func newContentHasher(meta *FileMetadata) *contentHasher {
+	h := &contentHasher{digest: New(), size: meta.Size}
+	h.w = h.digest
+	if meta.Sparse {
+		h.sparse = &sparseExpander{w: h.digest, extents: meta.Extents}
+		h.w = h.sparse
+	}
+	return h
+}
+
+func (h *contentHasher) Write(p []byte) (int, error) {
+	return h.w.Write(p)
+}
+
+// sum 返回哈希值，稀疏条目会先补齐最后一个数据段之后的空洞
+func (h *contentHasher) sum() ([]byte, error) {
+	if h.sparse != nil {
+		if err := h.sparse.fillTo(h.size); err != nil {
+			return nil, err
+		}
+	}
+	return h.digest.Sum(nil), nil
+}
+
+// check 比较计算结果与条目记录的哈希
+func (h *contentHasher) check(meta *FileMetadata) error {
+	sum, err := h.sum()
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", meta.Path, err)
+	}
+	if hex.EncodeToString(sum) != meta.SHA256 {
+		return fmt.Errorf("%w for %s", ErrContentHashMismatch, meta.Path)
+	}
+	return nil
+}
+
+// contentHashes 收集并发写入的条目的内容哈希，所有数据写完之后填入清单
+type contentHashes struct {
+	mu     sync.Mutex
+	byPath map[string]string
+}
+
+func newContentHashes() *contentHashes {
+	return &contentHashes{byPath: make(map[string]string, 1024)}
+}
+
+// add 记录刚写入的条目的内容哈希
+func (h *contentHashes) add(meta *FileMetadata) {
+	if meta.SHA256 == "" {
+		return
+	}
+	h.mu.Lock()
+	h.byPath[meta.Path] = meta.SHA256
+	h.mu.Unlock()
+}
+
+// fill 把内容哈希填入清单。没有写入数据的文件保留原有的哈希 (增量备份中未变化的文件沿用父备份的哈希)，
+// 硬链接使用它指向的文件的哈希
+func (h *contentHashes) fill(files []ManifestFile) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := range files {
+		if sum, ok := h.byPath[files[i].Path]; ok && files[i].Mode.IsRegular() && files[i].HardLink == "" {
+			files[i].SHA256 = sum
+		}
+	}
+	sums := make(map[string]string, len(files))
+	for _, f := range files {
+		sums[f.Path] = f.SHA256
+	}
+	for i := range files {
+		if files[i].HardLink != "" {
+			files[i].SHA256 = sums[files[i].HardLink]
+		}
+	}
+}
+
+// warnIfChanged 在文件读取期间被修改 (大小或修改时间与打开前不同) 时记录警告。
+// 归档中保存的是实际读到的数据，内容哈希也按这些数据计算，因此备份本身仍然一致，只是可能不是文件的最终状态。
+func (m *BackupManager) warnIfChanged(f *os.File, before os.FileInfo, relPath string) {
+	after, err := f.Stat()
+	if err != nil || (after.Size() == before.Size() && after.ModTime().Equal(before.ModTime())) {
+		return
+	}
+	log.Printf("Warn: %s changed while it was being archived", relPath)
+	m.emitLog(fmt.Sprintf("文件在归档期间被修改: %s", relPath))
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Hex(data []byte) string {
+	sum := Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func manifestHashes(t *testing.T, manager *BackupManager, backupFile, password string) map[string]string {
+	t.Helper()
+	manifest, err := manager.readManifest(backupFile, password)
+	require.NoError(t, err)
+	hashes := make(map[string]string)
+	for _, f := range manifest.Files {
+		hashes[f.Path] = f.SHA256
+	}
+	return hashes
+}
+
+func TestContentHash_RecordedAndChecked(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0755))
+	a := bytes.Repeat([]byte("content hash "), 5000)
+	b := []byte("second file")
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "a.txt"), a, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "b.txt"), b, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "empty.txt"), nil, 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	filters := FilterConfig{MaxSize: -1}
+
+	baseFile := filepath.Join(tempDir, "base.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, baseFile, filters, CodecHuffman, true, AlgoAES256_CTR, "pw"))
+
+	hashes := manifestHashes(t, manager, baseFile, "pw")
+	require.Equal(t, sha256Hex(a), hashes["sub/a.txt"])
+	require.Equal(t, sha256Hex(b), hashes["b.txt"])
+	require.Equal(t, sha256Hex(nil), hashes["empty.txt"])
+	require.Empty(t, hashes["sub"])
+
+	// 增量备份: 变化的文件重新计算，未变化的文件沿用父备份的哈希
+	b2 := []byte("second file, changed")
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "b.txt"), b2, 0644))
+	incFile := filepath.Join(tempDir, "inc.qbak")
+	require.NoError(t, manager.BackupIncremental([]string{srcDir}, incFile, baseFile, filters, CodecHuffman, true, AlgoAES256_CTR, "pw"))
+	hashes = manifestHashes(t, manager, incFile, "pw")
+	require.Equal(t, sha256Hex(a), hashes["sub/a.txt"])
+	require.Equal(t, sha256Hex(b2), hashes["b.txt"])
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	require.NoError(t, manager.Restore(incFile, restoreDir, "pw"))
+	got, err := os.ReadFile(filepath.Join(restoreDir, "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, b2, got)
+
+	// 修改尾部中记录的哈希: CRC 仍然正确，但恢复和校验都应发现内容不符
+	plainFile := filepath.Join(tempDir, "plain.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, plainFile, filters, CodecStore, false, 0, ""))
+	raw, err := os.ReadFile(plainFile)
+	require.NoError(t, err)
+	sum := Sum256(a)
+	pos := bytes.Index(raw, sum[:])
+	require.Greater(t, pos, 0)
+	raw[pos] ^= 0xFF
+	require.NoError(t, os.WriteFile(plainFile, raw, 0644))
+
+	err = manager.Restore(plainFile, filepath.Join(tempDir, "tampered"), "")
+	require.ErrorIs(t, err, ErrContentHashMismatch)
+
+	var buf bytes.Buffer
+	require.ErrorIs(t, manager.ExtractFile(plainFile, "sub/a.txt", "", &buf), ErrContentHashMismatch)
+
+	report, err := manager.Verify(plainFile, "")
+	require.NoError(t, err)
+	kinds := []VerifyIssueKind{}
+	for _, issue := range report.Issues {
+		require.Equal(t, "sub/a.txt", issue.Path)
+		kinds = append(kinds, issue.Kind)
+	}
+	// 数据与尾部中的哈希不符，尾部中的哈希也与清单不符
+	require.Equal(t, []VerifyIssueKind{VerifyCorrupt, VerifyMismatch}, kinds)
+}
+
+func TestContentHash_WrittenWithData(t *testing.T) {
+	var buf bytes.Buffer
+	aw := NewArchiveWriter(&buf)
+	aw.hashFiles = true
+	buffer := make([]byte, copyBufferSize)
+	data := []byte("data")
+
+	meta := FileMetadata{Path: "f", Size: int64(len(data)), Mode: 0644, HasCRC: true}
+	require.NoError(t, aw.writeEntry(&meta, bytes.NewReader(data), buffer, nil))
+	require.Equal(t, sha256Hex(data), meta.SHA256)
+	link := FileMetadata{Path: "g", Mode: 0644, HasCRC: true, HardLink: "f"}
+	require.NoError(t, aw.writeEntry(&link, nil, buffer, nil))
+	require.Empty(t, link.SHA256)
+
+	// 读取数据之后才能得到尾部中的哈希，跳过数据时也一样
+	ar := NewArchiveReader(bytes.NewReader(buf.Bytes()))
+	got, err := ar.NextEntry()
+	require.NoError(t, err)
+	require.Empty(t, got.SHA256)
+	require.NoError(t, ar.SkipEntry(got))
+	require.Equal(t, sha256Hex(data), got.SHA256)
+}
+
+func TestContentHash_ChangedFileOnlyWarns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("line 1\n"), 0644))
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	before, err := f.Stat()
+	require.NoError(t, err)
+
+	var logs strings.Builder
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	manager.warnIfChanged(f, before, "app.log")
+	require.Empty(t, logs.String())
+
+	require.NoError(t, os.WriteFile(path, []byte("line 1\nline 2\n"), 0644))
+	manager.warnIfChanged(f, before, "app.log")
+	require.Contains(t, logs.String(), "app.log changed while it was being archived")
+}
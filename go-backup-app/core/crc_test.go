@@ -21,7 +21,7 @@ func TestBackupRestore_CRCDetectsCorruption(t *testing.T) {
 	manager.DisableEvents()
 
 	filters := FilterConfig{MaxSize: -1}
-	require.NoError(t, manager.Backup([]string{srcDir}, destFile, filters, false, false, 0, ""))
+	require.NoError(t, manager.Backup([]string{srcDir}, destFile, filters, CodecStore, false, 0, ""))
 
 	restoreDir := filepath.Join(tempDir, "restore")
 	require.NoError(t, os.MkdirAll(restoreDir, 0755))
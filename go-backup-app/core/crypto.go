@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"math/bits"
+	"os"
 	"runtime"
 	"sync"
 )
@@ -685,19 +686,22 @@ type parallelStreamWriter struct {
 	errLock   sync.Mutex
 }
 
-func newParallelStreamWriter(w io.Writer, algorithm uint8, key, nonce []byte) (*parallelStreamWriter, error) {
-	var newStreamFn func() (CipherStream, error)
-	var streamBlockSize int
-
+// newCipherStreamFn 返回按算法创建密码流的工厂函数以及该算法的块大小
+func newCipherStreamFn(algorithm uint8, key, nonce []byte) (func() (CipherStream, error), int, error) {
 	switch algorithm {
 	case AlgoAES256_CTR:
-		newStreamFn = func() (CipherStream, error) { return NewAESCTRStream(key, nonce) }
-		streamBlockSize = 16
+		return func() (CipherStream, error) { return NewAESCTRStream(key, nonce) }, 16, nil
 	case AlgoChaCha20:
-		newStreamFn = func() (CipherStream, error) { return NewChaCha20Stream(key, nonce) }
-		streamBlockSize = 64
+		return func() (CipherStream, error) { return NewChaCha20Stream(key, nonce) }, 64, nil
 	default:
-		return nil, fmt.Errorf("unsupported algorithm: %d", algorithm)
+		return nil, 0, fmt.Errorf("unsupported algorithm: %d", algorithm)
+	}
+}
+
+func newParallelStreamWriter(w io.Writer, algorithm uint8, key, nonce []byte) (*parallelStreamWriter, error) {
+	newStreamFn, streamBlockSize, err := newCipherStreamFn(algorithm, key, nonce)
+	if err != nil {
+		return nil, err
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -871,22 +875,13 @@ func (sw *parallelStreamWriter) getErr() error {
 
 // newParallelStreamReaderWithPipe 使用 io.Pipe 创建一个并行的解密 io.Reader
 func newParallelStreamReaderWithPipe(r io.Reader, algorithm uint8, key, nonce []byte) (io.ReadCloser, error) {
-	pr, pw := io.Pipe()
-
-	var newStreamFn func() (CipherStream, error)
-	var streamBlockSize int
-
-	switch algorithm {
-	case AlgoAES256_CTR:
-		newStreamFn = func() (CipherStream, error) { return NewAESCTRStream(key, nonce) }
-		streamBlockSize = 16
-	case AlgoChaCha20:
-		newStreamFn = func() (CipherStream, error) { return NewChaCha20Stream(key, nonce) }
-		streamBlockSize = 64
-	default:
-		return nil, fmt.Errorf("unsupported algorithm: %d", algorithm)
+	newStreamFn, streamBlockSize, err := newCipherStreamFn(algorithm, key, nonce)
+	if err != nil {
+		return nil, err
 	}
 
+	pr, pw := io.Pipe()
+
 	blockPerChunk := uint64(chunkSize / streamBlockSize)
 
 	go func() {
@@ -1065,23 +1060,151 @@ func NewEncryptedWriter(w io.Writer, password string, algorithm uint8) (io.Write
 	key := deriveKey(password, salt)
 	defer SecureZero(key) // Securely clear key from memory when done
 
-	var nonce []byte
-	var nonceSize int
+	size, err := nonceSize(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, size)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return writeEncryptedHeader(w, key, algorithm, salt, nonce)
+}
+
+// NewDeterministicEncryptedWriter 使用给定的 salt，nonce 由密钥和明文的 SHA-256 派生 (HMAC)，
+// 因此相同的密码、salt 和明文总是得到相同的密文，而不同的明文不会共用同一个密钥流。
+//
+// 文件头中的 nonce 必须写在密文之前，而它要等到读完全部明文才能确定，因此数据先写入临时目录中的暂存文件，
+// Close 时再加密写入 w。暂存的数据使用只保存在内存中的随机密钥加密，磁盘上不会留下明文；
+// 进程被终止时留下的暂存文件 (支持的系统上创建后立即删除) 也无法解密。
+// 代价是临时目录需要与备份大小相当的空间，且数据要多加密、解密一次。
+func NewDeterministicEncryptedWriter(w io.Writer, password string, algorithm uint8, salt []byte) (io.WriteCloser, error) {
+	if len(salt) == 0 || len(salt) > 255 {
+		return nil, fmt.Errorf("invalid salt length: %d", len(salt))
+	}
+	if password == "" {
+		return nil, errors.New("password cannot be empty for encryption")
+	}
+	size, err := nonceSize(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	spoolKey := make([]byte, 32)
+	spoolNonce := make([]byte, size)
+	if _, err := rand.Read(spoolKey); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(spoolNonce); err != nil {
+		return nil, err
+	}
+
+	spool, err := os.CreateTemp("", ".qbak-spool-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	// 打开的文件在 Unix 上删除之后仍可读写，进程退出时自动释放；Windows 上删除失败，留到 Close 时删除
+	removed := os.Remove(spool.Name()) == nil
+
+	// parallelStreamWriter 关闭时会关闭底层的 writer，暂存文件要在 Close 中读回，因此隐藏它的 Close
+	spoolWriter, err := newParallelStreamWriter(struct{ io.Writer }{spool}, algorithm, spoolKey, spoolNonce)
+	if err != nil {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+		return nil, err
+	}
+	return &deterministicWriter{
+		w:          w,
+		algorithm:  algorithm,
+		key:        deriveKey(password, salt),
+		salt:       append([]byte(nil), salt...),
+		spool:      spool,
+		removed:    removed,
+		spoolKey:   spoolKey,
+		spoolNonce: spoolNonce,
+		spoolW:     spoolWriter,
+		digest:     New(),
+	}, nil
+}
+
+// deterministicWriter 计算明文摘要并把明文加密暂存，Close 时派生 nonce、写入文件头并重新加密暂存的数据
+type deterministicWriter struct {
+	w          io.Writer
+	algorithm  uint8
+	key        []byte
+	salt       []byte
+	spool      *os.File
+	removed    bool // 暂存文件已经从目录中删除
+	spoolKey   []byte
+	spoolNonce []byte
+	spoolW     io.WriteCloser
+	digest     *digest
+	closeOnce  sync.Once
+	closeErr   error
+}
+
+func (dw *deterministicWriter) Write(p []byte) (int, error) {
+	dw.digest.Write(p)
+	return dw.spoolW.Write(p)
+}
+
+func (dw *deterministicWriter) Close() error {
+	dw.closeOnce.Do(func() {
+		defer func() {
+			_ = dw.spool.Close()
+			if !dw.removed {
+				_ = os.Remove(dw.spool.Name())
+			}
+			SecureZero(dw.key)
+			SecureZero(dw.spoolKey)
+		}()
+		dw.closeErr = dw.encryptSpool()
+	})
+	return dw.closeErr
+}
 
+func (dw *deterministicWriter) encryptSpool() error {
+	if err := dw.spoolW.Close(); err != nil {
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+	if _, err := dw.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	plain, err := newParallelStreamReaderWithPipe(dw.spool, dw.algorithm, dw.spoolKey, dw.spoolNonce)
+	if err != nil {
+		return err
+	}
+	defer plain.Close()
+
+	size, _ := nonceSize(dw.algorithm)
+	sum := dw.digest.checkSum()
+	nonce := prf(dw.key, append(append([]byte("qbak-nonce"), dw.salt...), sum[:]...))[:size]
+
+	sw, err := writeEncryptedHeader(dw.w, dw.key, dw.algorithm, dw.salt, nonce)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(sw, plain); err != nil {
+		_ = sw.Close()
+		return err
+	}
+	return sw.Close()
+}
+
+// nonceSize 返回算法使用的 nonce/IV 长度
+func nonceSize(algorithm uint8) (int, error) {
 	switch algorithm {
 	case AlgoAES256_CTR:
-		nonceSize = 16
+		return 16, nil
 	case AlgoChaCha20:
-		nonceSize = 12
+		return 12, nil
 	default:
-		return nil, fmt.Errorf("unsupported algorithm: %d", algorithm)
-	}
-
-	nonce = make([]byte, nonceSize)
-	if _, err := rand.Read(nonce); err != nil {
-		return nil, err
+		return 0, fmt.Errorf("unsupported algorithm: %d", algorithm)
 	}
+}
 
+// writeEncryptedHeader 写入文件头并返回加密后续数据的 writer；key 会被复制，调用方可以随后清除
+func writeEncryptedHeader(w io.Writer, key []byte, algorithm uint8, salt, nonce []byte) (io.WriteCloser, error) {
 	// 写入文件头
 	header := new(bytes.Buffer)
 	header.Write(magicHeader)
@@ -1109,7 +1232,16 @@ func NewEncryptedWriter(w io.Writer, password string, algorithm uint8) (io.Write
 
 // --- 解密读取器 ---
 
-func NewDecryptedReader(r io.Reader, password string) (io.ReadCloser, error) {
+// encryptionHeader 是解析并校验后的加密文件头
+type encryptionHeader struct {
+	algorithm uint8
+	key       []byte
+	nonce     []byte
+	size      int64 // 文件头占用的字节数，密文从该偏移开始
+}
+
+// readEncryptionHeader 读取加密文件头并派生密钥；版本 2 及以上会校验头部 MAC 以尽早发现错误密码
+func readEncryptionHeader(r io.Reader, password string) (*encryptionHeader, error) {
 	header := make([]byte, len(magicHeader))
 	if _, err := io.ReadFull(r, header); err != nil {
 		if err == io.EOF {
@@ -1157,6 +1289,8 @@ func NewDecryptedReader(r io.Reader, password string) (io.ReadCloser, error) {
 		return nil, err
 	}
 
+	headerSize := int64(len(magicHeader) + 2 + 1 + len(salt) + 1 + len(nonce))
+
 	key := deriveKey(password, salt)
 	defer SecureZero(key)
 
@@ -1165,6 +1299,7 @@ func NewDecryptedReader(r io.Reader, password string) (io.ReadCloser, error) {
 		if _, err := io.ReadFull(r, expectedMac); err != nil {
 			return nil, err
 		}
+		headerSize += sha256Size
 
 		hdr := new(bytes.Buffer)
 		hdr.Write(magicHeader)
@@ -1184,7 +1319,86 @@ func NewDecryptedReader(r io.Reader, password string) (io.ReadCloser, error) {
 	keyCopy := make([]byte, len(key))
 	copy(keyCopy, key)
 
-	return newParallelStreamReaderWithPipe(r, algoByte, keyCopy, nonce)
+	return &encryptionHeader{
+		algorithm: algoByte,
+		key:       keyCopy,
+		nonce:     nonce,
+		size:      headerSize,
+	}, nil
+}
+
+func NewDecryptedReader(r io.Reader, password string) (io.ReadCloser, error) {
+	header, err := readEncryptionHeader(r, password)
+	if err != nil {
+		return nil, err
+	}
+	return newParallelStreamReaderWithPipe(r, header.algorithm, header.key, header.nonce)
+}
+
+// --- 随机访问解密 ---
+
+// cipherReaderAt 在密文上提供随机访问：CTR/ChaCha20 的计数器可以直接定位到任意块，
+// 因此读取任意偏移只需解密目标范围，无需处理之前的数据。
+type cipherReaderAt struct {
+	r           io.ReaderAt
+	base        int64 // 密文在底层 ReaderAt 中的起始偏移
+	size        int64 // 密文长度
+	newStreamFn func() (CipherStream, error)
+	blockSize   int64
+}
+
+// newDecryptedReaderAt 解析 r 开头的加密文件头，返回明文的随机访问视图及其长度
+func newDecryptedReaderAt(r io.ReaderAt, size int64, password string) (*cipherReaderAt, error) {
+	header, err := readEncryptionHeader(io.NewSectionReader(r, 0, size), password)
+	if err != nil {
+		return nil, err
+	}
+
+	newStreamFn, blockSize, err := newCipherStreamFn(header.algorithm, header.key, header.nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &cipherReaderAt{
+		r:           r,
+		base:        header.size,
+		size:        size - header.size,
+		newStreamFn: newStreamFn,
+		blockSize:   int64(blockSize),
+	}, nil
+}
+
+func (c *cipherReaderAt) Size() int64 { return c.size }
+
+func (c *cipherReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("cipherReaderAt: negative offset %d", off)
+	}
+	if off >= c.size {
+		return 0, io.EOF
+	}
+	want := len(p)
+	if remaining := c.size - off; int64(want) > remaining {
+		want = int(remaining)
+	}
+
+	n, err := c.r.ReadAt(p[:want], c.base+off)
+	if n > 0 {
+		stream, streamErr := c.newStreamFn()
+		if streamErr != nil {
+			return 0, streamErr
+		}
+		// 写入端每个 chunk 的计数器为 id*chunkSize/blockSize，与按字节偏移计算的计数器一致
+		stream.SetCounter(uint64(off / c.blockSize))
+		if skip := off % c.blockSize; skip > 0 {
+			discard := make([]byte, skip)
+			stream.XORKeyStream(discard, discard)
+		}
+		stream.XORKeyStream(p[:n], p[:n])
+	}
+	if err == nil && want < len(p) {
+		err = io.EOF
+	}
+	return n, err
 }
 
 // --- 实用工具函数 ---
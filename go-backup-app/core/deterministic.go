@@ -0,0 +1,118 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 可复现模式 (BackupManager.Deterministic) 下，相同的源文件总是生成相同的备份:
+// 条目按路径顺序写入，清单中的创建时间等易变字段固定为 deterministicTime，加密时使用调用方提供的 salt。
+
+// deterministicTime 代替可复现备份中的当前时间
+var deterministicTime = time.Unix(0, 0).UTC()
+
+// deterministicPrefetchLen 以内的文件在等待写入顺序时先读入内存，使小文件的读取仍然是并行的
+const deterministicPrefetchLen = 4 << 20
+
+// now 返回写入清单的时间，可复现模式下为固定值
+func (m *BackupManager) now() time.Time {
+	if m.Deterministic {
+		return deterministicTime
+	}
+	return time.Now()
+}
+
+// orderJobs 返回写入顺序: 可复现模式下按路径排序；硬链接总是排在最后
+func (m *BackupManager) orderJobs(jobs []archiveJob) []orderedJob {
+	if m.Deterministic {
+		jobs = append([]archiveJob(nil), jobs...)
+		sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].relPath < jobs[j].relPath })
+	}
+	ordered := make([]orderedJob, 0, len(jobs))
+	for i, job := range linksLast(jobs) {
+		ordered = append(ordered, orderedJob{archiveJob: job, seq: i})
+	}
+	return ordered
+}
+
+// sortManifestFiles 在可复现模式下按路径排序清单，使清单与源路径的给出顺序无关
+func (m *BackupManager) sortManifestFiles(files []ManifestFile) {
+	if m.Deterministic {
+		sort.SliceStable(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	}
+}
+
+// orderedJob 是带有写入序号的归档任务
+type orderedJob struct {
+	archiveJob
+	seq int
+}
+
+// entryOrder 协调并发 worker 写入归档: 普通模式下只是互斥锁，
+// 可复现模式下还要求条目按任务序号依次写入，出错跳过的任务也要通过 skip 让出顺序
+type entryOrder struct {
+	ctx     context.Context
+	ordered bool
+	mu      sync.Mutex
+	cond    *sync.Cond
+	next    int
+	stop    func() bool
+}
+
+func newEntryOrder(ctx context.Context, ordered bool) *entryOrder {
+	o := &entryOrder{ctx: ctx, ordered: ordered, stop: func() bool { return false }}
+	o.cond = sync.NewCond(&o.mu)
+	if ordered {
+		// 取消时唤醒所有等待的 worker
+		o.stop = context.AfterFunc(ctx, func() {
+			o.mu.Lock()
+			o.cond.Broadcast()
+			o.mu.Unlock()
+		})
+	}
+	return o
+}
+
+// acquire 等待轮到序号为 seq 的任务写入；操作被取消时返回 false
+func (o *entryOrder) acquire(seq int) bool {
+	o.mu.Lock()
+	for o.ordered && o.next != seq {
+		if o.ctx.Err() != nil {
+			o.mu.Unlock()
+			return false
+		}
+		o.cond.Wait()
+	}
+	return true
+}
+
+func (o *entryOrder) release() {
+	o.next++
+	o.cond.Broadcast()
+	o.mu.Unlock()
+}
+
+// skip 让出没有写入的任务的顺序
+func (o *entryOrder) skip(seq int) {
+	if o.ordered && o.acquire(seq) {
+		o.release()
+	}
+}
+
+// prefetch 在可复现模式下把较小的条目数据读入内存，这样等待写入顺序时其他 worker 不必等待读取
+func (o *entryOrder) prefetch(r io.Reader, size int64) (io.Reader, error) {
+	if !o.ordered || size > deterministicPrefetchLen {
+		return r, nil
+	}
+	data := make([]byte, size)
+	n, err := io.ReadFull(r, data)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	// 文件在读取期间变短时交给 WriteEntry 按原有方式报告
+	return bytes.NewReader(data[:n]), nil
+}
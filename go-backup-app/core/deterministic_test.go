@@ -0,0 +1,182 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeterministicBackup_IdenticalOutput(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	for i := 0; i < 40; i++ {
+		dir := filepath.Join(srcDir, fmt.Sprintf("d%d", i%5))
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		content := bytes.Repeat([]byte(fmt.Sprintf("file %d ", i)), 100*(i+1))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%02d.txt", i)), content, 0644))
+	}
+	require.NoError(t, os.Symlink("d0/f00.txt", filepath.Join(srcDir, "link")))
+	require.NoError(t, os.Link(filepath.Join(srcDir, "d1", "f01.txt"), filepath.Join(srcDir, "hard.txt")))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	manager.Deterministic = true
+	filters := FilterConfig{MaxSize: -1}
+
+	err := manager.Backup([]string{srcDir}, filepath.Join(tempDir, "nosalt.qbak"), filters, CodecHuffman, true, AlgoAES256_CTR, "pw")
+	require.ErrorIs(t, err, ErrSaltRequired)
+
+	manager.Salt = []byte("0123456789abcdef")
+	backup := func(name string, volumeSize int64) []byte {
+		manager.VolumeSize = volumeSize
+		backupFile := filepath.Join(tempDir, name)
+		require.NoError(t, manager.Backup([]string{srcDir}, backupFile, filters, CodecHuffman, true, AlgoAES256_CTR, "pw"))
+		if volumeSize == 0 {
+			data, err := os.ReadFile(backupFile)
+			require.NoError(t, err)
+			return data
+		}
+		var all []byte
+		for n := 1; ; n++ {
+			data, err := os.ReadFile(volumeName(backupFile, n))
+			if os.IsNotExist(err) {
+				break
+			}
+			require.NoError(t, err)
+			all = append(all, data...)
+		}
+		return all
+	}
+
+	first := backup("a.qbak", 0)
+	require.Equal(t, first, backup("b.qbak", 0))
+	require.Equal(t, backup("c.qbak", MinVolumeSize), backup("d.qbak", MinVolumeSize))
+
+	// 换一个 salt 输出不同，但仍然可以正常恢复
+	manager.Salt = []byte("another salt")
+	require.NotEqual(t, first, backup("e.qbak", 0))
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	require.NoError(t, manager.Restore(filepath.Join(tempDir, "c.qbak"), restoreDir, "pw"))
+	data, err := os.ReadFile(filepath.Join(restoreDir, "d4", "f39.txt"))
+	require.NoError(t, err)
+	require.Equal(t, bytes.Repeat([]byte("file 39 "), 4000), data)
+
+	report, err := manager.Verify(filepath.Join(tempDir, "e.qbak"), "pw")
+	require.NoError(t, err)
+	require.True(t, report.OK, "%+v", report.Issues)
+
+	// 条目按路径顺序写入
+	manager.VolumeSize = 0
+	plainFile := filepath.Join(tempDir, "plain.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, plainFile, filters, CodecStore, false, 0, ""))
+	f, err := os.Open(plainFile)
+	require.NoError(t, err)
+	defer f.Close()
+	ar := NewArchiveReader(f)
+	var paths []string
+	for {
+		meta, err := ar.NextEntry()
+		if err != nil {
+			break
+		}
+		require.NoError(t, ar.SkipEntry(meta))
+		if !isInternalPath(meta.Path) && meta.HardLink == "" {
+			paths = append(paths, meta.Path)
+		}
+	}
+	require.IsIncreasing(t, paths)
+}
+
+func TestDeterministicEncryptedWriter_NonceFollowsContent(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	encrypt := func(plain []byte) []byte {
+		var out bytes.Buffer
+		w, err := NewDeterministicEncryptedWriter(&out, "pw", AlgoChaCha20, salt)
+		require.NoError(t, err)
+		_, err = w.Write(plain)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		return out.Bytes()
+	}
+
+	a := bytes.Repeat([]byte("first plaintext "), 10000)
+	b := bytes.Repeat([]byte("other plaintext "), 10000)
+	encA := encrypt(a)
+	require.Equal(t, encA, encrypt(a))
+
+	// 不同的明文使用不同的 nonce，两份密文异或不会得到明文的异或
+	encB := encrypt(b)
+	nonceAt := len(magicHeader) + 3 + len(salt) + 1
+	require.NotEqual(t, encA[nonceAt:nonceAt+12], encB[nonceAt:nonceAt+12])
+	xored := make([]byte, len(a))
+	for i := range xored {
+		xored[i] = encA[len(encA)-len(a)+i] ^ encB[len(encB)-len(b)+i]
+	}
+	plainXor := make([]byte, len(a))
+	for i := range plainXor {
+		plainXor[i] = a[i] ^ b[i]
+	}
+	require.NotEqual(t, plainXor, xored)
+
+	r, err := NewDecryptedReader(bytes.NewReader(encB), "pw")
+	require.NoError(t, err)
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, b, got)
+}
+
+func TestDeterministicEncryptedWriter_NoPlaintextInTempDir(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	plain := bytes.Repeat([]byte("plaintext that must not reach the disk "), 20000)
+
+	spooled := func() []byte {
+		var all []byte
+		entries, err := os.ReadDir(tmp)
+		require.NoError(t, err)
+		for _, e := range entries {
+			data, err := os.ReadFile(filepath.Join(tmp, e.Name()))
+			require.NoError(t, err)
+			all = append(all, data...)
+		}
+		return all
+	}
+
+	var out bytes.Buffer
+	w, err := NewDeterministicEncryptedWriter(&out, "pw", AlgoAES256_CTR, []byte("0123456789abcdef"))
+	require.NoError(t, err)
+	_, err = w.Write(plain)
+	require.NoError(t, err)
+	// 写入期间 (也就是进程在这时被终止的话) 临时目录中没有明文；Unix 上暂存文件已经从目录中删除，
+	// 因此还要直接检查打开的暂存文件
+	require.NotContains(t, string(spooled()), "plaintext that must not")
+	dw := w.(*deterministicWriter)
+	require.NoError(t, dw.spoolW.Close())
+	info, err := dw.spool.Stat()
+	require.NoError(t, err)
+	require.Equal(t, int64(len(plain)), info.Size())
+	data := make([]byte, info.Size())
+	_, err = dw.spool.ReadAt(data, 0)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "plaintext that must not")
+
+	require.NoError(t, w.Close())
+	entries, err := os.ReadDir(tmp)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	r, err := NewDecryptedReader(bytes.NewReader(out.Bytes()), "pw")
+	require.NoError(t, err)
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, plain, got)
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffBackups(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "dir"), 0755))
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), []byte(content), 0644))
+	}
+	write("same.txt", "unchanged")
+	write("grow.txt", "12345")
+	write("touched.txt", "same content")
+	write("removed.txt", "bye")
+	write("dir/becomes-link.txt", "file")
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	filters := FilterConfig{MaxSize: -1}
+
+	monday := filepath.Join(tempDir, "monday.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, monday, filters, CodecHuffman, true, AlgoChaCha20, "pw"))
+
+	write("grow.txt", "1234567890")
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(srcDir, "touched.txt"), later, later))
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "removed.txt")))
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "dir", "becomes-link.txt")))
+	require.NoError(t, os.Symlink("../same.txt", filepath.Join(srcDir, "dir", "becomes-link.txt")))
+	write("added.txt", "new")
+
+	friday := filepath.Join(tempDir, "friday.qbak")
+	require.NoError(t, manager.BackupIncremental([]string{srcDir}, friday, monday, filters, CodecHuffman, true, AlgoChaCha20, "pw"))
+	fridayFull := filepath.Join(tempDir, "friday-full.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, fridayFull, filters, CodecStore, true, AlgoChaCha20, "pw"))
+
+	diff, err := manager.DiffBackups(monday, friday, "pw")
+	require.NoError(t, err)
+	require.Equal(t, []string{monday}, diff.OldBackups)
+	require.Equal(t, []string{monday, friday}, diff.NewBackups)
+
+	kinds := map[string]DiffKind{}
+	byPath := map[string]DiffEntry{}
+	for _, e := range diff.Entries {
+		kinds[e.Path] = e.Kind
+		byPath[e.Path] = e
+	}
+	require.Equal(t, map[string]DiffKind{
+		"added.txt":            DiffAdded,
+		"removed.txt":          DiffRemoved,
+		"grow.txt":             DiffModified,
+		"touched.txt":          DiffModified,
+		"dir/becomes-link.txt": DiffTypeChanged,
+	}, kinds)
+	require.Equal(t, int64(5), byPath["grow.txt"].SizeDelta)
+	require.True(t, byPath["grow.txt"].ContentChanged)
+	require.False(t, byPath["touched.txt"].ContentChanged, "only the modification time changed")
+	require.Equal(t, int64(-3), byPath["removed.txt"].SizeDelta)
+	require.Equal(t, 1, diff.Added)
+	require.Equal(t, 1, diff.Removed)
+	require.Equal(t, 2, diff.Modified)
+	require.Equal(t, 1, diff.TypeChanged)
+
+	// 增量备份与同一时刻的完整备份内容相同
+	full, err := manager.DiffBackups(monday, fridayFull, "pw")
+	require.NoError(t, err)
+	require.Equal(t, diff.Entries, full.Entries)
+
+	same, err := manager.DiffBackups(friday, fridayFull, "pw")
+	require.NoError(t, err)
+	require.Empty(t, same.Entries)
+
+	_, err = manager.DiffBackups(monday, friday, "wrong")
+	require.ErrorIs(t, err, ErrInvalidPassword)
+}
+
+func TestDiffBackups_EditKeepingSizeAndModTime(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+	path := filepath.Join(srcDir, "data.bin")
+	require.NoError(t, os.WriteFile(path, []byte("version one"), 0644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	filters := FilterConfig{MaxSize: -1}
+
+	before := filepath.Join(tempDir, "before.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, before, filters, CodecHuffman, false, 0, ""))
+
+	require.NoError(t, os.WriteFile(path, []byte("version two"), 0644))
+	require.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+	after := filepath.Join(tempDir, "after.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, after, filters, CodecHuffman, false, 0, ""))
+
+	diff, err := manager.DiffBackups(before, after, "")
+	require.NoError(t, err)
+	require.Equal(t, []DiffEntry{{Path: "data.bin", Kind: DiffModified, OldSize: 11, NewSize: 11, ContentChanged: true}}, diff.Entries)
+	require.Equal(t, 1, diff.Modified)
+}
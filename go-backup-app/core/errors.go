@@ -5,3 +5,10 @@ import "errors"
 var ErrNoFilesSelected = errors.New("no files selected after applying filters")
 var ErrNoChanges = errors.New("no changes detected since parent backup")
 var ErrInvalidPassword = errors.New("invalid password")
+var ErrEntryNotFound = errors.New("entry not found in backup")
+var ErrVolumeMissing = errors.New("backup volume is missing")
+var ErrChecksumMismatch = errors.New("crc32 mismatch")
+var ErrContentHashMismatch = errors.New("sha256 mismatch")
+var ErrSaltRequired = errors.New("deterministic encrypted backup requires a salt")
+var ErrUnsafePath = errors.New("unsafe path in backup")
+var ErrSymlinkedPath = errors.New("path passes through a symbolic link")
@@ -0,0 +1,241 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// paxXattrPrefix 是 GNU tar/star 保存扩展属性所用的 PAX 记录前缀
+const paxXattrPrefix = "SCHILY.xattr."
+
+// chainView 是备份链合并后的最终状态: 每个路径都指向链中最后写入它的归档
+type chainView struct {
+	archives []*archiveAt
+	owner    map[string]int
+	paths    []string
+}
+
+func (m *BackupManager) openChainView(backupFile, password string) (*chainView, error) {
+	chain, err := m.resolveRestoreChain(backupFile, password)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &chainView{owner: make(map[string]int, 1024)}
+	for i, f := range chain {
+		a, err := m.openArchiveAt(f, password)
+		if err != nil {
+			_ = view.Close()
+			return nil, err
+		}
+		view.archives = append(view.archives, a)
+		if err := a.loadIndex(); err != nil {
+			_ = view.Close()
+			return nil, err
+		}
+
+		// 与恢复时的顺序一致: 先处理删除标记 (会删除整个子树)，再处理新写入的条目
+		for p, e := range a.index {
+			if !e.Deleted {
+				continue
+			}
+			prefix := p + "/"
+			for existing := range view.owner {
+				if existing == p || strings.HasPrefix(existing, prefix) {
+					delete(view.owner, existing)
+				}
+			}
+		}
+		for p, e := range a.index {
+			if !e.Deleted && p != "." {
+				view.owner[p] = i
+			}
+		}
+	}
+
+	view.paths = make([]string, 0, len(view.owner))
+	for p := range view.owner {
+		view.paths = append(view.paths, p)
+	}
+	sort.Strings(view.paths)
+	return view, nil
+}
+
+// findEntry 在最终状态中查找 relPath
+func (v *chainView) findEntry(relPath string) (*FileMetadata, *ArchiveReader, error) {
+	owner, ok := v.owner[relPath]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: %w", relPath, ErrEntryNotFound)
+	}
+	return v.archives[owner].findEntry(relPath)
+}
+
+func (v *chainView) Close() error {
+	var firstErr error
+	for _, a := range v.archives {
+		if err := a.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// walkChainView 按路径顺序遍历最终状态中的每个条目，fn 可以从 ar 读取该条目的数据
+func (m *BackupManager) walkChainView(v *chainView, fn func(meta *FileMetadata, ar *ArchiveReader) error) error {
+	for i, p := range v.paths {
+		select {
+		case <-m.ctx.Done():
+			return m.ctx.Err()
+		default:
+		}
+
+		meta, ar, err := v.findEntry(p)
+		if err != nil {
+			return err
+		}
+		m.emitProgressDetail(fmt.Sprintf("正在导出: %s", p), i, len(v.paths), 0, 0, "exporting")
+		if err := fn(meta, ar); err != nil {
+			return err
+		}
+	}
+	m.emitProgressDetail("导出完成", len(v.paths), len(v.paths), 0, 0, "exporting")
+	return nil
+}
+
+// ExportTar 将备份 (或整条增量备份链的最终状态) 导出为标准 tar 流，保留权限、修改时间和符号链接
+func (m *BackupManager) ExportTar(backupFile, password string, w io.Writer) error {
+	view, err := m.openChainView(backupFile, password)
+	if err != nil {
+		return err
+	}
+	defer view.Close()
+
+	tw := tar.NewWriter(w)
+	buffer := make([]byte, copyBufferSize)
+	// tar 要求硬链接出现在它指向的文件之后，因此放到最后写入
+	var hardLinks []*tar.Header
+	err = m.walkChainView(view, func(meta *FileMetadata, ar *ArchiveReader) error {
+		hdr := &tar.Header{
+			Name:    meta.Path,
+			Mode:    int64(meta.Mode.Perm()),
+			ModTime: meta.ModTime,
+		}
+		if meta.Owner != nil {
+			hdr.Uid, hdr.Gid = meta.Owner.UID, meta.Owner.GID
+			hdr.Uname, hdr.Gname = meta.Owner.User, meta.Owner.Group
+		}
+		switch {
+		case meta.HardLink != "":
+			hdr.Typeflag = tar.TypeLink
+			hdr.Linkname = meta.HardLink
+			hardLinks = append(hardLinks, hdr)
+			return nil
+		case meta.IsDir:
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+		case meta.IsLink:
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = meta.LinkDest
+		case meta.Mode.IsRegular():
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = meta.Size
+		case meta.Mode&os.ModeNamedPipe != 0:
+			hdr.Typeflag = tar.TypeFifo
+		case meta.Mode&os.ModeDevice != 0:
+			hdr.Typeflag = tar.TypeBlock
+			if meta.Mode&os.ModeCharDevice != 0 {
+				hdr.Typeflag = tar.TypeChar
+			}
+			hdr.Devmajor = int64(meta.DevMajor)
+			hdr.Devminor = int64(meta.DevMinor)
+		default:
+			log.Printf("Warn: skipping unsupported entry type for %s: %s", meta.Path, meta.Mode.Type())
+			return nil
+		}
+
+		if len(meta.Xattrs) > 0 {
+			hdr.Format = tar.FormatPAX
+			hdr.PAXRecords = make(map[string]string, len(meta.Xattrs))
+			for name, value := range meta.Xattrs {
+				hdr.PAXRecords[paxXattrPrefix+name] = string(value)
+			}
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write tar header for %s: %w", meta.Path, err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			return ar.copyEntryContent(meta, tw, buffer)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, hdr := range hardLinks {
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write tar header for %s: %w", hdr.Name, err)
+		}
+	}
+	return tw.Close()
+}
+
+// ExportZip 将备份 (或整条增量备份链的最终状态) 导出为标准 zip 流。
+// 符号链接按 Info-ZIP 的约定存储: 文件模式带有符号链接标志，内容为链接目标。
+func (m *BackupManager) ExportZip(backupFile, password string, w io.Writer) error {
+	view, err := m.openChainView(backupFile, password)
+	if err != nil {
+		return err
+	}
+	defer view.Close()
+
+	zw := zip.NewWriter(w)
+	buffer := make([]byte, copyBufferSize)
+	err = m.walkChainView(view, func(meta *FileMetadata, ar *ArchiveReader) error {
+		hdr := &zip.FileHeader{
+			Name:     meta.Path,
+			Modified: meta.ModTime,
+		}
+		switch {
+		case meta.IsDir:
+			hdr.Name += "/"
+		case meta.IsLink:
+		case meta.Mode.IsRegular():
+			hdr.Method = zip.Deflate
+		default:
+			log.Printf("Warn: skipping unsupported entry type for %s: %s", meta.Path, meta.Mode.Type())
+			return nil
+		}
+		hdr.SetMode(meta.Mode)
+
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return fmt.Errorf("failed to write zip header for %s: %w", meta.Path, err)
+		}
+		switch {
+		case meta.IsLink:
+			_, err = io.WriteString(fw, meta.LinkDest)
+			return err
+		case meta.HardLink != "":
+			// zip 不支持硬链接，写入一份完整的数据
+			target, targetReader, err := view.findEntry(meta.HardLink)
+			if err != nil {
+				return fmt.Errorf("failed to resolve hard link %s: %w", meta.Path, err)
+			}
+			return targetReader.copyEntryContent(target, fw, buffer)
+		case meta.Mode.IsRegular():
+			return ar.copyEntryContent(meta, fw, buffer)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
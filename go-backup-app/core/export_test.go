@@ -0,0 +1,157 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportTar_IncrementalChain(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("v1"), 0640))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "gone.txt"), []byte("x"), 0644))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(srcDir, "a.txt"), mtime, mtime))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	filters := FilterConfig{MaxSize: -1}
+
+	baseFile := filepath.Join(tempDir, "base.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, baseFile, filters, CodecHuffman, true, AlgoAES256_CTR, "pw"))
+
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "sub", "gone.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "new.txt"), []byte("new"), 0644))
+	if runtime.GOOS != "windows" {
+		require.NoError(t, os.Symlink("../a.txt", filepath.Join(srcDir, "sub", "link")))
+	}
+	incFile := filepath.Join(tempDir, "inc.qbak")
+	require.NoError(t, manager.BackupIncremental([]string{srcDir}, incFile, baseFile, filters, CodecHuffman, true, AlgoAES256_CTR, "pw"))
+
+	var out bytes.Buffer
+	require.NoError(t, manager.ExportTar(incFile, "pw", &out))
+
+	got := map[string]*tar.Header{}
+	contents := map[string]string{}
+	tr := tar.NewReader(&out)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		got[hdr.Name] = hdr
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		contents[hdr.Name] = string(data)
+	}
+
+	require.Contains(t, got, "sub/")
+	require.NotContains(t, got, "sub/gone.txt")
+	require.Equal(t, "v1", contents["a.txt"])
+	require.Equal(t, int64(0640), got["a.txt"].Mode)
+	require.True(t, got["a.txt"].ModTime.Equal(mtime))
+	require.Equal(t, "new", contents["sub/new.txt"])
+	if runtime.GOOS != "windows" {
+		require.Equal(t, byte(tar.TypeSymlink), got["sub/link"].Typeflag)
+		require.Equal(t, "../a.txt", got["sub/link"].Linkname)
+	}
+}
+
+func TestExportZip_ImportZipRoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "dir"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "dir", "f.txt"), []byte("zip me"), 0600))
+	if runtime.GOOS != "windows" {
+		require.NoError(t, os.Symlink("dir/f.txt", filepath.Join(srcDir, "link")))
+	}
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	backupFile := filepath.Join(tempDir, "orig.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, FilterConfig{MaxSize: -1}, CodecStore, false, 0, ""))
+
+	zipFile := filepath.Join(tempDir, "out.zip")
+	zf, err := os.Create(zipFile)
+	require.NoError(t, err)
+	require.NoError(t, manager.ExportZip(backupFile, "", zf))
+	require.NoError(t, zf.Close())
+
+	zr, err := zip.OpenReader(zipFile)
+	require.NoError(t, err)
+	names := []string{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	require.NoError(t, zr.Close())
+	require.Contains(t, names, "dir/")
+	require.Contains(t, names, "dir/f.txt")
+
+	importedFile := filepath.Join(tempDir, "imported.qbak")
+	require.NoError(t, manager.ImportZip(zipFile, importedFile, CodecHuffman, true, AlgoChaCha20, "pw"))
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	require.NoError(t, manager.Restore(importedFile, restoreDir, "pw"))
+
+	data, err := os.ReadFile(filepath.Join(restoreDir, "dir", "f.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "zip me", string(data))
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(filepath.Join(restoreDir, "dir", "f.txt"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+		dest, err := os.Readlink(filepath.Join(restoreDir, "link"))
+		require.NoError(t, err)
+		require.Equal(t, "dir/f.txt", dest)
+	}
+}
+
+func TestImportTar_Gzip(t *testing.T) {
+	tempDir := t.TempDir()
+	tarFile := filepath.Join(tempDir, "legacy.tar.gz")
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./project/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: time.Now()}))
+	body := []byte("legacy data")
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./project/notes.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(body)), ModTime: time.Now()}))
+	_, err := tw.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../escape.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 1, ModTime: time.Now()}))
+	_, err = tw.Write([]byte("e"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(tarFile, buf.Bytes(), 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	backupFile := filepath.Join(tempDir, "imported.qbak")
+	require.NoError(t, manager.ImportTar(tarFile, backupFile, CodecHuffman, false, 0, ""))
+
+	root, err := manager.ListBackup(backupFile, "")
+	require.NoError(t, err)
+	require.NotNil(t, findNode(root, "project/notes.txt"))
+	require.NotNil(t, findNode(root, "escape.txt"), "paths escaping the archive root are re-rooted")
+
+	var out bytes.Buffer
+	require.NoError(t, manager.ExtractFile(backupFile, "project/notes.txt", "", &out))
+	require.Equal(t, "legacy data", out.String())
+}
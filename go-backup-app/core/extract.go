@@ -0,0 +1,319 @@
+// core/extract.go
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+)
+
+// archiveAt 是备份文件经过解密、解压之后的明文归档流的随机访问视图。
+// 加密层按 CTR/ChaCha20 计数器定位，压缩层按块索引定位，因此读取单个条目只会触及它所在的块。
+type archiveAt struct {
+	r       io.ReaderAt
+	size    int64
+	closers []io.Closer
+	version int // 明文归档的格式版本
+
+	index map[string]archiveIndexEntry
+}
+
+// openArchiveAt 以随机访问方式打开备份文件
+func (m *BackupManager) openArchiveAt(backupFile, password string) (*archiveAt, error) {
+	inFile, err := openBackupSource(backupFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup file: %w", err)
+	}
+
+	a := &archiveAt{r: inFile, size: inFile.Size(), closers: []io.Closer{inFile}}
+
+	magic := make([]byte, len(magicHeader))
+	encrypted := false
+	if n, _ := a.r.ReadAt(magic, 0); n == len(magic) && bytes.Equal(magic, magicHeader) {
+		decrypted, err := newDecryptedReaderAt(a.r, a.size, password)
+		if err != nil {
+			_ = a.Close()
+			return nil, err
+		}
+		a.r = decrypted
+		a.size = decrypted.Size()
+		encrypted = true
+	}
+
+	magic = magic[:codecHeaderLen]
+	n, _ := a.r.ReadAt(magic, 0)
+	codec, headerLen, err := detectCodec(magic[:n])
+	if err != nil {
+		_ = a.Close()
+		return nil, err
+	}
+	if codec != nil {
+		decompressed, size, err := newCodecReaderAt(codec, headerLen, a.r, a.size)
+		if err != nil {
+			_ = a.Close()
+			return nil, fmt.Errorf("failed to create decompressor: %w", err)
+		}
+		a.r = decompressed
+		a.size = size
+	} else if encrypted {
+		peek := make([]byte, 5)
+		if n, _ := a.r.ReadAt(peek, 0); n < len(peek) || !looksLikeArchiveStart(peek) {
+			_ = a.Close()
+			return nil, ErrInvalidPassword
+		}
+	}
+
+	a.version = archiveVersion1
+	magic = magic[:len(archiveMagicV2)]
+	if n, _ := a.r.ReadAt(magic, 0); n == len(magic) && bytes.Equal(magic, archiveMagicV2) {
+		a.version = archiveVersion2
+	}
+	return a, nil
+}
+
+func (a *archiveAt) Close() error {
+	var firstErr error
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		if err := a.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// readerAt 返回从 offset 开始顺序读取归档条目的 ArchiveReader；
+// prevPath 是写入顺序中位于 offset 之前的最后一个条目的路径，用于还原 v2 头部的路径前缀
+func (a *archiveAt) readerAt(offset int64, prevPath string) *ArchiveReader {
+	section := io.NewSectionReader(a.r, offset, a.size-offset)
+	ar := NewArchiveReader(bufio.NewReaderSize(section, copyBufferSize))
+	if offset > 0 {
+		ar.version = a.version
+		ar.prevPath = prevPath
+	}
+	return ar
+}
+
+// loadIndex 读取归档末尾的索引；旧版本归档没有索引时，逐个读取条目头部建立索引
+func (a *archiveAt) loadIndex() error {
+	if a.index != nil {
+		return nil
+	}
+
+	index, err := a.readTrailingIndex()
+	if err != nil {
+		return err
+	}
+	var entries []archiveIndexEntry
+	if index != nil {
+		entries = index.Entries
+	} else {
+		log.Println("Archive index not found, scanning entry headers.")
+		entries, err = a.scanEntries()
+		if err != nil {
+			return err
+		}
+	}
+
+	// 同一路径可能出现多次 (增量备份中类型变化时先写删除标记)，以最后一次为准
+	a.index = make(map[string]archiveIndexEntry, len(entries))
+	for i, e := range entries {
+		if i > 0 {
+			e.prevPath = entries[i-1].Path
+		}
+		a.index[e.Path] = e
+	}
+	return nil
+}
+
+// readTrailingIndex 通过明文流最后 16 字节定位并读取索引；不存在索引时返回 nil, nil
+func (a *archiveAt) readTrailingIndex() (*archiveIndex, error) {
+	if a.size < archiveIndexTailLen {
+		return nil, nil
+	}
+	tail := make([]byte, archiveIndexTailLen)
+	if _, err := a.r.ReadAt(tail, a.size-archiveIndexTailLen); err != nil {
+		return nil, fmt.Errorf("failed to read archive tail: %w", err)
+	}
+	if !bytes.Equal(tail[:len(archiveIndexMagic)], archiveIndexMagic) {
+		return nil, nil
+	}
+
+	offset := int64(binary.BigEndian.Uint64(tail[len(archiveIndexMagic):archiveIndexLocatorLen]))
+	if offset < 0 || offset >= a.size-archiveIndexTailLen {
+		return nil, fmt.Errorf("invalid archive index offset: %d", offset)
+	}
+
+	// 索引是内部条目，头部总是保存完整路径
+	ar := a.readerAt(offset, "")
+	meta, err := ar.NextEntry()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive index header: %w", err)
+	}
+	if meta.Path != archiveIndexPath || meta.Size < archiveIndexLocatorLen {
+		return nil, fmt.Errorf("invalid archive index entry: %s", meta.Path)
+	}
+
+	var payload bytes.Buffer
+	if err := ar.copyEntryData(meta, &payload, nil); err != nil {
+		return nil, err
+	}
+	indexBytes := payload.Bytes()[:payload.Len()-archiveIndexLocatorLen]
+
+	var index archiveIndex
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal archive index: %w", err)
+	}
+	if index.Entries == nil {
+		index.Entries = []archiveIndexEntry{}
+	}
+	return &index, nil
+}
+
+// readManifest 读取索引中记录位置的清单 (清单写在数据之后)；索引没有记录清单时返回 nil, nil
+func (a *archiveAt) readManifest() (*BackupManifest, error) {
+	index, err := a.readTrailingIndex()
+	if err != nil || index == nil || index.Manifest <= 0 {
+		return nil, err
+	}
+	if index.Manifest >= a.size {
+		return nil, fmt.Errorf("invalid manifest offset: %d", index.Manifest)
+	}
+
+	// 清单是内部条目，头部总是保存完整路径
+	ar := a.readerAt(index.Manifest, "")
+	meta, err := ar.NextEntry()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest header: %w", err)
+	}
+	if meta.Path != manifestEntryPath {
+		return nil, fmt.Errorf("invalid manifest entry: %s", meta.Path)
+	}
+	var payload bytes.Buffer
+	if err := ar.copyEntryData(meta, &payload, nil); err != nil {
+		return nil, fmt.Errorf("failed to read manifest payload: %w", err)
+	}
+	manifest, err := UnmarshalManifest(payload.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// scanEntries 顺序读取所有条目头部并跳过数据，用于没有索引的归档
+func (a *archiveAt) scanEntries() ([]archiveIndexEntry, error) {
+	entries := make([]archiveIndexEntry, 0, 64)
+	ar := a.readerAt(0, "")
+	for {
+		offset := ar.Offset()
+		meta, err := ar.NextEntry()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read next archive entry: %w", err)
+		}
+		if !isInternalPath(meta.Path) {
+			entries = append(entries, archiveIndexEntry{
+				Path:    meta.Path,
+				Offset:  offset,
+				Size:    meta.Size,
+				Deleted: meta.Deleted,
+			})
+		}
+		if err := ar.SkipEntry(meta); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// findEntry 查找 relPath 对应的条目，返回其元数据以及定位在数据起点的 ArchiveReader
+func (a *archiveAt) findEntry(relPath string) (*FileMetadata, *ArchiveReader, error) {
+	if err := a.loadIndex(); err != nil {
+		return nil, nil, err
+	}
+	entry, ok := a.index[relPath]
+	if !ok {
+		return nil, nil, ErrEntryNotFound
+	}
+	ar := a.readerAt(entry.Offset, entry.prevPath)
+	meta, err := ar.NextEntry()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read entry header for %s: %w", relPath, err)
+	}
+	if meta.Path != relPath {
+		return nil, nil, fmt.Errorf("archive index points to %s instead of %s", meta.Path, relPath)
+	}
+	return meta, ar, nil
+}
+
+// ExtractFile 从备份中提取单个文件并写入 w。借助归档索引，只会解密、解压该文件所在的数据块。
+// 对于增量备份，会沿备份链从最新的备份向前查找该文件。
+func (m *BackupManager) ExtractFile(backupFile, relPath, password string, w io.Writer) error {
+	chain, err := m.resolveRestoreChain(backupFile, password)
+	if err != nil {
+		return err
+	}
+	return m.extractFromChain(chain, relPath, password, w)
+}
+
+func (m *BackupManager) extractFromChain(chain []string, relPath, password string, w io.Writer) error {
+	for i := len(chain) - 1; i >= 0; i-- {
+		select {
+		case <-m.ctx.Done():
+			return m.ctx.Err()
+		default:
+		}
+
+		found, hardLink, err := m.extractFromArchive(chain[i], relPath, password, w)
+		if err != nil {
+			return err
+		}
+		if hardLink != "" {
+			// 硬链接的数据在同一个归档中更早的位置，或者在更早的归档中
+			return m.extractFromChain(chain[:i+1], hardLink, password, w)
+		}
+		if found {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %w", relPath, ErrEntryNotFound)
+}
+
+// extractFromArchive 在单个归档中查找并提取 relPath；条目是硬链接时返回它指向的路径而不写入数据
+func (m *BackupManager) extractFromArchive(backupFile, relPath, password string, w io.Writer) (bool, string, error) {
+	a, err := m.openArchiveAt(backupFile, password)
+	if err != nil {
+		return false, "", err
+	}
+	defer a.Close()
+
+	meta, ar, err := a.findEntry(relPath)
+	if err == ErrEntryNotFound {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	switch {
+	case meta.Deleted:
+		return false, "", fmt.Errorf("%s: %w", relPath, ErrEntryNotFound)
+	case meta.HardLink != "":
+		return false, meta.HardLink, nil
+	case meta.IsDir:
+		return false, "", fmt.Errorf("%s is a directory", relPath)
+	case meta.IsLink:
+		return false, "", fmt.Errorf("%s is a symbolic link to %s", relPath, meta.LinkDest)
+	case !meta.Mode.IsRegular():
+		return false, "", fmt.Errorf("%s is not a regular file", relPath)
+	}
+
+	if err := ar.copyEntryContent(meta, w, nil); err != nil {
+		return false, "", err
+	}
+	return true, "", nil
+}
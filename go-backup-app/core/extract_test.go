@@ -0,0 +1,167 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractFile_CompressedEncrypted(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "config"), 0755))
+
+	big := make([]byte, 3*huffmanChunkSize+123)
+	rand.New(rand.NewSource(1)).Read(big)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "big.bin"), big, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "config", "app.yaml"), []byte("listen: 8080\n"), 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	for _, algo := range []uint8{AlgoAES256_CTR, AlgoChaCha20} {
+		backupFile := filepath.Join(tempDir, "out.qbak")
+		require.NoError(t, manager.Backup([]string{srcDir}, backupFile, FilterConfig{MaxSize: -1}, CodecHuffman, true, algo, "pw"))
+
+		var buf bytes.Buffer
+		require.NoError(t, manager.ExtractFile(backupFile, "config/app.yaml", "pw", &buf))
+		require.Equal(t, "listen: 8080\n", buf.String())
+
+		buf.Reset()
+		require.NoError(t, manager.ExtractFile(backupFile, "big.bin", "pw", &buf))
+		require.True(t, bytes.Equal(big, buf.Bytes()))
+
+		err := manager.ExtractFile(backupFile, "missing.txt", "pw", io.Discard)
+		require.ErrorIs(t, err, ErrEntryNotFound)
+
+		err = manager.ExtractFile(backupFile, "config/app.yaml", "wrong", io.Discard)
+		require.ErrorIs(t, err, ErrInvalidPassword)
+	}
+}
+
+func TestExtractFile_IncrementalChain(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("v1"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("keep"), 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	filters := FilterConfig{MaxSize: -1}
+
+	baseFile := filepath.Join(tempDir, "base.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, baseFile, filters, CodecHuffman, false, 0, ""))
+
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("v2-changed"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "c.txt"), []byte("new"), 0644))
+	incFile := filepath.Join(tempDir, "inc.qbak")
+	require.NoError(t, manager.BackupIncremental([]string{srcDir}, incFile, baseFile, filters, CodecHuffman, false, 0, ""))
+
+	var buf bytes.Buffer
+	require.NoError(t, manager.ExtractFile(incFile, "a.txt", "", &buf))
+	require.Equal(t, "v2-changed", buf.String())
+
+	buf.Reset()
+	require.NoError(t, manager.ExtractFile(incFile, "b.txt", "", &buf))
+	require.Equal(t, "keep", buf.String(), "unchanged file should be read from the base backup")
+
+	buf.Reset()
+	require.NoError(t, manager.ExtractFile(baseFile, "a.txt", "", &buf))
+	require.Equal(t, "v1", buf.String())
+}
+
+func TestExtractFile_ArchiveWithoutIndex(t *testing.T) {
+	tempDir := t.TempDir()
+	backupFile := filepath.Join(tempDir, "legacy.qbak")
+
+	// 模拟旧版本归档: 只有条目，没有末尾索引
+	out, err := os.Create(backupFile)
+	require.NoError(t, err)
+	aw := NewArchiveWriter(out)
+	buffer := make([]byte, copyBufferSize)
+	for _, name := range []string{"one.txt", "two.txt"} {
+		data := []byte("content of " + name)
+		meta := FileMetadata{Path: name, Size: int64(len(data)), Mode: 0644, HasCRC: true}
+		require.NoError(t, aw.WriteEntry(meta, bytes.NewReader(data), buffer, nil))
+	}
+	require.NoError(t, out.Close())
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	var buf bytes.Buffer
+	require.NoError(t, manager.ExtractFile(backupFile, "two.txt", "", &buf))
+	require.Equal(t, "content of two.txt", buf.String())
+}
+
+func TestHuffmanReaderAt_RandomOffsets(t *testing.T) {
+	original := make([]byte, 4*huffmanChunkSize+777)
+	rnd := rand.New(rand.NewSource(7))
+	for i := range original {
+		original[i] = byte(rnd.Intn(16))
+	}
+
+	for _, withIndex := range []bool{true, false} {
+		mockWc := newMockWriteCloser()
+		writer := NewCompressedWriter(mockWc)
+		_, err := writer.Write(original)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		compressed := mockWc.Bytes()
+		if !withIndex {
+			// 去掉块索引，模拟旧版本的压缩流
+			idx := bytes.LastIndex(compressed, chunkIndexMagic)
+			require.Greater(t, idx, 0)
+			compressed = compressed[:idx]
+		}
+
+		ra, err := newHuffmanReaderAt(bytes.NewReader(compressed), int64(len(compressed)))
+		require.NoError(t, err)
+		require.Equal(t, int64(len(original)), ra.Size())
+
+		for i := 0; i < 50; i++ {
+			off := rnd.Int63n(int64(len(original)))
+			length := rnd.Intn(2 * huffmanChunkSize)
+			got := make([]byte, length)
+			n, err := ra.ReadAt(got, off)
+			if off+int64(length) > int64(len(original)) {
+				require.ErrorIs(t, err, io.EOF)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, original[off:off+int64(n)], got[:n])
+		}
+	}
+}
+
+func TestCipherReaderAt_MatchesStream(t *testing.T) {
+	original := make([]byte, 2*chunkSize+999)
+	rand.New(rand.NewSource(3)).Read(original)
+
+	for _, algo := range []uint8{AlgoAES256_CTR, AlgoChaCha20} {
+		var encrypted bytes.Buffer
+		writer, err := NewEncryptedWriter(&encrypted, "pw", algo)
+		require.NoError(t, err)
+		_, err = writer.Write(original)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		ra, err := newDecryptedReaderAt(bytes.NewReader(encrypted.Bytes()), int64(encrypted.Len()), "pw")
+		require.NoError(t, err)
+		require.Equal(t, int64(len(original)), ra.Size())
+
+		for _, off := range []int64{0, 1, 15, 17, 63, 65, chunkSize - 3, chunkSize, int64(len(original)) - 10} {
+			got := make([]byte, 100)
+			n, _ := ra.ReadAt(got, off)
+			require.Equal(t, original[off:off+int64(n)], got[:n], "offset %d", off)
+		}
+	}
+}
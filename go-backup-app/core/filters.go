@@ -2,7 +2,9 @@
 package core
 
 import (
+	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -153,3 +155,126 @@ func (fc *FilterConfig) ShouldInclude(path string, info os.FileInfo) bool {
 
 	return true
 }
+
+// --- 归档路径匹配 (用于选择性恢复) ---
+
+// RestoreOptions 定义了选择性恢复的条件，路径均为归档内的相对路径 (以 / 分隔)
+type RestoreOptions struct {
+	Include []string `json:"include"` // 只恢复匹配的条目, e.g., "src/config/**", "*.yaml"
+	Exclude []string `json:"exclude"` // 不恢复匹配的条目, e.g., "*.log", "build/**"
+
+	SkipXattrs   bool `json:"skipXattrs"`   // 不恢复扩展属性 (目标文件系统不支持时使用)
+	SpecialFiles bool `json:"specialFiles"` // 重建 FIFO 和设备节点，创建设备节点通常需要 root 权限
+
+	// 不创建指向恢复目录之外的符号链接 (绝对路径，或相对路径向上越过恢复目录)，恢复来源不可信的备份时使用
+	RefuseEscapingSymlinks bool `json:"refuseEscapingSymlinks"`
+
+	// 属主的恢复方式，留空等同于 OwnershipIgnore；UIDMap/GIDMap 只在 OwnershipMap 时使用
+	Ownership OwnershipMode `json:"ownership"`
+	UIDMap    map[int]int   `json:"uidMap"`
+	GIDMap    map[int]int   `json:"gidMap"`
+}
+
+// Validate 检查所有模式的语法以及属主恢复方式
+func (o *RestoreOptions) Validate() error {
+	if err := o.Ownership.validate(); err != nil {
+		return err
+	}
+	for _, patterns := range [][]string{o.Include, o.Exclude} {
+		for _, pattern := range patterns {
+			if err := validateArchivePattern(pattern); err != nil {
+				return fmt.Errorf("invalid restore pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ShouldRestore 判断归档中的条目是否需要恢复。
+// 规则与 FilterConfig 相同: 任何一个 Exclude 规则匹配，则立即排除；如果定义了 Include 规则，则必须至少匹配一个。
+func (o *RestoreOptions) ShouldRestore(relPath string) bool {
+	for _, pattern := range o.Exclude {
+		if matchArchivePattern(pattern, relPath) {
+			return false
+		}
+	}
+	if len(o.Include) == 0 {
+		return true
+	}
+	for _, pattern := range o.Include {
+		if matchArchivePattern(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchArchivePattern 判断归档内的相对路径是否匹配模式。
+//   - 不含 "/" 的模式与任意一级路径名匹配，语义与 IncludeNames/ExcludeNames 相同，例如 "*.log"、"node_modules"。
+//   - 含 "/" 的模式从归档根开始逐段匹配，"**" 匹配任意多级目录 (包括零级)，例如 "src/config/**"。
+//   - 模式匹配到某个目录时，该目录下的所有条目也视为匹配。
+func matchArchivePattern(pattern, relPath string) bool {
+	pattern = filepath.ToSlash(pattern)
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.Trim(path.Clean("/"+pattern), "/")
+	if pattern == "" {
+		return anchored // "/" 表示整个归档
+	}
+	segments := strings.Split(relPath, "/")
+
+	if !anchored {
+		for _, seg := range segments {
+			if matched, err := path.Match(pattern, seg); err == nil && matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	patternSegs := strings.Split(pattern, "/")
+	// 依次尝试路径本身及其所有祖先目录
+	for i := len(segments); i > 0; i-- {
+		if matchSegments(patternSegs, segments[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(rest, segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, err := path.Match(pattern[0], segments[0]); err != nil || !matched {
+			return false
+		}
+		pattern = pattern[1:]
+		segments = segments[1:]
+	}
+	return len(segments) == 0
+}
+
+func validateArchivePattern(pattern string) error {
+	if strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("empty pattern")
+	}
+	for _, seg := range strings.Split(filepath.ToSlash(pattern), "/") {
+		if seg == "**" {
+			continue
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
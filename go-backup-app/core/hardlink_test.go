@@ -0,0 +1,77 @@
+//go:build !windows
+
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupRestore_HardLinks(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0755))
+
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(11)).Read(data)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.bin"), data, 0644))
+	require.NoError(t, os.Link(filepath.Join(srcDir, "a.bin"), filepath.Join(srcDir, "b.bin")))
+	require.NoError(t, os.Link(filepath.Join(srcDir, "a.bin"), filepath.Join(srcDir, "sub", "c.bin")))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	backupFile := filepath.Join(tempDir, "links.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, FilterConfig{MaxSize: -1}, CodecStore, false, 0, ""))
+
+	info, err := os.Stat(backupFile)
+	require.NoError(t, err)
+	require.Less(t, info.Size(), int64(2*len(data)), "shared inode data should be stored once")
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	require.NoError(t, manager.Restore(backupFile, restoreDir, ""))
+
+	a, err := os.Stat(filepath.Join(restoreDir, "a.bin"))
+	require.NoError(t, err)
+	for _, p := range []string{"b.bin", "sub/c.bin"} {
+		other, err := os.Stat(filepath.Join(restoreDir, p))
+		require.NoError(t, err)
+		require.True(t, os.SameFile(a, other), "%s should be a hard link", p)
+	}
+
+	// 只选中链接本身: 数据恢复到链接路径
+	selectiveDir := filepath.Join(tempDir, "selective")
+	require.NoError(t, manager.RestoreWithOptions(backupFile, selectiveDir, "", RestoreOptions{Include: []string{"sub/**"}}))
+	got, err := os.ReadFile(filepath.Join(selectiveDir, "sub", "c.bin"))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(data, got))
+	require.NoFileExists(t, filepath.Join(selectiveDir, "a.bin"))
+
+	var buf bytes.Buffer
+	require.NoError(t, manager.ExtractFile(backupFile, "sub/c.bin", "", &buf))
+	require.True(t, bytes.Equal(data, buf.Bytes()))
+
+	var tarBuf bytes.Buffer
+	require.NoError(t, manager.ExportTar(backupFile, "", &tarBuf))
+	tr := tar.NewReader(&tarBuf)
+	links := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if hdr.Typeflag == tar.TypeLink {
+			links[hdr.Name] = hdr.Linkname
+		}
+	}
+	require.Len(t, links, 2)
+}
@@ -0,0 +1,260 @@
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// 归档格式版本。v1 的条目头部是 [uint32 长度][JSON]；v2 的明文流以 "QAR2" 开头，
+// 条目头部是 [uvarint 长度][二进制头部]，路径只保存与上一个条目路径不同的后缀。
+const (
+	archiveVersion1 = 1
+	archiveVersion2 = 2
+)
+
+var archiveMagicV2 = []byte("QAR2")
+
+// v2 头部的标志位，决定哪些可选字段存在
+const (
+	headerFlagDir uint16 = 1 << iota
+	headerFlagLink
+	headerFlagCRC
+	headerFlagDeleted
+	headerFlagSparse
+	headerFlagLinkDest
+	headerFlagHardLink
+	headerFlagOwner
+	headerFlagDevice
+	headerFlagXattrs
+	headerFlagSHA256
+	headerFlagCompression
+)
+
+// v2 头部布局:
+//
+//	flags       uint16
+//	prefixLen   uvarint  与上一个条目路径相同的前缀长度
+//	suffix      uvarint 长度 + 字节
+//	mode        uint32
+//	modTime     int64 秒 + uint32 纳秒
+//	size        uvarint
+//	可选字段按标志位顺序: linkDest、hardLink、owner、device、xattrs、extents、compression
+//
+// headerFlagSHA256 不对应头部中的字段: 内容哈希在写入数据的同时计算，作为 32 字节的尾部跟在 CRC32 之后。
+// 头部在数据之前写入，而压缩、加密后的输出流无法回头修改已写入的头部，把哈希放进头部就必须在归档前
+// 额外读一遍文件，文件在两次读取之间变化时头部中的哈希也与数据不符。与 CRC32 一样放在尾部只需读一次。
+//
+// 归档内部条目 (.qbakmeta/) 总是保存完整路径，也不作为下一个条目的前缀基准，
+// 因此借助索引从任意条目开始读取时，只需要知道索引中上一个条目的路径。
+func encodeHeaderV2(meta *FileMetadata, prevPath string) []byte {
+	var flags uint16
+	setFlag := func(cond bool, flag uint16) {
+		if cond {
+			flags |= flag
+		}
+	}
+	setFlag(meta.IsDir, headerFlagDir)
+	setFlag(meta.IsLink, headerFlagLink)
+	setFlag(meta.HasCRC, headerFlagCRC)
+	setFlag(meta.Deleted, headerFlagDeleted)
+	setFlag(meta.Sparse, headerFlagSparse)
+	setFlag(meta.LinkDest != "", headerFlagLinkDest)
+	setFlag(meta.HardLink != "", headerFlagHardLink)
+	setFlag(meta.Owner != nil, headerFlagOwner)
+	setFlag(meta.DevMajor != 0 || meta.DevMinor != 0, headerFlagDevice)
+	setFlag(len(meta.Xattrs) > 0, headerFlagXattrs)
+	setFlag(meta.hashed, headerFlagSHA256)
+	setFlag(meta.Compression != "", headerFlagCompression)
+
+	prefix := 0
+	if !isInternalPath(meta.Path) {
+		prefix = commonPrefixLen(prevPath, meta.Path)
+	}
+
+	buf := make([]byte, 0, 64+len(meta.Path)-prefix)
+	buf = binary.BigEndian.AppendUint16(buf, flags)
+	buf = binary.AppendUvarint(buf, uint64(prefix))
+	buf = appendHeaderString(buf, meta.Path[prefix:])
+	buf = binary.BigEndian.AppendUint32(buf, uint32(meta.Mode))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(meta.ModTime.Unix()))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(meta.ModTime.Nanosecond()))
+	buf = binary.AppendUvarint(buf, uint64(meta.Size))
+
+	if flags&headerFlagLinkDest != 0 {
+		buf = appendHeaderString(buf, meta.LinkDest)
+	}
+	if flags&headerFlagHardLink != 0 {
+		buf = appendHeaderString(buf, meta.HardLink)
+	}
+	if flags&headerFlagOwner != 0 {
+		buf = binary.AppendUvarint(buf, uint64(meta.Owner.UID))
+		buf = binary.AppendUvarint(buf, uint64(meta.Owner.GID))
+		buf = appendHeaderString(buf, meta.Owner.User)
+		buf = appendHeaderString(buf, meta.Owner.Group)
+	}
+	if flags&headerFlagDevice != 0 {
+		buf = binary.AppendUvarint(buf, uint64(meta.DevMajor))
+		buf = binary.AppendUvarint(buf, uint64(meta.DevMinor))
+	}
+	if flags&headerFlagXattrs != 0 {
+		names := make([]string, 0, len(meta.Xattrs))
+		for name := range meta.Xattrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		buf = binary.AppendUvarint(buf, uint64(len(names)))
+		for _, name := range names {
+			buf = appendHeaderString(buf, name)
+			buf = appendHeaderString(buf, string(meta.Xattrs[name]))
+		}
+	}
+	if flags&headerFlagSparse != 0 {
+		buf = binary.AppendUvarint(buf, uint64(len(meta.Extents)))
+		for _, e := range meta.Extents {
+			buf = binary.AppendUvarint(buf, uint64(e.Offset))
+			buf = binary.AppendUvarint(buf, uint64(e.Length))
+		}
+	}
+	if flags&headerFlagCompression != 0 {
+		buf = appendHeaderString(buf, meta.Compression)
+	}
+	return buf
+}
+
+func appendHeaderString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func commonPrefixLen(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// headerDecoder 顺序读取 v2 头部字段，遇到第一个错误后停止
+type headerDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *headerDecoder) fail() {
+	if d.err == nil {
+		d.err = io.ErrUnexpectedEOF
+	}
+	d.buf = nil
+}
+
+func (d *headerDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *headerDecoder) fixed(n int) []byte {
+	if len(d.buf) < n {
+		d.fail()
+		return make([]byte, n)
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *headerDecoder) str() string {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.fail()
+		return ""
+	}
+	return string(d.fixed(int(n)))
+}
+
+// count 读取列表长度，并确认剩余字节至少能容纳 count*minItemLen 字节，避免恶意长度导致大量分配
+func (d *headerDecoder) count(minItemLen int) int {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)/minItemLen) {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func decodeHeaderV2(buf []byte, prevPath string) (*FileMetadata, error) {
+	d := &headerDecoder{buf: buf}
+	flags := binary.BigEndian.Uint16(d.fixed(2))
+
+	prefix := d.uvarint()
+	if prefix > uint64(len(prevPath)) {
+		return nil, fmt.Errorf("invalid path prefix length %d", prefix)
+	}
+	meta := &FileMetadata{
+		Path:    prevPath[:prefix] + d.str(),
+		Mode:    os.FileMode(binary.BigEndian.Uint32(d.fixed(4))),
+		IsDir:   flags&headerFlagDir != 0,
+		IsLink:  flags&headerFlagLink != 0,
+		HasCRC:  flags&headerFlagCRC != 0,
+		Deleted: flags&headerFlagDeleted != 0,
+		Sparse:  flags&headerFlagSparse != 0,
+		hashed:  flags&headerFlagSHA256 != 0,
+	}
+	sec := int64(binary.BigEndian.Uint64(d.fixed(8)))
+	nsec := int64(binary.BigEndian.Uint32(d.fixed(4)))
+	meta.ModTime = time.Unix(sec, nsec)
+	meta.Size = int64(d.uvarint())
+
+	if flags&headerFlagLinkDest != 0 {
+		meta.LinkDest = d.str()
+	}
+	if flags&headerFlagHardLink != 0 {
+		meta.HardLink = d.str()
+	}
+	if flags&headerFlagOwner != 0 {
+		meta.Owner = &FileOwner{UID: int(d.uvarint()), GID: int(d.uvarint())}
+		meta.Owner.User = d.str()
+		meta.Owner.Group = d.str()
+	}
+	if flags&headerFlagDevice != 0 {
+		meta.DevMajor = uint32(d.uvarint())
+		meta.DevMinor = uint32(d.uvarint())
+	}
+	if flags&headerFlagXattrs != 0 {
+		n := d.count(2)
+		meta.Xattrs = make(map[string][]byte, n)
+		for i := 0; i < n; i++ {
+			name := d.str()
+			meta.Xattrs[name] = []byte(d.str())
+		}
+	}
+	if flags&headerFlagSparse != 0 {
+		n := d.count(2)
+		meta.Extents = make([]SparseExtent, n)
+		for i := range meta.Extents {
+			meta.Extents[i] = SparseExtent{Offset: int64(d.uvarint()), Length: int64(d.uvarint())}
+		}
+	}
+	if flags&headerFlagCompression != 0 {
+		meta.Compression = d.str()
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("truncated entry header: %w", d.err)
+	}
+	if len(d.buf) > 0 {
+		return nil, fmt.Errorf("entry header has %d unexpected trailing bytes", len(d.buf))
+	}
+	if meta.Size < 0 {
+		return nil, fmt.Errorf("invalid entry size for %s: %d", meta.Path, meta.Size)
+	}
+	return meta, nil
+}
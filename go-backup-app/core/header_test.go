@@ -0,0 +1,93 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderV2_RoundTrip(t *testing.T) {
+	meta := FileMetadata{
+		Path:     "dir/sub/file.bin",
+		Size:     1 << 40,
+		Mode:     os.ModeSetuid | 0755,
+		ModTime:  time.Date(2021, 5, 6, 7, 8, 9, 123456789, time.UTC),
+		HasCRC:   true,
+		LinkDest: "../target",
+		HardLink: "dir/other.bin",
+		Xattrs:   map[string][]byte{"user.a": {0, 1, 2}, "security.selinux": []byte("ctx")},
+		Owner:    &FileOwner{UID: 1000, GID: 100, User: "alice", Group: "users"},
+		DevMajor: 8,
+		DevMinor: 1,
+		Sparse:   true,
+		Extents:  []SparseExtent{{Offset: 0, Length: 10}, {Offset: 1 << 30, Length: 5}},
+		hashed:   true,
+
+		Compression: CodecStore,
+	}
+
+	encoded := encodeHeaderV2(&meta, "dir/sub/aaa")
+	decoded, err := decodeHeaderV2(encoded, "dir/sub/aaa")
+	require.NoError(t, err)
+	require.True(t, meta.ModTime.Equal(decoded.ModTime))
+	decoded.ModTime = meta.ModTime
+	require.Equal(t, meta, *decoded)
+
+	_, err = decodeHeaderV2(encoded[:len(encoded)-3], "dir/sub/aaa")
+	require.Error(t, err)
+	_, err = decodeHeaderV2(encoded, "")
+	require.Error(t, err, "prefix longer than the previous path")
+}
+
+// writeTestArchive 用指定的格式版本写入一个没有压缩和加密的归档
+func writeTestArchive(t *testing.T, path string, version int, count int) {
+	var buf bytes.Buffer
+	aw := NewArchiveWriter(&buf)
+	aw.version = version
+	buffer := make([]byte, 4096)
+	require.NoError(t, aw.WriteEntry(FileMetadata{Path: "project", Mode: os.ModeDir | 0755, IsDir: true, ModTime: time.Now()}, nil, buffer, nil))
+	for i := 0; i < count; i++ {
+		data := []byte(fmt.Sprintf("content %d", i))
+		meta := FileMetadata{Path: fmt.Sprintf("project/src/file_%04d.go", i), Size: int64(len(data)), Mode: 0644, ModTime: time.Now(), HasCRC: true}
+		require.NoError(t, aw.WriteEntry(meta, bytes.NewReader(data), buffer, nil))
+	}
+	require.NoError(t, aw.WriteIndex())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+}
+
+func TestArchiveVersions_ReadBoth(t *testing.T) {
+	tempDir := t.TempDir()
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	sizes := map[int]int64{}
+	for _, version := range []int{archiveVersion1, archiveVersion2} {
+		backupFile := filepath.Join(tempDir, fmt.Sprintf("v%d.qbak", version))
+		writeTestArchive(t, backupFile, version, 200)
+		info, err := os.Stat(backupFile)
+		require.NoError(t, err)
+		sizes[version] = info.Size()
+
+		restoreDir := filepath.Join(tempDir, fmt.Sprintf("restore-v%d", version))
+		require.NoError(t, manager.Restore(backupFile, restoreDir, ""))
+		got, err := os.ReadFile(filepath.Join(restoreDir, "project", "src", "file_0123.go"))
+		require.NoError(t, err)
+		require.Equal(t, "content 123", string(got))
+
+		// 通过索引随机读取时需要还原路径前缀
+		var out bytes.Buffer
+		require.NoError(t, manager.ExtractFile(backupFile, "project/src/file_0199.go", "", &out))
+		require.Equal(t, "content 199", out.String())
+
+		root, err := manager.ListBackup(backupFile, "")
+		require.NoError(t, err)
+		require.NotNil(t, findNode(root, "project/src/file_0000.go"))
+	}
+	require.Less(t, sizes[archiveVersion2]*2, sizes[archiveVersion1], "binary headers should be much smaller than JSON headers")
+}
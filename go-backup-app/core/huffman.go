@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"runtime"
 	"sort"
 	"sync"
@@ -128,11 +129,31 @@ func (bw *bitWriter) Flush() error {
 var huffmanMagic = []byte("HUFF") // 标识流的开始
 var chunkMagic = []byte("HCHK")   // 标识每个块
 
+// 流末尾的块索引: "HIDX" + uint32 块数 + 每块 (uint64 块头偏移, uint32 压缩长度, uint32 原始长度)
+// + uint64 索引偏移 + "HEND"。
+// 流式读取遇到 "HIDX" 即视为结束；随机访问则从末尾的 "HEND" 反向定位索引。
+var chunkIndexMagic = []byte("HIDX")
+var chunkIndexEndMagic = []byte("HEND")
+
 const (
 	// 定义压缩块的大小
-	huffmanChunkSize = 256 * 1024 // 256 KB
-	maxHuffmanChunkLen = 4 * 1024 * 1024
+	huffmanChunkSize    = 256 * 1024 // 256 KB
+	maxHuffmanChunkLen  = 4 * 1024 * 1024
 	maxHuffmanHeaderLen = 4096
+	chunkIndexEntryLen  = 8 + 4 + 4
+
+	// chunkFlagStored 是块数据开头 uint64 原始长度的最高位，标记直接保存原始数据而没有压缩的块。
+	// JPEG、视频、压缩包等不可压缩的数据按原样保存，避免压缩后反而变大。
+	chunkFlagStored uint64 = 1 << 63
+	// chunkFlagCanonical 标记范式 Huffman 格式的块: 原始长度之后是 256 个 4 bit 码长和位流。
+	// 没有该标记的是旧版本格式: 频率表长度 + 频率表 + 位流。
+	chunkFlagCanonical uint64 = 1 << 62
+	// chunkFlagsMask 是原始长度字段中保留给块标记的最高字节
+	chunkFlagsMask      uint64 = 0xFF << 56
+	huffmanCodeTableLen        = 256 / 2
+	// huffmanEntropyLimit: 零阶熵 (bit/字节) 不低于该值的块不做 Huffman 编码。
+	// 零阶熵是 Huffman 编码长度的下界，达到 7.9 时最多节省约 1%，还不够抵消频率表。
+	huffmanEntropyLimit = 7.9
 )
 
 var (
@@ -142,15 +163,25 @@ var (
 
 // huffmanJob 包含一个待压缩的数据块
 type huffmanJob struct {
-	id   int
-	data []byte
+	id     int
+	data   []byte
+	stored bool // 按原样保存而不压缩
 }
 
 // huffmanResult 包含一个已压缩的数据块
 type huffmanResult struct {
-	id   int
-	data []byte
-	err  error
+	id     int
+	data   []byte
+	rawLen int
+	err    error
+}
+
+// huffmanChunkRef 描述一个压缩块在流中的位置以及它解压后覆盖的原始数据范围
+type huffmanChunkRef struct {
+	rawOffset  int64
+	rawLen     int64
+	dataOffset int64 // 块数据 (不含 magic 与长度) 在压缩流中的偏移
+	dataLen    int64
 }
 
 type huffmanWriter struct {
@@ -167,14 +198,29 @@ type huffmanWriter struct {
 
 	nextID int
 	closed atomic.Bool // <<-- 重入保护
+
+	offset int64             // 已写入底层 writer 的字节数 (仅由 resultWriter 修改)
+	chunks []huffmanChunkRef // 已写入的块，用于在 Close 时生成块索引
+
+	compress     func([]byte) ([]byte, error) // 压缩单个块，结果以 uint64 原始长度开头
+	entropyLimit float64                      // 大于 0 时，熵不低于该值的块不尝试压缩
+	stored       bool                         // setStored 设置，之后写入的块按原样保存
 }
 
 func NewCompressedWriter(w io.WriteCloser) io.WriteCloser {
+	return newChunkWriter(w, huffmanMagic, compressChunk, huffmanEntropyLimit)
+}
+
+// newChunkWriter 返回按 HCHK 分块格式并行压缩的 writer，magic 为空时不写入流开头的魔术字 (由编解码器流头代替)。
+// entropyLimit 大于 0 时，零阶熵不低于它的块直接保存而不尝试压缩。
+func newChunkWriter(w io.WriteCloser, magic []byte, compress func([]byte) ([]byte, error), entropyLimit float64) *huffmanWriter {
 	hw := &huffmanWriter{
-		w:       w,
-		buffer:  bytes.NewBuffer(make([]byte, 0, huffmanChunkSize)),
-		jobs:    make(chan huffmanJob, huffmanCompressionWorkers),
-		results: make(chan huffmanResult, huffmanCompressionWorkers),
+		w:            w,
+		buffer:       bytes.NewBuffer(make([]byte, 0, huffmanChunkSize)),
+		jobs:         make(chan huffmanJob, huffmanCompressionWorkers),
+		results:      make(chan huffmanResult, huffmanCompressionWorkers),
+		compress:     compress,
+		entropyLimit: entropyLimit,
 	}
 
 	// 启动结果写入器
@@ -187,9 +233,12 @@ func NewCompressedWriter(w io.WriteCloser) io.WriteCloser {
 		go hw.compressWorker()
 	}
 
-	if _, err := hw.w.Write(huffmanMagic); err != nil {
-		hw.setError(err)
+	if len(magic) > 0 {
+		if _, err := hw.w.Write(magic); err != nil {
+			hw.setError(err)
+		}
 	}
+	hw.offset = int64(len(magic))
 	return hw
 }
 
@@ -197,13 +246,19 @@ func NewCompressedWriter(w io.WriteCloser) io.WriteCloser {
 func (hw *huffmanWriter) compressWorker() {
 	defer hw.wg.Done()
 	for job := range hw.jobs {
-		compressedData, err := compressChunk(job.data)
+		var compressedData []byte
+		var err error
+		if job.stored && len(job.data) > 0 {
+			compressedData = storedChunk(job.data)
+		} else {
+			compressedData, err = hw.encodeChunk(job.data)
+		}
 		if err != nil {
 			hw.setError(err)
 			hw.results <- huffmanResult{id: job.id, err: err}
 			return
 		}
-		hw.results <- huffmanResult{id: job.id, data: compressedData}
+		hw.results <- huffmanResult{id: job.id, data: compressedData, rawLen: len(job.data)}
 	}
 }
 
@@ -211,7 +266,7 @@ func (hw *huffmanWriter) compressWorker() {
 func (hw *huffmanWriter) resultWriter() {
 	defer hw.writerWg.Done()
 
-	pending := make(map[int][]byte)
+	pending := make(map[int]huffmanResult)
 	nextID := 0
 	for result := range hw.results {
 		if result.err != nil {
@@ -219,14 +274,15 @@ func (hw *huffmanWriter) resultWriter() {
 			continue // 继续处理以清空通道，防止 worker 阻塞
 		}
 
-		pending[result.id] = result.data
+		pending[result.id] = result
 
 		// 尝试按顺序写入
 		for {
-			data, ok := pending[nextID]
+			res, ok := pending[nextID]
 			if !ok {
 				break // 下一个块还没到
 			}
+			data := res.data
 			// 写入块魔术字
 			if _, err := hw.w.Write(chunkMagic); err != nil {
 				hw.setError(err)
@@ -242,14 +298,97 @@ func (hw *huffmanWriter) resultWriter() {
 				hw.setError(err)
 				return
 			}
+			if res.rawLen > 0 {
+				hw.chunks = append(hw.chunks, huffmanChunkRef{
+					dataOffset: hw.offset + int64(len(chunkMagic)+4),
+					dataLen:    int64(len(data)),
+					rawLen:     int64(res.rawLen),
+				})
+			}
+			hw.offset += int64(len(chunkMagic)+4) + int64(len(data))
 			delete(pending, nextID)
 			nextID++
 		}
 	}
 }
 
-// compressChunk 压缩单个数据块
+// encodeChunk 压缩单个块；块的熵达到 entropyLimit 或者压缩后不比原始数据小时，改为保存原始数据
+func (hw *huffmanWriter) encodeChunk(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return hw.compress(data)
+	}
+	if hw.entropyLimit <= 0 || byteEntropy(data) < hw.entropyLimit {
+		compressed, err := hw.compress(data)
+		if err != nil || len(compressed) < len(data)+8 {
+			return compressed, err
+		}
+	}
+	return storedChunk(data), nil
+}
+
+// storedChunk 返回按原样保存 data 的块
+func storedChunk(data []byte) []byte {
+	out := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(out, uint64(len(data))|chunkFlagStored)
+	return append(out, data...)
+}
+
+// withStoredChunks 包装块的解压函数，使其同时支持带 chunkFlagStored 的块
+func withStoredChunks(decompress func([]byte) ([]byte, error)) func([]byte) ([]byte, error) {
+	return func(chunkData []byte) ([]byte, error) {
+		if len(chunkData) < 8 || binary.BigEndian.Uint64(chunkData)&chunkFlagStored == 0 {
+			return decompress(chunkData)
+		}
+		originalLen := binary.BigEndian.Uint64(chunkData) &^ chunkFlagStored
+		if originalLen > huffmanChunkSize || originalLen != uint64(len(chunkData)-8) {
+			return nil, fmt.Errorf("invalid stored chunk length: %d", originalLen)
+		}
+		// 调用方可能复用 chunkData 的缓冲区
+		return append([]byte(nil), chunkData[8:]...), nil
+	}
+}
+
+// byteEntropy 返回 data 的零阶熵 (bit/字节)
+func byteEntropy(data []byte) float64 {
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	n := float64(len(data))
+	entropy := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / n
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+// compressChunk 把单个数据块编码为范式 Huffman 格式
 func compressChunk(originalData []byte) ([]byte, error) {
+	if len(originalData) == 0 {
+		return []byte{}, nil
+	}
+
+	var freqs [256]int64
+	for _, b := range originalData {
+		freqs[b]++
+	}
+	lengths := huffmanCodeLengths(freqs[:], maxCodeLen)
+	var codes [256]uint32
+	packCodes(codes[:], lengths)
+
+	out := make([]byte, 8, 8+huffmanCodeTableLen+len(originalData))
+	binary.BigEndian.PutUint64(out, uint64(len(originalData))|chunkFlagCanonical)
+	bw := bitPacker{buf: appendCodeLengths(out, lengths)}
+	bw.writeBytes(&codes, originalData)
+	return bw.flush(), nil
+}
+
+// compressChunkV1 按旧版本格式 (频率表 + 逐位遍历编码树) 压缩单个数据块。
+// 新备份不再使用这种格式，保留它用于验证旧备份仍然可以读取。
+func compressChunkV1(originalData []byte) ([]byte, error) {
 	originalLen := uint64(len(originalData))
 	if originalLen == 0 {
 		return []byte{}, nil
@@ -349,12 +488,25 @@ func (hw *huffmanWriter) flush(final bool) error {
 	copy(dataToCompress, hw.buffer.Bytes())
 	hw.buffer.Reset()
 
-	hw.jobs <- huffmanJob{id: hw.nextID, data: dataToCompress}
+	hw.jobs <- huffmanJob{id: hw.nextID, data: dataToCompress, stored: hw.stored}
 	hw.nextID++
 
 	return nil
 }
 
+// setStored 切换之后写入的数据是否按原样保存。切换时先结束当前的块，
+// 因此一个块中的数据要么全部压缩、要么全部按原样保存，读取时不需要额外的信息。
+func (hw *huffmanWriter) setStored(stored bool) error {
+	if stored == hw.stored {
+		return nil
+	}
+	if err := hw.flush(false); err != nil {
+		return err
+	}
+	hw.stored = stored
+	return nil
+}
+
 func serializeFreqTable(freqTable map[byte]int64) ([]byte, error) {
 	var buf bytes.Buffer
 
@@ -408,9 +560,30 @@ func (hw *huffmanWriter) Close() error {
 	// 等待 resultWriter 完成
 	hw.writerWg.Wait()
 
+	if hw.err == nil {
+		hw.setError(hw.writeChunkIndex())
+	}
+
 	return hw.err
 }
 
+// writeChunkIndex 在流末尾写入块索引，供随机访问时定位块
+func (hw *huffmanWriter) writeChunkIndex() error {
+	buf := make([]byte, 0, len(chunkIndexMagic)+4+len(hw.chunks)*chunkIndexEntryLen+8+len(chunkIndexEndMagic))
+	buf = append(buf, chunkIndexMagic...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(hw.chunks)))
+	for _, c := range hw.chunks {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(c.dataOffset-int64(len(chunkMagic)+4)))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(c.dataLen))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(c.rawLen))
+	}
+	buf = binary.BigEndian.AppendUint64(buf, uint64(hw.offset))
+	buf = append(buf, chunkIndexEndMagic...)
+
+	_, err := hw.w.Write(buf)
+	return err
+}
+
 // --- huffmanReader ---
 var ErrNotCompressed = errors.New("not a huffman compressed file")
 var ErrWriterClosed = errors.New("huffman writer is closed")
@@ -499,7 +672,12 @@ func NewParallelCompressedReader(r io.Reader) (io.ReadCloser, error) {
 	if !bytes.Equal(magic, huffmanMagic) {
 		return nil, ErrNotCompressed
 	}
+	return newChunkReader(r, decompressChunk), nil
+}
 
+// newChunkReader 并行解压 HCHK 分块格式的流，r 位于第一个块之前
+func newChunkReader(r io.Reader, decompress func([]byte) ([]byte, error)) io.ReadCloser {
+	decompress = withStoredChunks(decompress)
 	pr, pw := io.Pipe()
 
 	go func() {
@@ -532,7 +710,7 @@ func NewParallelCompressedReader(r io.Reader) (io.ReadCloser, error) {
 						if !ok {
 							return
 						}
-						decompressed, err := decompressChunk(j.data)
+						decompressed, err := decompress(j.data)
 						select {
 						case results <- decompressResult{id: j.id, data: decompressed, err: err}:
 						case <-ctx.Done():
@@ -567,6 +745,9 @@ func NewParallelCompressedReader(r io.Reader) (io.ReadCloser, error) {
 					return
 				}
 
+				if bytes.Equal(chunkHeader[:len(chunkIndexMagic)], chunkIndexMagic) {
+					return // 块索引位于流末尾
+				}
 				if !bytes.Equal(chunkHeader[:len(chunkMagic)], chunkMagic) {
 					pipelineErr = fmt.Errorf("invalid huffman chunk magic")
 					cancel()
@@ -639,11 +820,14 @@ func NewParallelCompressedReader(r io.Reader) (io.ReadCloser, error) {
 		}
 	}()
 
-	return pr, nil
+	return pr
 }
 
-// decompressChunk 将单个压缩数据块解压为原始数据
+// decompressChunk 将单个压缩数据块解压为原始数据，支持范式 Huffman 格式和旧版本格式
 func decompressChunk(chunkData []byte) ([]byte, error) {
+	if len(chunkData) >= 8 && binary.BigEndian.Uint64(chunkData)&chunkFlagCanonical != 0 {
+		return decompressCanonicalChunk(chunkData)
+	}
 	chunkReader := bytes.NewReader(chunkData)
 
 	var originalLen uint64
@@ -700,6 +884,33 @@ func decompressChunk(chunkData []byte) ([]byte, error) {
 	return out, nil
 }
 
+// decompressCanonicalChunk 用查找表解码范式 Huffman 格式的块
+func decompressCanonicalChunk(chunkData []byte) ([]byte, error) {
+	originalLen := binary.BigEndian.Uint64(chunkData) &^ chunkFlagsMask
+	if originalLen > uint64(huffmanChunkSize) || binary.BigEndian.Uint64(chunkData)&chunkFlagsMask != chunkFlagCanonical {
+		return nil, fmt.Errorf("invalid huffman chunk header: %#x", binary.BigEndian.Uint64(chunkData))
+	}
+	if len(chunkData) < 8+huffmanCodeTableLen {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	dec, err := newHuffmanDecoder(readCodeLengths(chunkData[8 : 8+huffmanCodeTableLen]))
+	if err != nil {
+		return nil, err
+	}
+
+	br := bitUnpacker{data: chunkData[8+huffmanCodeTableLen:]}
+	out := make([]byte, originalLen)
+	for i := range out {
+		sym, err := dec.decode(&br)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = byte(sym)
+	}
+	return out, nil
+}
+
 func (hr *huffmanReader) Read(p []byte) (n int, err error) {
 	// 首先从缓冲区读取
 	if hr.buffer.Len() > 0 {
@@ -722,6 +933,9 @@ func (hr *huffmanReader) decompressNextChunk() error {
 	if _, err := io.ReadFull(hr.r, magic); err != nil {
 		return err // 可能是 EOF，表示流结束
 	}
+	if bytes.Equal(magic, chunkIndexMagic) {
+		return io.EOF
+	}
 	if !bytes.Equal(magic, chunkMagic) {
 		return fmt.Errorf("invalid huffman chunk magic")
 	}
@@ -803,3 +1017,325 @@ func (hr *huffmanReader) decompressNextChunk() error {
 
 	return nil
 }
+
+// --- 随机访问解压 ---
+
+// huffmanReaderAt 在压缩流上提供随机访问：先根据块索引定位目标块，再只解压需要的块。
+type huffmanReaderAt struct {
+	r          io.ReaderAt
+	chunks     []huffmanChunkRef
+	size       int64
+	decompress func([]byte) ([]byte, error)
+
+	mu       sync.Mutex
+	cacheIdx int
+	cache    []byte
+}
+
+// newHuffmanReaderAt 从压缩流 (起始为 "HUFF") 建立块表。优先读取流末尾的块索引，
+// 旧版本的流没有索引时回退为逐个读取块头，仍然不需要解压任何数据。
+func newHuffmanReaderAt(r io.ReaderAt, size int64) (*huffmanReaderAt, error) {
+	magic := make([]byte, len(huffmanMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil || !bytes.Equal(magic, huffmanMagic) {
+		return nil, ErrNotCompressed
+	}
+	return newChunkReaderAt(r, size, int64(len(huffmanMagic)), decompressChunk)
+}
+
+// newChunkReaderAt 在 HCHK 分块格式的流上建立块表，第一个块位于 start
+func newChunkReaderAt(r io.ReaderAt, size, start int64, decompress func([]byte) ([]byte, error)) (*huffmanReaderAt, error) {
+	chunks, err := readChunkIndex(r, size, start)
+	if err != nil {
+		return nil, err
+	}
+	if chunks == nil {
+		chunks, err = scanChunkHeaders(r, size, start)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var rawOffset int64
+	for i := range chunks {
+		chunks[i].rawOffset = rawOffset
+		rawOffset += chunks[i].rawLen
+	}
+
+	return &huffmanReaderAt{r: r, chunks: chunks, size: rawOffset, decompress: withStoredChunks(decompress), cacheIdx: -1}, nil
+}
+
+// readChunkIndex 读取流末尾的块索引；不存在索引时返回 nil, nil
+func readChunkIndex(r io.ReaderAt, size, start int64) ([]huffmanChunkRef, error) {
+	footerLen := int64(8 + len(chunkIndexEndMagic))
+	if size < start+footerLen {
+		return nil, nil
+	}
+	footer := make([]byte, footerLen)
+	if _, err := r.ReadAt(footer, size-footerLen); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(footer[8:], chunkIndexEndMagic) {
+		return nil, nil
+	}
+
+	indexOffset := int64(binary.BigEndian.Uint64(footer[:8]))
+	if indexOffset < start || indexOffset > size-footerLen-int64(len(chunkIndexMagic)+4) {
+		return nil, fmt.Errorf("invalid huffman chunk index offset: %d", indexOffset)
+	}
+	head := make([]byte, len(chunkIndexMagic)+4)
+	if _, err := r.ReadAt(head, indexOffset); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(head[:len(chunkIndexMagic)], chunkIndexMagic) {
+		return nil, fmt.Errorf("invalid huffman chunk index magic")
+	}
+	count := int64(binary.BigEndian.Uint32(head[len(chunkIndexMagic):]))
+	tableOffset := indexOffset + int64(len(head))
+	if tableOffset+count*chunkIndexEntryLen != size-footerLen {
+		return nil, fmt.Errorf("invalid huffman chunk index size: %d chunks", count)
+	}
+
+	table := make([]byte, count*chunkIndexEntryLen)
+	if _, err := r.ReadAt(table, tableOffset); err != nil {
+		return nil, err
+	}
+	chunks := make([]huffmanChunkRef, 0, count)
+	for i := int64(0); i < count; i++ {
+		entry := table[i*chunkIndexEntryLen : (i+1)*chunkIndexEntryLen]
+		dataLen := int64(binary.BigEndian.Uint32(entry[8:12]))
+		rawLen := int64(binary.BigEndian.Uint32(entry[12:16]))
+		if dataLen > maxHuffmanChunkLen || rawLen > huffmanChunkSize {
+			return nil, fmt.Errorf("invalid huffman chunk index entry %d", i)
+		}
+		chunks = append(chunks, huffmanChunkRef{
+			dataOffset: int64(binary.BigEndian.Uint64(entry[:8])) + int64(len(chunkMagic)+4),
+			dataLen:    dataLen,
+			rawLen:     rawLen,
+		})
+	}
+	return chunks, nil
+}
+
+// scanChunkHeaders 依次读取每个块头及其原始长度，用于没有块索引的旧版本流
+func scanChunkHeaders(r io.ReaderAt, size, start int64) ([]huffmanChunkRef, error) {
+	var chunks []huffmanChunkRef
+	header := make([]byte, len(chunkMagic)+4+8) // magic + len + originalLen
+	pos := start
+	for pos < size {
+		n, err := r.ReadAt(header, pos)
+		if n < len(chunkMagic)+4 {
+			if err == io.EOF && n == 0 {
+				break
+			}
+			return nil, fmt.Errorf("failed to read huffman chunk header: %w", io.ErrUnexpectedEOF)
+		}
+		if bytes.Equal(header[:len(chunkIndexMagic)], chunkIndexMagic) {
+			break
+		}
+		if !bytes.Equal(header[:len(chunkMagic)], chunkMagic) {
+			return nil, fmt.Errorf("invalid huffman chunk magic")
+		}
+		chunkLen := int64(binary.BigEndian.Uint32(header[len(chunkMagic):]))
+		if chunkLen == 0 {
+			break
+		}
+		if chunkLen > maxHuffmanChunkLen || n < len(header) {
+			return nil, fmt.Errorf("invalid huffman chunk at offset %d", pos)
+		}
+		rawLen := int64(binary.BigEndian.Uint64(header[len(chunkMagic)+4:]) &^ chunkFlagsMask)
+		if rawLen > huffmanChunkSize {
+			return nil, fmt.Errorf("invalid huffman original length: %d", rawLen)
+		}
+		if rawLen > 0 {
+			chunks = append(chunks, huffmanChunkRef{
+				dataOffset: pos + int64(len(chunkMagic)+4),
+				dataLen:    chunkLen,
+				rawLen:     rawLen,
+			})
+		}
+		pos += int64(len(chunkMagic)+4) + chunkLen
+	}
+	return chunks, nil
+}
+
+func (hr *huffmanReaderAt) Size() int64 { return hr.size }
+
+// chunk 返回第 idx 个块解压后的数据，最近使用的块会被缓存
+func (hr *huffmanReaderAt) chunk(idx int) ([]byte, error) {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	if hr.cacheIdx == idx {
+		return hr.cache, nil
+	}
+
+	ref := hr.chunks[idx]
+	headerLen := int64(len(chunkMagic) + 4)
+	buf := make([]byte, headerLen+ref.dataLen)
+	if _, err := hr.r.ReadAt(buf, ref.dataOffset-headerLen); err != nil {
+		return nil, fmt.Errorf("failed to read huffman chunk data: %w", err)
+	}
+	if !bytes.Equal(buf[:len(chunkMagic)], chunkMagic) || int64(binary.BigEndian.Uint32(buf[len(chunkMagic):headerLen])) != ref.dataLen {
+		return nil, fmt.Errorf("huffman chunk index does not match chunk header at offset %d", ref.dataOffset-headerLen)
+	}
+	decompressed, err := hr.decompress(buf[headerLen:])
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decompressed)) != ref.rawLen {
+		return nil, fmt.Errorf("huffman chunk length mismatch: expected %d, got %d", ref.rawLen, len(decompressed))
+	}
+	hr.cacheIdx = idx
+	hr.cache = decompressed
+	return decompressed, nil
+}
+
+func (hr *huffmanReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("huffmanReaderAt: negative offset %d", off)
+	}
+	if off >= hr.size {
+		return 0, io.EOF
+	}
+
+	idx := sort.Search(len(hr.chunks), func(i int) bool {
+		return hr.chunks[i].rawOffset+hr.chunks[i].rawLen > off
+	})
+
+	n := 0
+	for n < len(p) && idx < len(hr.chunks) {
+		data, err := hr.chunk(idx)
+		if err != nil {
+			return n, err
+		}
+		start := off + int64(n) - hr.chunks[idx].rawOffset
+		n += copy(p[n:], data[start:])
+		idx++
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// --- 容错解压 ---
+
+// salvageHuffmanReader 顺序解压 Huffman 流，用于抢救恢复。
+// 遇到无法解压的块时向后查找下一个能够解压的 "HCHK" 块，流被截断时正常结束；
+// 跳过的压缩数据通过 onLoss 报告 (偏移为压缩流中的位置)。
+type salvageHuffmanReader struct {
+	s          *salvageStream
+	pending    []byte
+	done       bool
+	onLoss     func(offset, skipped int64, reason string)
+	decompress func([]byte) ([]byte, error)
+}
+
+// newSalvageChunkReader 容错地顺序解压 HCHK 分块格式的流，base 是 r 当前位置在压缩流中的偏移
+func newSalvageChunkReader(r io.Reader, base int64, decompress func([]byte) ([]byte, error), onLoss func(offset, skipped int64, reason string)) io.ReadCloser {
+	s := newSalvageStream(r, len(chunkMagic)+4+maxHuffmanChunkLen, 0)
+	s.base = base
+	return &salvageHuffmanReader{s: s, onLoss: onLoss, decompress: withStoredChunks(decompress)}
+}
+
+func (hr *salvageHuffmanReader) Read(p []byte) (int, error) {
+	for len(hr.pending) == 0 {
+		if hr.done {
+			return 0, io.EOF
+		}
+		hr.nextChunk()
+	}
+	n := copy(p, hr.pending)
+	hr.pending = hr.pending[n:]
+	return n, nil
+}
+
+func (hr *salvageHuffmanReader) Close() error { return nil }
+
+// nextChunk 解压下一个块；当前位置不是有效的块时跳到下一个能够解压的块
+func (hr *salvageHuffmanReader) nextChunk() {
+	damagedAt := int64(-1)
+	for {
+		at := hr.s.pos()
+		head := hr.s.peek(len(chunkMagic) + 4)
+		if len(head) == 0 {
+			break
+		}
+		// 损坏之后遇到的 "HIDX" 可能只是数据中的巧合，确认它确实是流末尾的块索引
+		if bytes.HasPrefix(head, chunkIndexMagic) && (damagedAt < 0 || hr.atChunkIndex()) {
+			break
+		}
+		if out, n, ok := hr.tryChunk(head); ok {
+			if damagedAt >= 0 {
+				hr.onLoss(damagedAt, at-damagedAt, "damaged compressed data")
+			}
+			hr.s.discard(n)
+			hr.pending = out
+			return
+		}
+		if damagedAt < 0 {
+			damagedAt = at
+		}
+		hr.s.discard(1)
+		hr.skipToMarker()
+	}
+	if damagedAt >= 0 {
+		hr.onLoss(damagedAt, hr.s.pos()-damagedAt, "damaged or truncated compressed data")
+	}
+	hr.done = true
+}
+
+// tryChunk 尝试解压当前位置的块，返回解压结果和块的总长度
+func (hr *salvageHuffmanReader) tryChunk(head []byte) ([]byte, int, bool) {
+	if len(head) < len(chunkMagic)+4 || !bytes.HasPrefix(head, chunkMagic) {
+		return nil, 0, false
+	}
+	chunkLen := binary.BigEndian.Uint32(head[len(chunkMagic):])
+	if chunkLen > maxHuffmanChunkLen {
+		return nil, 0, false
+	}
+	n := len(chunkMagic) + 4 + int(chunkLen)
+	buf := hr.s.peek(n)
+	if len(buf) < n {
+		return nil, 0, false
+	}
+	out, err := hr.decompress(buf[len(chunkMagic)+4:])
+	if err != nil {
+		return nil, 0, false
+	}
+	return out, n, true
+}
+
+// atChunkIndex 判断当前位置是否为完整的块索引，并且索引之后正好是流的末尾
+func (hr *salvageHuffmanReader) atChunkIndex() bool {
+	head := hr.s.peek(len(chunkIndexMagic) + 4)
+	if len(head) < len(chunkIndexMagic)+4 {
+		return false
+	}
+	count := int64(binary.BigEndian.Uint32(head[len(chunkIndexMagic):]))
+	total := int64(len(chunkIndexMagic)+4) + count*chunkIndexEntryLen + 8 + int64(len(chunkIndexEndMagic))
+	if total > maxHuffmanChunkLen {
+		return false
+	}
+	buf := hr.s.peek(int(total) + 1)
+	return int64(len(buf)) == total && bytes.HasSuffix(buf, chunkIndexEndMagic)
+}
+
+// skipToMarker 跳到下一个 "HCHK" 或 "HIDX" 出现的位置，没有找到时跳到流末尾
+func (hr *salvageHuffmanReader) skipToMarker() {
+	for {
+		window := hr.s.peek(64 * 1024)
+		if len(window) < len(chunkMagic) {
+			hr.s.discard(len(window))
+			return
+		}
+		idx := bytes.Index(window, chunkMagic)
+		if i := bytes.Index(window, chunkIndexMagic); i >= 0 && (idx < 0 || i < idx) {
+			idx = i
+		}
+		if idx >= 0 {
+			hr.s.discard(idx)
+			return
+		}
+		hr.s.discard(len(window) - len(chunkMagic) + 1)
+	}
+}
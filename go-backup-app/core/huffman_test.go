@@ -2,8 +2,13 @@ package core
 
 import (
 	"bytes"
+	"encoding/binary"
+	"fmt"
 	"io"
+	"math"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"sync"
@@ -426,3 +431,297 @@ func TestNodeQueue_Less(t *testing.T) {
 		t.Errorf("Got order: %c, %c, %c", pq[0].minChar, pq[1].minChar, pq[2].minChar)
 	}
 }
+
+// TestCompressedWriter_StoredChunks 测试不可压缩的块按原样保存，且与压缩块混合时能正确读取
+func TestCompressedWriter_StoredChunks(t *testing.T) {
+	random := []byte(generateRandomData(huffmanChunkSize))
+	text := bytes.Repeat([]byte("stored chunks are mixed with huffman chunks\n"), huffmanChunkSize/44+1)[:huffmanChunkSize]
+	var input []byte
+	input = append(input, text...)
+	input = append(input, random...)
+	input = append(input, text...)
+	input = append(input, random[:1000]...)
+
+	mockWc := newMockWriteCloser()
+	writer := NewCompressedWriter(mockWc)
+	if _, err := writer.Write(input); err != nil {
+		t.Fatalf("CompressedWriter.Write failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("CompressedWriter.Close failed: %v", err)
+	}
+	compressed := mockWc.Bytes()
+
+	// 随机数据的块不应比原始数据大 (只多出块头)
+	stored := 0
+	for pos := 0; ; {
+		next := bytes.Index(compressed[pos:], chunkMagic)
+		if next < 0 {
+			break
+		}
+		pos += next + len(chunkMagic) + 4
+		if binary.BigEndian.Uint64(compressed[pos:])&chunkFlagStored != 0 {
+			stored++
+		}
+	}
+	if stored != 2 {
+		t.Errorf("Expected 2 stored chunks, got %d", stored)
+	}
+	if len(compressed) >= len(input) {
+		t.Errorf("Compressed size %d is not smaller than the input %d", len(compressed), len(input))
+	}
+
+	reader, err := NewCompressedReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("NewCompressedReader failed: %v", err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("io.ReadAll on decompressed stream failed: %v", err)
+	}
+	if !bytes.Equal(input, decompressed) {
+		t.Errorf("Decompressed data does not match original data")
+	}
+
+	ra, err := newHuffmanReaderAt(bytes.NewReader(compressed), int64(len(compressed)))
+	if err != nil {
+		t.Fatalf("newHuffmanReaderAt failed: %v", err)
+	}
+	buf := make([]byte, 5000)
+	off := int64(len(text) + len(random) - 2500)
+	if _, err := ra.ReadAt(buf, off); err != nil {
+		t.Fatalf("ReadAt failed: %v", err)
+	}
+	if !bytes.Equal(buf, input[off:off+5000]) {
+		t.Errorf("ReadAt across stored and compressed chunks returned wrong data")
+	}
+
+	// 长度与数据不一致的存储块
+	bad := make([]byte, 8+10)
+	binary.BigEndian.PutUint64(bad, 11|chunkFlagStored)
+	if _, err := withStoredChunks(decompressChunk)(bad); err == nil {
+		t.Errorf("Expected error for stored chunk with wrong length")
+	}
+}
+
+// TestByteEntropy 测试熵估计
+func TestByteEntropy(t *testing.T) {
+	if e := byteEntropy(bytes.Repeat([]byte{'a'}, 100)); e != 0 {
+		t.Errorf("Expected entropy 0, got %f", e)
+	}
+	if e := byteEntropy([]byte("abababab")); math.Abs(e-1) > 1e-9 {
+		t.Errorf("Expected entropy 1, got %f", e)
+	}
+	if e := byteEntropy([]byte(generateRandomData(huffmanChunkSize))); e < huffmanEntropyLimit {
+		t.Errorf("Expected random data to exceed the entropy limit, got %f", e)
+	}
+}
+
+// TestDecompressChunk_LegacyFormat 测试旧版本 (频率表) 格式的块仍然可以读取，且可以与范式 Huffman 块混合
+func TestDecompressChunk_LegacyFormat(t *testing.T) {
+	text := bytes.Repeat([]byte("legacy chunks stay readable; "), 1000)
+	legacy, err := compressChunkV1(text)
+	if err != nil {
+		t.Fatalf("compressChunkV1 failed: %v", err)
+	}
+	canonical, err := compressChunk(text)
+	if err != nil {
+		t.Fatalf("compressChunk failed: %v", err)
+	}
+	if len(canonical) >= len(legacy) {
+		t.Errorf("Expected canonical chunk (%d bytes) to be smaller than legacy chunk (%d bytes)", len(canonical), len(legacy))
+	}
+	for name, chunk := range map[string][]byte{"legacy": legacy, "canonical": canonical} {
+		out, err := decompressChunk(chunk)
+		if err != nil {
+			t.Fatalf("decompressChunk(%s) failed: %v", name, err)
+		}
+		if !bytes.Equal(text, out) {
+			t.Errorf("decompressChunk(%s) returned wrong data", name)
+		}
+	}
+
+	// 偶数字节开头的块按旧版本格式写入
+	input := []byte(generateRandomData(huffmanChunkSize * 4))
+	for i := 0; i < len(input); i += 3 {
+		input[i] = 'a' // 降低熵，避免块被直接保存
+	}
+	mixed := func(data []byte) ([]byte, error) {
+		if data[0]%2 == 0 {
+			return compressChunkV1(data)
+		}
+		return compressChunk(data)
+	}
+	for i := 0; i < 4; i++ {
+		input[i*huffmanChunkSize] = byte(i)
+	}
+	mockWc := newMockWriteCloser()
+	writer := newChunkWriter(mockWc, huffmanMagic, mixed, 0)
+	if _, err := writer.Write(input); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reader, err := NewCompressedReader(bytes.NewReader(mockWc.Bytes()))
+	if err != nil {
+		t.Fatalf("NewCompressedReader failed: %v", err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("io.ReadAll failed: %v", err)
+	}
+	if !bytes.Equal(input, decompressed) {
+		t.Errorf("Mixed stream decompressed to wrong data")
+	}
+
+	ra, err := newHuffmanReaderAt(bytes.NewReader(mockWc.Bytes()), int64(mockWc.Len()))
+	if err != nil {
+		t.Fatalf("newHuffmanReaderAt failed: %v", err)
+	}
+	buf := make([]byte, 3*huffmanChunkSize)
+	if _, err := ra.ReadAt(buf, huffmanChunkSize/2); err != nil {
+		t.Fatalf("ReadAt failed: %v", err)
+	}
+	if !bytes.Equal(buf, input[huffmanChunkSize/2:huffmanChunkSize/2+len(buf)]) {
+		t.Errorf("ReadAt on mixed stream returned wrong data")
+	}
+}
+
+// BenchmarkDecompressChunk 比较旧版本格式与范式 Huffman 格式的解码速度
+func BenchmarkDecompressChunk(b *testing.B) {
+	data := bytes.Repeat([]byte("2026-01-02 15:04:05 INFO backup chunk decoded\n"), huffmanChunkSize/46)
+	for _, tc := range []struct {
+		name     string
+		compress func([]byte) ([]byte, error)
+	}{{"legacy", compressChunkV1}, {"canonical", compressChunk}} {
+		chunk, err := tc.compress(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(tc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := decompressChunk(chunk); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestBitPacker_MatchesBitWriter 测试按字写出的 bitPacker 与逐位写入的 bitWriter 输出完全相同
+func TestBitPacker_MatchesBitWriter(t *testing.T) {
+	rnd := rand.New(rand.NewSource(9))
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(rnd.ExpFloat64() * 16)
+	}
+	var freqs [256]int64
+	for _, b := range data {
+		freqs[b]++
+	}
+	var codes [256]uint32
+	packCodes(codes[:], huffmanCodeLengths(freqs[:], maxCodeLen))
+
+	var expected bytes.Buffer
+	bw := newBitWriter(&expected)
+	single := bitPacker{}
+	for _, b := range data {
+		code, n := codes[b]>>8, codes[b]&0xFF
+		for i := int(n) - 1; i >= 0; i-- {
+			if err := bw.WriteBit(code&(1<<i) != 0); err != nil {
+				t.Fatalf("WriteBit failed: %v", err)
+			}
+		}
+		single.writeCode(codes[b])
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	bulk := bitPacker{}
+	bulk.writeBytes(&codes, data[:12345])
+	bulk.writeBytes(&codes, data[12345:])
+
+	if !bytes.Equal(expected.Bytes(), single.flush()) {
+		t.Errorf("bitPacker.writeCode output differs from bitWriter")
+	}
+	if !bytes.Equal(expected.Bytes(), bulk.flush()) {
+		t.Errorf("bitPacker.writeBytes output differs from bitWriter")
+	}
+}
+
+// BenchmarkCompressChunk 比较旧版本编码 (逐位写入字符串编码) 与打包编码表的编码速度
+func BenchmarkCompressChunk(b *testing.B) {
+	data := bytes.Repeat([]byte("2026-01-02 15:04:05 INFO backup chunk encoded\n"), huffmanChunkSize/46)
+	for _, tc := range []struct {
+		name     string
+		compress func([]byte) ([]byte, error)
+	}{{"legacy", compressChunkV1}, {"canonical", compressChunk}} {
+		b.Run(tc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := tc.compress(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// chunkFixtureInput 是 testdata 中块的原始数据: 日志文本、每个字节值各一次 (编码长于查找表的 10 位) 和一段重复
+func chunkFixtureInput() []byte {
+	var buf bytes.Buffer
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&buf, "2026-01-02 15:04:%02d INFO job %d done\n", i%60, i*7)
+	}
+	for i := 0; i < 256; i++ {
+		buf.WriteByte(byte(i))
+	}
+	buf.Write(bytes.Repeat([]byte{'x'}, 4000))
+	return buf.Bytes()
+}
+
+// TestChunkFormat_Fixtures 测试改用打包编码表之前的编码器写入的块 (testdata) 仍能解码，且当前编码器的输出与它们逐字节相同
+func TestChunkFormat_Fixtures(t *testing.T) {
+	input := chunkFixtureInput()
+	for _, tc := range []struct {
+		file       string
+		compress   func([]byte) ([]byte, error)
+		decompress func([]byte) ([]byte, error)
+	}{
+		{"huffman_canonical.chunk", compressChunk, decompressChunk},
+		{"lzh.chunk", compressLZChunk, decompressLZChunk},
+	} {
+		fixture, err := os.ReadFile(filepath.Join("testdata", tc.file))
+		if err != nil {
+			t.Fatalf("failed to read fixture: %v", err)
+		}
+		decoded, err := tc.decompress(fixture)
+		if err != nil {
+			t.Fatalf("%s: decompress failed: %v", tc.file, err)
+		}
+		if !bytes.Equal(decoded, input) {
+			t.Errorf("%s: decoded data differs from the fixture input", tc.file)
+		}
+		encoded, err := tc.compress(input)
+		if err != nil {
+			t.Fatalf("%s: compress failed: %v", tc.file, err)
+		}
+		if !bytes.Equal(encoded, fixture) {
+			t.Errorf("%s: encoder output differs from the fixture (%d vs %d bytes)", tc.file, len(encoded), len(fixture))
+		}
+	}
+
+	// fixture 必须覆盖查找表之外的逐位解码
+	fixture, _ := os.ReadFile(filepath.Join("testdata", "huffman_canonical.chunk"))
+	longest := uint8(0)
+	for _, l := range readCodeLengths(fixture[8 : 8+huffmanCodeTableLen]) {
+		longest = max(longest, l)
+	}
+	if longest <= huffmanTableBits {
+		t.Errorf("fixture should contain codes longer than %d bits, longest is %d", huffmanTableBits, longest)
+	}
+}
@@ -0,0 +1,350 @@
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+// importEntry 是从外部归档读取到的一个条目，data 仅对普通文件有效
+type importEntry struct {
+	meta FileMetadata
+	data io.Reader
+}
+
+// importSource 逐个返回外部归档中的条目，结束时返回 io.EOF
+type importSource func() (*importEntry, error)
+
+// cleanImportPath 将外部归档中的路径规范化为归档内的相对路径，拒绝指向归档之外的路径
+func cleanImportPath(name string) (string, error) {
+	p := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return ".", nil
+	}
+	if isInternalPath(p) {
+		return "", fmt.Errorf("reserved path in source archive: %s", name)
+	}
+	return p, nil
+}
+
+// ImportTar 将 tar (或 tar.gz) 文件转换为新的 .qbak 完整备份，以便旧的备份也能纳入管理
+func (m *BackupManager) ImportTar(srcFile, destFile string, codec string, useEncryption bool, algorithm uint8, password string) error {
+	openTar := func() (*tar.Reader, io.Closer, error) {
+		f, err := os.Open(srcFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open tar file: %w", err)
+		}
+		br := bufio.NewReaderSize(f, copyBufferSize)
+		var r io.Reader = br
+		if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+			gz, err := gzip.NewReader(br)
+			if err != nil {
+				_ = f.Close()
+				return nil, nil, fmt.Errorf("failed to open gzip stream: %w", err)
+			}
+			r = gz
+		}
+		return tar.NewReader(r), f, nil
+	}
+
+	// tar 只能顺序读取: 第一遍读取头部生成清单，第二遍写入数据
+	tr, closer, err := openTar()
+	if err != nil {
+		return err
+	}
+	next := tarImportSource(tr)
+	files, err := collectImportManifest(next)
+	_ = closer.Close()
+	if err != nil {
+		return err
+	}
+
+	tr, closer, err = openTar()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	return m.writeImportedBackup(destFile, files, tarImportSource(tr), codec, useEncryption, algorithm, password)
+}
+
+func tarImportSource(tr *tar.Reader) importSource {
+	return func() (*importEntry, error) {
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				if err != io.EOF {
+					err = fmt.Errorf("failed to read tar header: %w", err)
+				}
+				return nil, err
+			}
+
+			relPath, err := cleanImportPath(hdr.Name)
+			if err != nil {
+				return nil, err
+			}
+			info := hdr.FileInfo()
+			meta := FileMetadata{
+				Path:    relPath,
+				Mode:    info.Mode(),
+				ModTime: hdr.ModTime,
+				Owner:   &FileOwner{UID: hdr.Uid, GID: hdr.Gid, User: hdr.Uname, Group: hdr.Gname},
+			}
+			for key, value := range hdr.PAXRecords {
+				if name, ok := strings.CutPrefix(key, paxXattrPrefix); ok {
+					if meta.Xattrs == nil {
+						meta.Xattrs = make(map[string][]byte)
+					}
+					meta.Xattrs[name] = []byte(value)
+				}
+			}
+
+			switch hdr.Typeflag {
+			case tar.TypeDir:
+				meta.IsDir = true
+			case tar.TypeSymlink:
+				meta.IsLink = true
+				meta.LinkDest = hdr.Linkname
+			case tar.TypeLink:
+				target, err := cleanImportPath(hdr.Linkname)
+				if err != nil {
+					return nil, err
+				}
+				meta.HardLink = target
+			case tar.TypeChar, tar.TypeBlock:
+				meta.DevMajor = uint32(hdr.Devmajor)
+				meta.DevMinor = uint32(hdr.Devminor)
+			case tar.TypeFifo:
+			case tar.TypeReg:
+				meta.Size = hdr.Size
+				meta.HasCRC = true
+				return &importEntry{meta: meta, data: tr}, nil
+			default:
+				log.Printf("Warn: skipping unsupported tar entry %s (type %q)", hdr.Name, hdr.Typeflag)
+				continue
+			}
+			return &importEntry{meta: meta}, nil
+		}
+	}
+}
+
+// ImportZip 将 zip 文件转换为新的 .qbak 完整备份。符号链接按 Info-ZIP 的约定读取。
+func (m *BackupManager) ImportZip(srcFile, destFile string, codec string, useEncryption bool, algorithm uint8, password string) error {
+	zr, err := zip.OpenReader(srcFile)
+	if err != nil {
+		return fmt.Errorf("failed to open zip file: %w", err)
+	}
+	defer zr.Close()
+
+	newSource := func() importSource {
+		i := 0
+		var current io.ReadCloser
+		return func() (*importEntry, error) {
+			if current != nil {
+				_ = current.Close()
+				current = nil
+			}
+			for ; i < len(zr.File); i++ {
+				f := zr.File[i]
+				relPath, err := cleanImportPath(f.Name)
+				if err != nil {
+					return nil, err
+				}
+				mode := f.Mode()
+				meta := FileMetadata{
+					Path:    relPath,
+					Mode:    mode,
+					ModTime: f.Modified,
+				}
+
+				switch {
+				case mode.IsDir():
+					meta.IsDir = true
+				case mode&os.ModeSymlink != 0:
+					rc, err := f.Open()
+					if err != nil {
+						return nil, fmt.Errorf("failed to open zip entry %s: %w", f.Name, err)
+					}
+					linkDest, err := io.ReadAll(rc)
+					_ = rc.Close()
+					if err != nil {
+						return nil, fmt.Errorf("failed to read zip entry %s: %w", f.Name, err)
+					}
+					meta.IsLink = true
+					meta.LinkDest = string(linkDest)
+				case mode.IsRegular():
+					rc, err := f.Open()
+					if err != nil {
+						return nil, fmt.Errorf("failed to open zip entry %s: %w", f.Name, err)
+					}
+					current = rc
+					meta.Size = int64(f.UncompressedSize64)
+					meta.HasCRC = true
+					i++
+					return &importEntry{meta: meta, data: rc}, nil
+				default:
+					log.Printf("Warn: skipping unsupported zip entry %s (%s)", f.Name, mode.Type())
+					continue
+				}
+				i++
+				return &importEntry{meta: meta}, nil
+			}
+			return nil, io.EOF
+		}
+	}
+
+	files, err := collectImportManifest(newSource())
+	if err != nil {
+		return err
+	}
+	return m.writeImportedBackup(destFile, files, newSource(), codec, useEncryption, algorithm, password)
+}
+
+// collectImportManifest 读取所有条目头部生成清单；同一路径出现多次时以最后一次为准
+func collectImportManifest(next importSource) ([]ManifestFile, error) {
+	byPath := make(map[string]ManifestFile, 256)
+	for {
+		entry, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		meta := entry.meta
+		if meta.Path == "." {
+			continue
+		}
+		byPath[meta.Path] = ManifestFile{
+			Path:     meta.Path,
+			Size:     meta.Size,
+			Mode:     meta.Mode,
+			ModTime:  meta.ModTime,
+			IsDir:    meta.IsDir,
+			IsLink:   meta.IsLink,
+			LinkDest: meta.LinkDest,
+			Xattrs:   meta.Xattrs,
+			HardLink: meta.HardLink,
+			Owner:    meta.Owner,
+			DevMajor: meta.DevMajor,
+			DevMinor: meta.DevMinor,
+		}
+	}
+
+	files := make([]ManifestFile, 0, len(byPath))
+	for _, f := range byPath {
+		files = append(files, f)
+	}
+	sortManifestFiles(files)
+	return files, nil
+}
+
+func (m *BackupManager) writeImportedBackup(destFile string, files []ManifestFile, next importSource, codec string, useEncryption bool, algorithm uint8, password string) error {
+	if len(files) == 0 {
+		return ErrNoFilesSelected
+	}
+	dest := &backupDest{path: destFile, volumeSize: m.VolumeSize, deterministic: m.Deterministic}
+	err := m.writeImportedArchive(dest.open, files, next, codec, useEncryption, algorithm, password)
+	return dest.close(err)
+}
+
+func (m *BackupManager) writeImportedArchive(openDest func() (io.Writer, error), files []ManifestFile, next importSource, codec string, useEncryption bool, algorithm uint8, password string) error {
+	totalFiles := 0
+	var totalBytes int64
+	for _, f := range files {
+		if !f.IsDir {
+			totalFiles++
+			totalBytes += f.Size
+		}
+	}
+	m.emitProgressDetail("正在导入...", 0, totalFiles, 0, totalBytes, "archiving")
+
+	manifest := BackupManifest{
+		Version:   manifestVersion,
+		Type:      BackupTypeFull,
+		CreatedAt: m.now(),
+		Files:     files,
+	}
+
+	dest, err := openDest()
+	if err != nil {
+		return err
+	}
+	writer, err := m.newBackupWriter(dest, codec, useEncryption, algorithm, password)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	archiveWriter := NewArchiveWriter(writer)
+	archiveWriter.hashFiles = true
+	buffer := make([]byte, copyBufferSize)
+	// 两份清单的写法见 writeManifest
+	if err := m.writeManifest(archiveWriter, manifest, nil); err != nil {
+		return err
+	}
+	// 同一路径出现多次时后写入的哈希覆盖之前的，与清单和恢复的结果一致
+	hashes := newContentHashes()
+
+	var importedFiles int
+	var importedBytes int64
+	for {
+		select {
+		case <-m.ctx.Done():
+			return m.ctx.Err()
+		default:
+		}
+
+		entry, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if entry.meta.Path == "." {
+			continue
+		}
+
+		if entry.meta.Mode.IsRegular() && entry.meta.HardLink == "" {
+			if entry.data != nil {
+				br := bufio.NewReaderSize(entry.data, sniffLen)
+				entry.data = br
+				entry.meta.Compression = m.entryCompression(codec, &entry.meta, func() []byte {
+					head, _ := br.Peek(sniffLen)
+					return head
+				})
+			}
+		}
+
+		m.emitLog(fmt.Sprintf("正在导入: %s", entry.meta.Path))
+		if err := archiveWriter.writeEntry(&entry.meta, entry.data, buffer, func(n int64) { importedBytes += n }); err != nil {
+			return fmt.Errorf("failed to import %s: %w", entry.meta.Path, err)
+		}
+		hashes.add(&entry.meta)
+		if !entry.meta.IsDir {
+			importedFiles++
+			m.emitProgressDetail(fmt.Sprintf("正在导入: %s", entry.meta.Path), importedFiles, totalFiles, importedBytes, totalBytes, "archiving")
+		}
+	}
+
+	if err := m.writeManifest(archiveWriter, manifest, hashes); err != nil {
+		return err
+	}
+	if err := archiveWriter.WriteIndex(); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finish backup stream: %w", err)
+	}
+
+	m.emitProgressDetail("导入完成", totalFiles, totalFiles, totalBytes, totalBytes, "archiving")
+	return nil
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"bytes"
 	"encoding/json"
 	"os"
 	"sort"
@@ -11,6 +12,7 @@ import (
 const (
 	internalMetaPrefix = ".qbakmeta/"
 	manifestEntryPath  = internalMetaPrefix + "manifest.json"
+	archiveIndexPath   = internalMetaPrefix + "index.json"
 	manifestVersion    = 1
 )
 
@@ -29,6 +31,13 @@ type ManifestFile struct {
 	IsDir    bool        `json:"isDir"`
 	IsLink   bool        `json:"isLink"`
 	LinkDest string      `json:"linkDest,omitempty"`
+
+	Xattrs   map[string][]byte `json:"xattrs,omitempty"`
+	HardLink string            `json:"hardLink,omitempty"` // 硬链接指向的归档路径
+	Owner    *FileOwner        `json:"owner,omitempty"`
+	DevMajor uint32            `json:"devMajor,omitempty"`
+	DevMinor uint32            `json:"devMinor,omitempty"`
+	SHA256   string            `json:"sha256,omitempty"` // 普通文件内容的 SHA-256，硬链接与它指向的文件相同
 }
 
 type BackupManifest struct {
@@ -67,6 +76,19 @@ func (mf ManifestFile) equalForDiff(other ManifestFile) bool {
 	if mf.Mode != other.Mode {
 		return false
 	}
+	if !equalXattrs(mf.Xattrs, other.Xattrs) {
+		return false
+	}
+	if !equalOwner(mf.Owner, other.Owner) {
+		return false
+	}
+	if mf.DevMajor != other.DevMajor || mf.DevMinor != other.DevMinor {
+		return false
+	}
+	// 持有数据的路径变化时 (例如原来的第一个链接被删除)，需要重新写入数据
+	if mf.HardLink != other.HardLink {
+		return false
+	}
 
 	// For symlinks, link destination is the primary content.
 	if mf.IsLink {
@@ -84,6 +106,19 @@ func (mf ManifestFile) equalForDiff(other ManifestFile) bool {
 	return mf.ModTime.Equal(other.ModTime)
 }
 
+func equalXattrs(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		other, ok := b[name]
+		if !ok || !bytes.Equal(value, other) {
+			return false
+		}
+	}
+	return true
+}
+
 func manifestFilesToMap(files []ManifestFile) map[string]ManifestFile {
 	m := make(map[string]ManifestFile, len(files))
 	for _, f := range files {
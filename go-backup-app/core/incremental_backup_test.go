@@ -22,7 +22,7 @@ func TestIncrementalBackup_RestoreChain(t *testing.T) {
 	filters := FilterConfig{MaxSize: -1}
 
 	baseFile := filepath.Join(tempDir, "base.qbak")
-	require.NoError(t, manager.Backup([]string{srcDir}, baseFile, filters, false, false, 0, ""))
+	require.NoError(t, manager.Backup([]string{srcDir}, baseFile, filters, CodecStore, false, 0, ""))
 
 	// Apply changes: modify a, delete b, add c.
 	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("v2"), 0644))
@@ -30,7 +30,7 @@ func TestIncrementalBackup_RestoreChain(t *testing.T) {
 	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "c.txt"), []byte("new"), 0644))
 
 	incFile := filepath.Join(tempDir, "inc.qbak")
-	require.NoError(t, manager.BackupIncremental([]string{srcDir}, incFile, baseFile, filters, false, false, 0, ""))
+	require.NoError(t, manager.BackupIncremental([]string{srcDir}, incFile, baseFile, filters, CodecStore, false, 0, ""))
 
 	restoreDir := filepath.Join(tempDir, "restore")
 	require.NoError(t, os.MkdirAll(restoreDir, 0755))
@@ -62,10 +62,10 @@ func TestIncrementalBackup_NoChanges(t *testing.T) {
 	filters := FilterConfig{MaxSize: -1}
 
 	baseFile := filepath.Join(tempDir, "base.qbak")
-	require.NoError(t, manager.Backup([]string{srcDir}, baseFile, filters, false, false, 0, ""))
+	require.NoError(t, manager.Backup([]string{srcDir}, baseFile, filters, CodecStore, false, 0, ""))
 
 	incFile := filepath.Join(tempDir, "inc.qbak")
-	err := manager.BackupIncremental([]string{srcDir}, incFile, baseFile, filters, false, false, 0, "")
+	err := manager.BackupIncremental([]string{srcDir}, incFile, baseFile, filters, CodecStore, false, 0, "")
 	require.ErrorIs(t, err, ErrNoChanges)
 	_, statErr := os.Stat(incFile)
 	require.True(t, os.IsNotExist(statErr), "incremental file should not be created when no changes are detected")
@@ -1,8 +1,6 @@
 package core
 
 import (
-	"bufio"
-	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -16,6 +14,15 @@ import (
 )
 
 func (m *BackupManager) readManifest(backupFile, password string) (*BackupManifest, error) {
+	// 数据之后的清单带有内容哈希，优先读取；旧版本的备份、没有索引或者归档末尾损坏时使用第一个条目中的清单
+	manifest, err := m.readTrailingManifest(backupFile, password)
+	if m.ctx.Err() != nil {
+		return nil, m.ctx.Err()
+	}
+	if err == nil && manifest != nil {
+		return manifest, nil
+	}
+
 	reader, err := m.getReaderPipe(backupFile, password)
 	if err != nil {
 		return nil, err
@@ -69,29 +76,51 @@ func (m *BackupManager) readManifest(backupFile, password string) (*BackupManife
 		}
 	}
 
-	var manifest BackupManifest
-	if err := json.Unmarshal(payload, &manifest); err != nil {
+	manifest = &BackupManifest{}
+	if err := json.Unmarshal(payload, manifest); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
 	}
-	return &manifest, nil
+	return manifest, nil
+}
+
+// readTrailingManifest 以随机访问方式读取写在数据之后的清单，索引没有记录清单时返回 nil
+func (m *BackupManager) readTrailingManifest(backupFile, password string) (*BackupManifest, error) {
+	a, err := m.openArchiveAt(backupFile, password)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+	manifest, err := a.readManifest()
+	if err != nil && m.ctx.Err() != nil {
+		return nil, m.ctx.Err()
+	}
+	return manifest, err
 }
 
 func (m *BackupManager) resolveRestoreChain(backupFile, password string) ([]string, error) {
+	chain, _, err := m.resolveManifestChain(backupFile, password)
+	return chain, err
+}
+
+// resolveManifestChain 与 resolveRestoreChain 相同，同时返回链上每个备份的清单 (没有清单时为 nil)
+func (m *BackupManager) resolveManifestChain(backupFile, password string) ([]string, []*BackupManifest, error) {
 	chain := make([]string, 0, 4)
+	manifests := make([]*BackupManifest, 0, 4)
 	seen := make(map[string]struct{}, 8)
 
 	current := backupFile
 	for {
 		if _, ok := seen[current]; ok {
-			return nil, fmt.Errorf("backup chain cycle detected at %s", current)
+			return nil, nil, fmt.Errorf("backup chain cycle detected at %s", current)
 		}
 		seen[current] = struct{}{}
 		chain = append(chain, current)
 
 		manifest, err := m.readManifest(current, password)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+		manifests = append(manifests, manifest)
 		if manifest == nil || manifest.Parent == "" || manifest.Type == BackupTypeFull {
 			break
 		}
@@ -106,11 +135,12 @@ func (m *BackupManager) resolveRestoreChain(backupFile, password string) ([]stri
 	// Reverse to base -> target
 	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
 		chain[i], chain[j] = chain[j], chain[i]
+		manifests[i], manifests[j] = manifests[j], manifests[i]
 	}
-	return chain, nil
+	return chain, manifests, nil
 }
 
-func (m *BackupManager) restoreSingle(backupFile, restoreDir, password string) error {
+func (m *BackupManager) restoreSingle(backupFile, restoreDir, password string, opts RestoreOptions) error {
 	reader, err := m.getReaderPipe(backupFile, password)
 	if err != nil {
 		return err
@@ -127,7 +157,7 @@ func (m *BackupManager) restoreSingle(backupFile, restoreDir, password string) e
 	defer reader.Close()
 
 	archiveReader := NewArchiveReader(reader)
-	err = m.runRestore(archiveReader, restoreDir)
+	err = m.runRestore(archiveReader, restoreDir, opts)
 	if err != nil && m.ctx.Err() != nil {
 		return m.ctx.Err()
 	}
@@ -136,7 +166,18 @@ func (m *BackupManager) restoreSingle(backupFile, restoreDir, password string) e
 
 // BackupIncremental creates an incremental backup against a parent backup file.
 // The parent backup must contain a manifest entry (i.e. it must be created by this version or later).
-func (m *BackupManager) BackupIncremental(srcPaths []string, destFile string, parentBackupFile string, filters FilterConfig, useCompression bool, useEncryption bool, algorithm uint8, password string) error {
+func (m *BackupManager) BackupIncremental(srcPaths []string, destFile string, parentBackupFile string, filters FilterConfig, codec string, useEncryption bool, algorithm uint8, password string) error {
+	dest := &backupDest{path: destFile, volumeSize: m.VolumeSize, deterministic: m.Deterministic}
+	err := m.backupIncremental(srcPaths, dest.open, parentBackupFile, filters, codec, useEncryption, algorithm, password)
+	return dest.close(err)
+}
+
+// BackupIncrementalTo writes an incremental backup against parentBackupFile to w. w is not closed.
+func (m *BackupManager) BackupIncrementalTo(srcPaths []string, w io.Writer, parentBackupFile string, filters FilterConfig, codec string, useEncryption bool, algorithm uint8, password string) error {
+	return m.backupIncremental(srcPaths, func() (io.Writer, error) { return w, nil }, parentBackupFile, filters, codec, useEncryption, algorithm, password)
+}
+
+func (m *BackupManager) backupIncremental(srcPaths []string, openDest func() (io.Writer, error), parentBackupFile string, filters FilterConfig, codec string, useEncryption bool, algorithm uint8, password string) error {
 	if parentBackupFile == "" {
 		return fmt.Errorf("parent backup file is required")
 	}
@@ -195,53 +236,46 @@ func (m *BackupManager) BackupIncremental(srcPaths []string, destFile string, pa
 		return ErrNoChanges
 	}
 
+	// 未变化的文件沿用父备份清单中的内容哈希，需要归档的文件在写入时计算
+	for i := range scanRes.files {
+		f := &scanRes.files[i]
+		if _, changed := changedSet[f.Path]; !changed {
+			f.SHA256 = parentMap[f.Path].SHA256
+		}
+	}
+
 	totalOps := len(changedPaths) + len(deletedPaths)
 	var totalBytes int64
 	for _, p := range changedPaths {
-		if mf, ok := currentMap[p]; ok && !mf.IsDir && !mf.IsLink && mf.Size > 0 {
+		if mf, ok := currentMap[p]; ok && !mf.IsDir && !mf.IsLink && mf.HardLink == "" && mf.Size > 0 {
 			totalBytes += mf.Size
 		}
 	}
 	m.emitProgressDetail("正在归档增量...", 0, totalOps, 0, totalBytes, "archiving")
 
+	m.sortManifestFiles(scanRes.files)
 	manifest := BackupManifest{
 		Version:   manifestVersion,
 		Type:      BackupTypeIncremental,
-		CreatedAt: time.Now(),
+		CreatedAt: m.now(),
 		Parent:    filepath.Base(parentBackupFile),
 		Files:     scanRes.files,
 	}
-	manifestBytes, err := json.Marshal(manifest)
-	if err != nil {
-		return fmt.Errorf("failed to marshal manifest: %w", err)
-	}
 
-	outFile, err := os.Create(destFile)
+	dest, err := openDest()
 	if err != nil {
-		return fmt.Errorf("failed to create destination file: %w", err)
-	}
-	defer outFile.Close()
-
-	var writer io.WriteCloser = outFile
-	if useEncryption {
-		m.emitProgress("正在加密...", 0, 0)
-		encryptedWriter, err := NewEncryptedWriter(writer, password, algorithm)
-		if err != nil {
-			return fmt.Errorf("failed to create encrypted writer: %w", err)
-		}
-		writer = encryptedWriter
-		defer writer.Close()
+		return err
 	}
-
-	if useCompression {
-		m.emitProgress("正在压缩...", 0, 0)
-		compressedWriter := NewCompressedWriter(writer)
-		writer = compressedWriter
-		defer writer.Close()
+	writer, err := m.newBackupWriter(dest, codec, useEncryption, algorithm, password)
+	if err != nil {
+		return err
 	}
+	defer writer.Close()
 
 	archiveWriter := NewArchiveWriter(writer)
-	archiveMutex := &sync.Mutex{}
+	archiveWriter.hashFiles = true
+	order := newEntryOrder(m.ctx, m.Deterministic)
+	defer order.stop()
 
 	var completedOps int64
 	var completedBytes int64
@@ -270,15 +304,11 @@ func (m *BackupManager) BackupIncremental(srcPaths []string, destFile string, pa
 		)
 	}
 
-	manifestMeta := FileMetadata{
-		Path:    manifestEntryPath,
-		Size:    int64(len(manifestBytes)),
-		Mode:    0644,
-		ModTime: time.Now(),
-	}
-	if err := archiveWriter.WriteEntry(manifestMeta, bytes.NewReader(manifestBytes), make([]byte, copyBufferSize), nil); err != nil {
-		return fmt.Errorf("failed to write manifest: %w", err)
+	// 与完整备份相同，先写一份清单，变化文件的内容哈希在写入数据时计算，数据之后再写完整的清单
+	if err := m.writeManifest(archiveWriter, manifest, nil); err != nil {
+		return err
 	}
+	hashes := newContentHashes()
 
 	// Apply deletions first to avoid conflicts when types change (file->dir, dir->file, link->file, ...).
 	for _, path := range deletedPaths {
@@ -309,7 +339,7 @@ func (m *BackupManager) BackupIncremental(srcPaths []string, destFile string, pa
 		changedJobs = append(changedJobs, job)
 	}
 
-	pathsChan := make(chan archiveJob)
+	pathsChan := make(chan orderedJob)
 	errChan := make(chan error, backupWorkers)
 	var wg sync.WaitGroup
 
@@ -328,6 +358,7 @@ func (m *BackupManager) BackupIncremental(srcPaths []string, destFile string, pa
 				info, err := os.Lstat(job.path)
 				if err != nil {
 					errChan <- fmt.Errorf("failed to stat %s: %w", job.path, err)
+					order.skip(job.seq)
 					continue
 				}
 
@@ -337,14 +368,23 @@ func (m *BackupManager) BackupIncremental(srcPaths []string, destFile string, pa
 					Mode:    info.Mode(),
 					ModTime: info.ModTime(),
 					IsDir:   info.IsDir(),
+					Xattrs:  job.xattrs,
+					Owner:   job.owner,
+
+					DevMajor: job.devMajor,
+					DevMinor: job.devMinor,
 				}
 
 				var fileReader io.Reader
 				var openedFile *os.File
-				if info.Mode()&os.ModeSymlink != 0 {
+				if job.hardLink != "" {
+					meta.HardLink = job.hardLink
+					meta.Size = 0
+				} else if info.Mode()&os.ModeSymlink != 0 {
 					linkDest, err := os.Readlink(job.path)
 					if err != nil {
 						errChan <- fmt.Errorf("failed to read link %s: %w", job.path, err)
+						order.skip(job.seq)
 						continue
 					}
 					meta.IsLink = true
@@ -355,10 +395,19 @@ func (m *BackupManager) BackupIncremental(srcPaths []string, destFile string, pa
 					file, err := os.Open(job.path)
 					if err != nil {
 						errChan <- fmt.Errorf("failed to open file %s: %w", job.path, err)
+						order.skip(job.seq)
 						continue
 					}
 					openedFile = file
-					fileReader = bufio.NewReaderSize(file, copyBufferSize)
+					data := openEntryData(file, &meta)
+					meta.Compression = m.entryCompression(codec, &meta, func() []byte { return readFileHead(file) })
+					fileReader, err = order.prefetch(data, meta.payloadSize())
+					if err != nil {
+						_ = file.Close()
+						errChan <- fmt.Errorf("failed to read file %s: %w", job.path, err)
+						order.skip(job.seq)
+						continue
+					}
 				} else {
 					meta.Size = 0
 				}
@@ -371,11 +420,19 @@ func (m *BackupManager) BackupIncremental(srcPaths []string, destFile string, pa
 					emitArchivingProgress(fmt.Sprintf("正在归档: %s", relPath), false)
 				}
 
-				archiveMutex.Lock()
-				err = archiveWriter.WriteEntry(meta, fileReader, buffer, onWrite)
-				archiveMutex.Unlock()
+				if !order.acquire(job.seq) {
+					if openedFile != nil {
+						_ = openedFile.Close()
+					}
+					return
+				}
+				err = archiveWriter.writeEntry(&meta, fileReader, buffer, onWrite)
+				order.release()
 
 				if openedFile != nil {
+					if err == nil {
+						m.warnIfChanged(openedFile, info, relPath)
+					}
 					_ = openedFile.Close()
 				}
 
@@ -383,6 +440,7 @@ func (m *BackupManager) BackupIncremental(srcPaths []string, destFile string, pa
 					errChan <- fmt.Errorf("failed to archive %s: %w", job.path, err)
 					continue
 				}
+				hashes.add(&meta)
 
 				atomic.AddInt64(&completedOps, 1)
 				emitArchivingProgress(fmt.Sprintf("正在归档: %s", relPath), true)
@@ -392,7 +450,7 @@ func (m *BackupManager) BackupIncremental(srcPaths []string, destFile string, pa
 
 	go func() {
 		defer close(pathsChan)
-		for _, job := range changedJobs {
+		for _, job := range m.orderJobs(changedJobs) {
 			select {
 			case <-m.ctx.Done():
 				return
@@ -408,12 +466,67 @@ func (m *BackupManager) BackupIncremental(srcPaths []string, destFile string, pa
 		return err
 	}
 
+	if err := m.ctx.Err(); err != nil {
+		return err
+	}
+	if err := m.writeManifest(archiveWriter, manifest, hashes); err != nil {
+		return err
+	}
+	if err := archiveWriter.WriteIndex(); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finish backup stream: %w", err)
+	}
+
 	m.emitProgressDetail("备份完成", totalOps, totalOps, totalBytes, totalBytes, "archiving")
 	return nil
 }
 
+// RestoreFrom restores a single backup stream read from r, e.g. stdin.
+// A stream carries no parent backups, so an incremental stream is applied on top of what is already in restoreDir;
+// restore the chain by feeding the base stream first and each incremental stream after it.
+func (m *BackupManager) RestoreFrom(r io.Reader, restoreDir, password string, opts RestoreOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	m.emitProgress("正在准备恢复...", 0, 0)
+
+	reader, err := m.newReaderPipe(r, nil, password)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-m.ctx.Done():
+			_ = reader.Close()
+		case <-done:
+		}
+	}()
+	defer close(done)
+	defer reader.Close()
+
+	err = m.runRestore(NewArchiveReader(reader), restoreDir, opts)
+	if err != nil && m.ctx.Err() != nil {
+		return m.ctx.Err()
+	}
+	return err
+}
+
 // Restore restores a backup file. If the backup is incremental, it automatically resolves and applies the chain.
 func (m *BackupManager) Restore(backupFile, restoreDir, password string) error {
+	return m.RestoreWithOptions(backupFile, restoreDir, password, RestoreOptions{})
+}
+
+// RestoreWithOptions restores only the entries selected by opts.
+// Deletion markers in incremental backups follow the same selection, so unselected paths are left untouched.
+func (m *BackupManager) RestoreWithOptions(backupFile, restoreDir, password string, opts RestoreOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
 	m.emitProgress("正在准备恢复...", 0, 0)
 
 	chain, err := m.resolveRestoreChain(backupFile, password)
@@ -427,7 +540,7 @@ func (m *BackupManager) Restore(backupFile, restoreDir, password string) error {
 			return m.ctx.Err()
 		default:
 		}
-		if err := m.restoreSingle(f, restoreDir, password); err != nil {
+		if err := m.restoreSingle(f, restoreDir, password, opts); err != nil {
 			return err
 		}
 	}
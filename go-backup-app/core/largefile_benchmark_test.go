@@ -81,7 +81,7 @@ func benchmarkBackupLargeFile(b *testing.B, generator fileGenerator) {
 	manager.DisableEvents()
 
 	warmupDest := filepath.Join(tempDir, "warmup.qbak")
-	if err := manager.Backup([]string{srcFile}, warmupDest, FilterConfig{MaxSize: -1}, true, true, AlgoAES256_CTR, benchmarkPassword); err != nil {
+	if err := manager.Backup([]string{srcFile}, warmupDest, FilterConfig{MaxSize: -1}, CodecHuffman, true, AlgoAES256_CTR, benchmarkPassword); err != nil {
 		b.Fatalf("warmup backup: %v", err)
 	}
 	info, err := os.Stat(warmupDest)
@@ -97,7 +97,7 @@ func benchmarkBackupLargeFile(b *testing.B, generator fileGenerator) {
 
 	for i := 0; i < b.N; i++ {
 		dest := filepath.Join(tempDir, fmt.Sprintf("out-%d.qbak", i))
-		if err := manager.Backup([]string{srcFile}, dest, FilterConfig{MaxSize: -1}, true, true, AlgoAES256_CTR, benchmarkPassword); err != nil {
+		if err := manager.Backup([]string{srcFile}, dest, FilterConfig{MaxSize: -1}, CodecHuffman, true, AlgoAES256_CTR, benchmarkPassword); err != nil {
 			b.Fatalf("backup: %v", err)
 		}
 		_ = os.Remove(dest)
@@ -121,7 +121,7 @@ func benchmarkRestoreLargeFile(b *testing.B, generator fileGenerator) {
 	manager.DisableEvents()
 
 	backupFile := filepath.Join(tempDir, "backup.qbak")
-	if err := manager.Backup([]string{srcFile}, backupFile, FilterConfig{MaxSize: -1}, true, true, AlgoAES256_CTR, benchmarkPassword); err != nil {
+	if err := manager.Backup([]string{srcFile}, backupFile, FilterConfig{MaxSize: -1}, CodecHuffman, true, AlgoAES256_CTR, benchmarkPassword); err != nil {
 		b.Fatalf("prepare backup: %v", err)
 	}
 	info, err := os.Stat(backupFile)
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+// BackupEntryNode 是备份内容树中的一个节点，根节点的 Path 为空。
+// 目录的 TotalSize 为其下所有文件大小之和；清单中没有记录的中间目录会以默认权限补齐。
+type BackupEntryNode struct {
+	ManifestFile
+	Name      string             `json:"name"`
+	TotalSize int64              `json:"totalSize"`
+	Children  []*BackupEntryNode `json:"children,omitempty"`
+}
+
+// ListBackup 列出备份中的内容而不解压数据。
+// 增量备份的清单记录了备份时的完整文件列表，即整条备份链合并后的最终状态；
+// 没有清单的旧版本备份会逐个读取条目头部。
+func (m *BackupManager) ListBackup(backupFile, password string) (*BackupEntryNode, error) {
+	manifest, err := m.readManifest(backupFile, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []ManifestFile
+	if manifest != nil {
+		files = manifest.Files
+	} else {
+		log.Println("Backup has no manifest, listing entry headers.")
+		files, err = m.listEntries(backupFile, password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buildEntryTree(files), nil
+}
+
+// listEntries 顺序读取归档中的所有条目头部，删除标记会移除之前出现的同名条目及其子项
+func (m *BackupManager) listEntries(backupFile, password string) ([]ManifestFile, error) {
+	reader, err := m.getReaderPipe(backupFile, password)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-m.ctx.Done():
+			_ = reader.Close()
+		case <-done:
+		}
+	}()
+	defer close(done)
+	defer reader.Close()
+
+	archiveReader := NewArchiveReader(reader)
+	filesByPath := make(map[string]ManifestFile, 64)
+	for {
+		meta, err := archiveReader.NextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if m.ctx.Err() != nil {
+				return nil, m.ctx.Err()
+			}
+			return nil, fmt.Errorf("failed to read next archive entry: %w", err)
+		}
+		if err := archiveReader.SkipEntry(meta); err != nil {
+			return nil, fmt.Errorf("failed to skip entry %s: %w", meta.Path, err)
+		}
+
+		if isInternalPath(meta.Path) || meta.Path == "." {
+			continue
+		}
+		if meta.Deleted {
+			prefix := meta.Path + "/"
+			for p := range filesByPath {
+				if p == meta.Path || strings.HasPrefix(p, prefix) {
+					delete(filesByPath, p)
+				}
+			}
+			continue
+		}
+
+		file := ManifestFile{
+			Path:     meta.Path,
+			Mode:     meta.Mode,
+			ModTime:  meta.ModTime,
+			IsDir:    meta.IsDir,
+			IsLink:   meta.IsLink,
+			LinkDest: meta.LinkDest,
+			Xattrs:   meta.Xattrs,
+			HardLink: meta.HardLink,
+			Owner:    meta.Owner,
+			DevMajor: meta.DevMajor,
+			DevMinor: meta.DevMinor,
+			SHA256:   meta.SHA256,
+		}
+		if meta.Mode.IsRegular() {
+			file.Size = meta.Size
+		}
+		// 硬链接条目没有数据，与清单一样显示它指向的文件的大小和哈希
+		if target, ok := filesByPath[meta.HardLink]; ok && meta.HardLink != "" {
+			file.Size = target.Size
+			file.SHA256 = target.SHA256
+		}
+		filesByPath[meta.Path] = file
+	}
+
+	files := make([]ManifestFile, 0, len(filesByPath))
+	for _, f := range filesByPath {
+		files = append(files, f)
+	}
+	sortManifestFiles(files)
+	return files, nil
+}
+
+func buildEntryTree(files []ManifestFile) *BackupEntryNode {
+	root := &BackupEntryNode{ManifestFile: ManifestFile{Mode: os.ModeDir | 0755, IsDir: true}}
+	nodes := map[string]*BackupEntryNode{"": root}
+
+	var ensureDir func(dirPath string) *BackupEntryNode
+	ensureDir = func(dirPath string) *BackupEntryNode {
+		if dirPath == "." {
+			dirPath = ""
+		}
+		if node, ok := nodes[dirPath]; ok {
+			return node
+		}
+		parent := ensureDir(path.Dir(dirPath))
+		node := &BackupEntryNode{
+			ManifestFile: ManifestFile{Path: dirPath, Mode: os.ModeDir | 0755, IsDir: true},
+			Name:         path.Base(dirPath),
+		}
+		parent.Children = append(parent.Children, node)
+		nodes[dirPath] = node
+		return node
+	}
+
+	sorted := append([]ManifestFile(nil), files...)
+	sortManifestFiles(sorted)
+	for _, f := range sorted {
+		if f.Path == "" || f.Path == "." {
+			continue
+		}
+		if node, ok := nodes[f.Path]; ok {
+			// 之前作为中间目录补齐的节点，用实际记录覆盖
+			node.ManifestFile = f
+			continue
+		}
+		parent := ensureDir(path.Dir(f.Path))
+		node := &BackupEntryNode{ManifestFile: f, Name: path.Base(f.Path)}
+		parent.Children = append(parent.Children, node)
+		nodes[f.Path] = node
+	}
+
+	var sumSizes func(node *BackupEntryNode) int64
+	sumSizes = func(node *BackupEntryNode) int64 {
+		if !node.IsDir {
+			// 硬链接与它指向的文件共享数据，不重复计算
+			if node.HardLink == "" {
+				node.TotalSize = node.Size
+			}
+			return node.TotalSize
+		}
+		node.TotalSize = 0
+		for _, child := range node.Children {
+			node.TotalSize += sumSizes(child)
+		}
+		return node.TotalSize
+	}
+	sumSizes(root)
+	return root
+}
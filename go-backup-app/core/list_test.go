@@ -0,0 +1,119 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func findNode(root *BackupEntryNode, relPath string) *BackupEntryNode {
+	if root.Path == relPath {
+		return root
+	}
+	for _, child := range root.Children {
+		if found := findNode(child, relPath); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func TestListBackup_IncrementalChainShowsFinalState(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("aaa"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("bbbbb"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "gone.txt"), []byte("x"), 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	filters := FilterConfig{MaxSize: -1}
+
+	baseFile := filepath.Join(tempDir, "base.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, baseFile, filters, CodecHuffman, true, AlgoChaCha20, "pw"))
+
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "gone.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "c.txt"), []byte("cc"), 0644))
+	incFile := filepath.Join(tempDir, "inc.qbak")
+	require.NoError(t, manager.BackupIncremental([]string{srcDir}, incFile, baseFile, filters, CodecHuffman, true, AlgoChaCha20, "pw"))
+
+	root, err := manager.ListBackup(incFile, "pw")
+	require.NoError(t, err)
+	require.Equal(t, int64(10), root.TotalSize)
+	require.Nil(t, findNode(root, "gone.txt"))
+
+	sub := findNode(root, "sub")
+	require.NotNil(t, sub)
+	require.True(t, sub.IsDir)
+	require.Len(t, sub.Children, 2)
+	require.Equal(t, int64(7), sub.TotalSize)
+
+	b := findNode(root, "sub/b.txt")
+	require.NotNil(t, b)
+	require.Equal(t, "b.txt", b.Name)
+	require.Equal(t, int64(5), b.Size)
+	require.Equal(t, os.FileMode(0600), b.Mode.Perm())
+
+	_, err = manager.ListBackup(incFile, "wrong")
+	require.ErrorIs(t, err, ErrInvalidPassword)
+}
+
+func TestListBackup_ArchiveWithoutManifest(t *testing.T) {
+	tempDir := t.TempDir()
+	backupFile := filepath.Join(tempDir, "legacy.qbak")
+
+	out, err := os.Create(backupFile)
+	require.NoError(t, err)
+	aw := NewArchiveWriter(out)
+	buffer := make([]byte, copyBufferSize)
+	data := []byte("hello")
+	require.NoError(t, aw.WriteEntry(FileMetadata{Path: "docs/readme.md", Size: int64(len(data)), Mode: 0644, HasCRC: true}, bytes.NewReader(data), buffer, nil))
+	require.NoError(t, aw.WriteEntry(FileMetadata{Path: "docs/old.md", Size: 1, Mode: 0644, HasCRC: true}, bytes.NewReader([]byte("x")), buffer, nil))
+	require.NoError(t, aw.WriteEntry(FileMetadata{Path: "docs/old.md", Deleted: true}, nil, buffer, nil))
+	require.NoError(t, out.Close())
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	root, err := manager.ListBackup(backupFile, "")
+	require.NoError(t, err)
+
+	docs := findNode(root, "docs")
+	require.NotNil(t, docs, "missing parent directory should be synthesized")
+	require.True(t, docs.IsDir)
+	require.Len(t, docs.Children, 1)
+	require.Equal(t, "docs/readme.md", docs.Children[0].Path)
+	require.Equal(t, int64(5), root.TotalSize)
+}
+
+func TestListBackup_HardLinksWithoutManifest(t *testing.T) {
+	tempDir := t.TempDir()
+	backupFile := filepath.Join(tempDir, "links.qbak")
+
+	out, err := os.Create(backupFile)
+	require.NoError(t, err)
+	aw := NewArchiveWriter(out)
+	buffer := make([]byte, copyBufferSize)
+	data := []byte("shared data")
+	require.NoError(t, aw.WriteEntry(FileMetadata{Path: "a.bin", Size: int64(len(data)), Mode: 0644, HasCRC: true}, bytes.NewReader(data), buffer, nil))
+	require.NoError(t, aw.WriteEntry(FileMetadata{Path: "sub/b.bin", Mode: 0644, HasCRC: true, HardLink: "a.bin"}, nil, buffer, nil))
+	require.NoError(t, out.Close())
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	root, err := manager.ListBackup(backupFile, "")
+	require.NoError(t, err)
+
+	b := findNode(root, "sub/b.bin")
+	require.NotNil(t, b)
+	require.Equal(t, "a.bin", b.HardLink)
+	require.Equal(t, int64(len(data)), b.Size)
+	require.Equal(t, int64(0), findNode(root, "sub").TotalSize, "link data belongs to a.bin")
+	require.Equal(t, int64(len(data)), root.TotalSize)
+}
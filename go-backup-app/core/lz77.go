@@ -0,0 +1,217 @@
+// core/lz77.go
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// LZ77 + Huffman 块格式 (codec "lzh"):
+// uint64 原始长度 + 码长表 (每个符号 4 bit，先字面量/长度表，后距离表) + 按 MSB 优先写入的位流。
+// 字面量/长度表的符号 0-255 是字面量，256 起是匹配长度的分段；距离表是匹配距离的分段，
+// 分段后的剩余部分以额外位的形式直接写入。匹配只在块内查找，因此各块仍然可以独立并行地压缩和解压。
+// 码长计算、码长表、位流和解码表都使用 canonical.go 中与 huffman 编解码器相同的实现。
+const (
+	lzMinMatch = 4
+	lzMaxMatch = 258
+	lzHashBits = 15
+	lzMaxChain = 32 // 每个位置最多比较的候选数
+
+	lzLengthCodes  = 16 // 覆盖 lzMaxMatch-lzMinMatch
+	lzDistCodes    = 36 // 覆盖 huffmanChunkSize
+	lzLitLenCodes  = 256 + lzLengthCodes
+	lzCodeTableLen = (lzLitLenCodes + lzDistCodes) / 2
+
+	lzMatchFlag = 1 << 31
+)
+
+// lzBucket 把 v 分段: 0-3 各自一段，之后每段覆盖 [2^n, 2^n+2^(n-1)) 或 [2^n+2^(n-1), 2^(n+1))，段内偏移用 n-1 个额外位表示
+func lzBucket(v uint32) (code uint32, extraBits uint, extra uint32) {
+	if v < 4 {
+		return v, 0, 0
+	}
+	n := uint(bits.Len32(v)) - 1
+	extraBits = n - 1
+	return uint32(2*n) + (v>>extraBits)&1, extraBits, v & (1<<extraBits - 1)
+}
+
+// lzBucketBase 返回分段的起始值和额外位数
+func lzBucketBase(code uint32) (base uint32, extraBits uint) {
+	if code < 4 {
+		return code, 0
+	}
+	extraBits = uint(code/2) - 1
+	return (2 | code&1) << extraBits, extraBits
+}
+
+// lzParse 用哈希链查找块内的最长匹配 (贪心)，返回字面量和匹配组成的记号序列。
+// 字面量记号就是字节值；匹配记号为 lzMatchFlag | (长度-lzMinMatch)<<18 | (距离-1)。
+func lzParse(data []byte) []uint32 {
+	tokens := make([]uint32, 0, len(data)/2)
+	head := make([]int32, 1<<lzHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, len(data))
+	hash := func(i int) uint32 {
+		return (binary.LittleEndian.Uint32(data[i:]) * 2654435761) >> (32 - lzHashBits)
+	}
+	insert := func(i int) {
+		if i+lzMinMatch <= len(data) {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+
+	for i := 0; i < len(data); {
+		bestLen, bestDist := 0, 0
+		if i+lzMinMatch <= len(data) {
+			maxLen := min(lzMaxMatch, len(data)-i)
+			for cand, chain := head[hash(i)], lzMaxChain; cand >= 0 && chain > 0; cand, chain = prev[cand], chain-1 {
+				c := int(cand)
+				if data[c+bestLen] != data[i+bestLen] {
+					continue
+				}
+				l := 0
+				for l < maxLen && data[c+l] == data[i+l] {
+					l++
+				}
+				if l > bestLen {
+					bestLen, bestDist = l, i-c
+					if l == maxLen {
+						break
+					}
+				}
+			}
+		}
+
+		if bestLen >= lzMinMatch {
+			tokens = append(tokens, lzMatchFlag|uint32(bestLen-lzMinMatch)<<18|uint32(bestDist-1))
+			for end := i + bestLen; i < end; i++ {
+				insert(i)
+			}
+		} else {
+			tokens = append(tokens, uint32(data[i]))
+			insert(i)
+			i++
+		}
+	}
+	return tokens
+}
+
+// compressLZChunk 压缩单个块: 先做 LZ77 匹配，再对字面量、长度和距离做 Huffman 编码
+func compressLZChunk(originalData []byte) ([]byte, error) {
+	if len(originalData) == 0 {
+		return []byte{}, nil
+	}
+	tokens := lzParse(originalData)
+
+	litFreq := make([]int64, lzLitLenCodes)
+	distFreq := make([]int64, lzDistCodes)
+	for _, t := range tokens {
+		if t&lzMatchFlag == 0 {
+			litFreq[t]++
+			continue
+		}
+		lc, _, _ := lzBucket(t >> 18 & 0xFF)
+		dc, _, _ := lzBucket(t & (1<<18 - 1))
+		litFreq[256+lc]++
+		distFreq[dc]++
+	}
+	litLens := huffmanCodeLengths(litFreq, maxCodeLen)
+	distLens := huffmanCodeLengths(distFreq, maxCodeLen)
+	var litCodes [lzLitLenCodes]uint32
+	var distCodes [lzDistCodes]uint32
+	packCodes(litCodes[:], litLens)
+	packCodes(distCodes[:], distLens)
+
+	out := make([]byte, 8, 8+lzCodeTableLen+len(originalData)/2)
+	binary.BigEndian.PutUint64(out, uint64(len(originalData)))
+	// 两张表的符号数都是偶数，可以分别写入
+	out = appendCodeLengths(appendCodeLengths(out, litLens), distLens)
+
+	bw := bitPacker{buf: out}
+	for _, t := range tokens {
+		if t&lzMatchFlag == 0 {
+			bw.writeCode(litCodes[t])
+			continue
+		}
+		lc, lBits, lExtra := lzBucket(t >> 18 & 0xFF)
+		dc, dBits, dExtra := lzBucket(t & (1<<18 - 1))
+		bw.writeCode(litCodes[256+lc])
+		bw.write(lExtra, lBits)
+		bw.writeCode(distCodes[dc])
+		bw.write(dExtra, dBits)
+	}
+	return bw.flush(), nil
+}
+
+// decompressLZChunk 解压 compressLZChunk 的输出
+func decompressLZChunk(chunkData []byte) ([]byte, error) {
+	if len(chunkData) < 8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	originalLen := binary.BigEndian.Uint64(chunkData)
+	if originalLen == 0 {
+		return []byte{}, nil
+	}
+	if originalLen > uint64(huffmanChunkSize) {
+		return nil, fmt.Errorf("invalid lz original length: %d", originalLen)
+	}
+	if len(chunkData) < 8+lzCodeTableLen {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	lens := readCodeLengths(chunkData[8 : 8+lzCodeTableLen])
+	litDec, err := newHuffmanDecoder(lens[:lzLitLenCodes])
+	if err != nil {
+		return nil, err
+	}
+	distDec, err := newHuffmanDecoder(lens[lzLitLenCodes:])
+	if err != nil {
+		return nil, err
+	}
+
+	br := bitUnpacker{data: chunkData[8+lzCodeTableLen:]}
+	out := make([]byte, 0, originalLen)
+	for uint64(len(out)) < originalLen {
+		sym, err := litDec.decode(&br)
+		if err != nil {
+			return nil, err
+		}
+		if sym < 256 {
+			out = append(out, byte(sym))
+			continue
+		}
+
+		base, extraBits := lzBucketBase(uint32(sym - 256))
+		extra, err := br.read(extraBits)
+		if err != nil {
+			return nil, err
+		}
+		length := int(base+extra) + lzMinMatch
+
+		dsym, err := distDec.decode(&br)
+		if err != nil {
+			return nil, err
+		}
+		base, extraBits = lzBucketBase(uint32(dsym))
+		if extra, err = br.read(extraBits); err != nil {
+			return nil, err
+		}
+		dist := int(base+extra) + 1
+
+		if length > lzMaxMatch || dist > len(out) || uint64(len(out)+length) > originalLen {
+			return nil, fmt.Errorf("invalid lz match (length %d, distance %d) at %d", length, dist, len(out))
+		}
+		// 匹配可能与自身重叠，只能逐字节复制
+		start := len(out) - dist
+		for k := 0; k < length; k++ {
+			out = append(out, out[start+k])
+		}
+	}
+	return out, nil
+}
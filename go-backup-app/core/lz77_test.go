@@ -0,0 +1,123 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLZChunk_RoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	random := make([]byte, huffmanChunkSize)
+	rng.Read(random)
+
+	var logs strings.Builder
+	for i := 0; logs.Len() < huffmanChunkSize-200; i++ {
+		fmt.Fprintf(&logs, `{"time":"2026-01-02T15:04:%02dZ","level":"info","msg":"request served","status":%d}`+"\n", i%60, 200+i%3)
+	}
+
+	cases := map[string][]byte{
+		"single byte":  {'x'},
+		"short":        []byte("abc"),
+		"repeated":     bytes.Repeat([]byte{'a'}, 10000),
+		"overlapping":  []byte("abcabcabcabcabcabcabcabcabcabcabcabcx"),
+		"two symbols":  bytes.Repeat([]byte("ab"), 5000),
+		"logs":         []byte(logs.String()[:huffmanChunkSize-200]),
+		"random":       random,
+		"random tail":  append(bytes.Repeat([]byte("0123456789"), 100), random[:1000]...),
+		"max distance": append(append(append([]byte{}, random[:100]...), random[100:huffmanChunkSize-100]...), random[:100]...),
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			compressed, err := compressLZChunk(data)
+			require.NoError(t, err)
+			decompressed, err := decompressLZChunk(compressed)
+			require.NoError(t, err)
+			require.True(t, bytes.Equal(data, decompressed))
+		})
+	}
+
+	compressed, err := compressLZChunk(cases["logs"])
+	require.NoError(t, err)
+	huffman, err := compressChunk(cases["logs"])
+	require.NoError(t, err)
+	require.Less(t, len(compressed)*4, len(huffman), "back-references should beat order-0 coding on logs")
+
+	empty, err := compressLZChunk(nil)
+	require.NoError(t, err)
+	decompressed, err := decompressLZChunk(append(empty, make([]byte, 8)...))
+	require.NoError(t, err)
+	require.Empty(t, decompressed)
+}
+
+func TestLZChunk_CorruptInput(t *testing.T) {
+	data := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog. "), 2000)
+	compressed, err := compressLZChunk(data)
+	require.NoError(t, err)
+
+	_, err = decompressLZChunk(compressed[:len(compressed)/2])
+	require.Error(t, err)
+
+	// 损坏的数据必须返回错误或错误的内容，而不能越界或 panic
+	rng := rand.New(rand.NewSource(3))
+	for i := 0; i < 200; i++ {
+		corrupt := append([]byte{}, compressed...)
+		for j := 0; j < 4; j++ {
+			corrupt[8+rng.Intn(len(corrupt)-8)] ^= byte(1 + rng.Intn(255))
+		}
+		out, err := decompressLZChunk(corrupt)
+		if err == nil {
+			require.Len(t, out, len(data))
+		}
+	}
+}
+
+func TestLZBucket(t *testing.T) {
+	for _, v := range []uint32{0, 1, 3, 4, 5, 6, 7, 8, 100, 254, 1 << 17, huffmanChunkSize - 1} {
+		code, extraBits, extra := lzBucket(v)
+		base, baseBits := lzBucketBase(code)
+		require.Equal(t, extraBits, baseBits)
+		require.Equal(t, v, base+extra, "v=%d", v)
+	}
+	code, _, _ := lzBucket(lzMaxMatch - lzMinMatch)
+	require.Less(t, int(code), lzLengthCodes)
+	code, _, _ = lzBucket(huffmanChunkSize - 1)
+	require.Less(t, int(code), lzDistCodes)
+}
+
+func TestLZCodec_BackupRestore(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+	var logs strings.Builder
+	for i := 0; logs.Len() < 3*huffmanChunkSize; i++ {
+		fmt.Fprintf(&logs, "2026-01-02 15:04:05 INFO worker-%d processed job %d\n", i%8, i)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "app.log"), []byte(logs.String()), 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	backupFile := filepath.Join(tempDir, "lzh.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, FilterConfig{MaxSize: -1}, CodecLZH, false, 0, ""))
+
+	info, err := os.Stat(backupFile)
+	require.NoError(t, err)
+	require.Less(t, info.Size(), int64(logs.Len()/5))
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	require.NoError(t, manager.Restore(backupFile, restoreDir, ""))
+	data, err := os.ReadFile(filepath.Join(restoreDir, "app.log"))
+	require.NoError(t, err)
+	require.Equal(t, logs.String(), string(data))
+
+	var buf bytes.Buffer
+	require.NoError(t, manager.ExtractFile(backupFile, "app.log", "", &buf))
+	require.Equal(t, logs.String(), buf.String())
+}
@@ -37,6 +37,19 @@ type BackupManager struct {
 	ctx             context.Context
 	emitEvents      bool
 	ConflictHandler ConflictHandler
+
+	// VolumeSize 大于 0 时，Backup、BackupIncremental 和 ImportTar/ImportZip 把输出切分为 name.qbak.001、name.qbak.002 ...
+	// 每个分卷 (包括 16 字节的分卷头部) 不超过 VolumeSize 字节
+	VolumeSize int64
+
+	// Deterministic 为 true 时，相同的源文件 (加密时还需要相同的密码和 Salt) 总是生成相同的备份，
+	// 便于存储层去重以及确认内容没有变化。加密时 nonce 由明文派生，备份流会先以随机密钥加密暂存到临时目录
+	Deterministic bool
+	// Salt 是可复现的加密备份使用的密钥派生 salt，Deterministic 且启用加密时必须设置
+	Salt []byte
+
+	// CompressionPolicy 决定哪些文件在压缩备份中按原样保存，为 nil 时使用 DefaultStoreExtensions 和 DefaultStoreTypes
+	CompressionPolicy *CompressionPolicy
 }
 
 func NewBackupManager(ctx context.Context) *BackupManager {
@@ -127,7 +140,21 @@ func (m *BackupManager) emitProgressDetail(message string, current, total int, b
 }
 
 // Backup has been updated to accept a slice of source paths.
-func (m *BackupManager) Backup(srcPaths []string, destFile string, filters FilterConfig, useCompression bool, useEncryption bool, algorithm uint8, password string) error {
+// codec 是压缩方式的名称 (见 Codecs)，空字符串等同于 CodecStore。
+func (m *BackupManager) Backup(srcPaths []string, destFile string, filters FilterConfig, codec string, useEncryption bool, algorithm uint8, password string) error {
+	dest := &backupDest{path: destFile, volumeSize: m.VolumeSize, deterministic: m.Deterministic}
+	err := m.backup(srcPaths, dest.open, filters, codec, useEncryption, algorithm, password)
+	return dest.close(err)
+}
+
+// BackupTo writes a full backup to w instead of a file, e.g. a socket, a pipe or stdout.
+// w is not closed.
+func (m *BackupManager) BackupTo(srcPaths []string, w io.Writer, filters FilterConfig, codec string, useEncryption bool, algorithm uint8, password string) error {
+	return m.backup(srcPaths, func() (io.Writer, error) { return w, nil }, filters, codec, useEncryption, algorithm, password)
+}
+
+// backup 在扫描完成后才调用 openDest 获取输出，这样扫描失败时不会创建目标文件
+func (m *BackupManager) backup(srcPaths []string, openDest func() (io.Writer, error), filters FilterConfig, codec string, useEncryption bool, algorithm uint8, password string) error {
 	m.emitProgressDetail("正在扫描待备份文件...", 0, 0, 0, 0, "scanning")
 	scanRes, err := m.scanSources(srcPaths, filters)
 	if err != nil {
@@ -142,43 +169,28 @@ func (m *BackupManager) Backup(srcPaths []string, destFile string, filters Filte
 	totalBytes := scanRes.selectedBytes
 	m.emitProgressDetail("正在归档...", 0, totalFiles, 0, totalBytes, "archiving")
 
+	m.sortManifestFiles(scanRes.files)
 	manifest := BackupManifest{
 		Version:   manifestVersion,
 		Type:      BackupTypeFull,
-		CreatedAt: time.Now(),
+		CreatedAt: m.now(),
 		Files:     scanRes.files,
 	}
-	manifestBytes, err := json.Marshal(manifest)
-	if err != nil {
-		return fmt.Errorf("failed to marshal manifest: %w", err)
-	}
 
-	outFile, err := os.Create(destFile)
+	dest, err := openDest()
 	if err != nil {
-		return fmt.Errorf("failed to create destination file: %w", err)
-	}
-	defer outFile.Close()
-
-	var writer io.WriteCloser = outFile
-	if useEncryption {
-		m.emitProgress("正在加密...", 0, 0)
-		encryptedWriter, err := NewEncryptedWriter(writer, password, algorithm)
-		if err != nil {
-			return fmt.Errorf("failed to create encrypted writer: %w", err)
-		}
-		writer = encryptedWriter
-		defer writer.Close()
+		return err
 	}
-
-	if useCompression {
-		m.emitProgress("正在压缩...", 0, 0)
-		compressedWriter := NewCompressedWriter(writer)
-		writer = compressedWriter
-		defer writer.Close()
+	writer, err := m.newBackupWriter(dest, codec, useEncryption, algorithm, password)
+	if err != nil {
+		return err
 	}
+	defer writer.Close()
 
 	archiveWriter := NewArchiveWriter(writer)
-	archiveMutex := &sync.Mutex{}
+	archiveWriter.hashFiles = true
+	order := newEntryOrder(m.ctx, m.Deterministic)
+	defer order.stop()
 
 	var archivedFiles int64
 	var archivedBytes int64
@@ -207,18 +219,13 @@ func (m *BackupManager) Backup(srcPaths []string, destFile string, filters Filte
 		)
 	}
 
-	// Write manifest first.
-	manifestMeta := FileMetadata{
-		Path:    manifestEntryPath,
-		Size:    int64(len(manifestBytes)),
-		Mode:    0644,
-		ModTime: time.Now(),
-	}
-	if err := archiveWriter.WriteEntry(manifestMeta, bytes.NewReader(manifestBytes), make([]byte, copyBufferSize), nil); err != nil {
-		return fmt.Errorf("failed to write manifest: %w", err)
+	// 第一份清单不含内容哈希，内容哈希在写入数据时计算，完整的清单在所有数据之后写入
+	if err := m.writeManifest(archiveWriter, manifest, nil); err != nil {
+		return err
 	}
+	hashes := newContentHashes()
 
-	pathsChan := make(chan archiveJob)
+	pathsChan := make(chan orderedJob)
 	errChan := make(chan error, backupWorkers)
 	var wg sync.WaitGroup
 
@@ -237,6 +244,7 @@ func (m *BackupManager) Backup(srcPaths []string, destFile string, filters Filte
 				info, err := os.Lstat(job.path)
 				if err != nil {
 					errChan <- fmt.Errorf("failed to stat %s: %w", job.path, err)
+					order.skip(job.seq)
 					continue
 				}
 
@@ -246,14 +254,23 @@ func (m *BackupManager) Backup(srcPaths []string, destFile string, filters Filte
 					Mode:    info.Mode(),
 					ModTime: info.ModTime(),
 					IsDir:   info.IsDir(),
+					Xattrs:  job.xattrs,
+					Owner:   job.owner,
+
+					DevMajor: job.devMajor,
+					DevMinor: job.devMinor,
 				}
 
 				var fileReader io.Reader
 				var openedFile *os.File
-				if info.Mode()&os.ModeSymlink != 0 {
+				if job.hardLink != "" {
+					meta.HardLink = job.hardLink
+					meta.Size = 0
+				} else if info.Mode()&os.ModeSymlink != 0 {
 					linkDest, err := os.Readlink(job.path)
 					if err != nil {
 						errChan <- fmt.Errorf("failed to read link %s: %w", job.path, err)
+						order.skip(job.seq)
 						continue
 					}
 					meta.IsLink = true
@@ -264,10 +281,19 @@ func (m *BackupManager) Backup(srcPaths []string, destFile string, filters Filte
 					file, err := os.Open(job.path)
 					if err != nil {
 						errChan <- fmt.Errorf("failed to open file %s: %w", job.path, err)
+						order.skip(job.seq)
 						continue
 					}
 					openedFile = file
-					fileReader = bufio.NewReaderSize(file, copyBufferSize)
+					data := openEntryData(file, &meta)
+					meta.Compression = m.entryCompression(codec, &meta, func() []byte { return readFileHead(file) })
+					fileReader, err = order.prefetch(data, meta.payloadSize())
+					if err != nil {
+						_ = file.Close()
+						errChan <- fmt.Errorf("failed to read file %s: %w", job.path, err)
+						order.skip(job.seq)
+						continue
+					}
 				} else {
 					meta.Size = 0
 				}
@@ -280,11 +306,19 @@ func (m *BackupManager) Backup(srcPaths []string, destFile string, filters Filte
 					emitArchivingProgress(fmt.Sprintf("正在归档: %s", relPath), false)
 				}
 
-				archiveMutex.Lock()
-				err = archiveWriter.WriteEntry(meta, fileReader, buffer, onWrite)
-				archiveMutex.Unlock()
+				if !order.acquire(job.seq) {
+					if openedFile != nil {
+						_ = openedFile.Close()
+					}
+					return
+				}
+				err = archiveWriter.writeEntry(&meta, fileReader, buffer, onWrite)
+				order.release()
 
 				if openedFile != nil {
+					if err == nil {
+						m.warnIfChanged(openedFile, info, relPath)
+					}
 					_ = openedFile.Close()
 				}
 
@@ -292,6 +326,7 @@ func (m *BackupManager) Backup(srcPaths []string, destFile string, filters Filte
 					errChan <- fmt.Errorf("failed to archive %s: %w", job.path, err)
 					continue
 				}
+				hashes.add(&meta)
 
 				if !meta.IsDir {
 					atomic.AddInt64(&archivedFiles, 1)
@@ -303,7 +338,7 @@ func (m *BackupManager) Backup(srcPaths []string, destFile string, filters Filte
 
 	go func() {
 		defer close(pathsChan)
-		for _, job := range scanRes.jobs {
+		for _, job := range m.orderJobs(scanRes.jobs) {
 			select {
 			case <-m.ctx.Done():
 				return
@@ -319,18 +354,182 @@ func (m *BackupManager) Backup(srcPaths []string, destFile string, filters Filte
 		return err
 	}
 
+	if err := m.ctx.Err(); err != nil {
+		return err
+	}
+	if err := m.writeManifest(archiveWriter, manifest, hashes); err != nil {
+		return err
+	}
+	if err := archiveWriter.WriteIndex(); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finish backup stream: %w", err)
+	}
+
 	m.emitProgressDetail("备份完成", totalFiles, totalFiles, totalBytes, totalBytes, "archiving")
 	return nil
 }
 
+// writeManifest 写入清单条目。备份在数据之前写一份清单，让流式恢复和抢救恢复在读到数据之前
+// 就知道文件列表和父备份；数据之后再写一份，带有 hashes 中写入数据时计算的内容哈希，
+// 索引记录后一份的位置。hashes 为 nil 时按原样写入
+func (m *BackupManager) writeManifest(aw *ArchiveWriter, manifest BackupManifest, hashes *contentHashes) error {
+	if hashes != nil {
+		hashes.fill(manifest.Files)
+	}
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	meta := FileMetadata{
+		Path:    manifestEntryPath,
+		Size:    int64(len(manifestBytes)),
+		Mode:    0644,
+		ModTime: m.now(),
+	}
+	if err := aw.WriteEntry(meta, bytes.NewReader(manifestBytes), make([]byte, copyBufferSize), nil); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// backupDest 延迟创建的备份目标文件
+type backupDest struct {
+	path          string
+	volumeSize    int64
+	deterministic bool
+	file          io.WriteCloser
+}
+
+func (d *backupDest) open() (io.Writer, error) {
+	if d.volumeSize > 0 {
+		// 同名的单文件备份会被分卷集合覆盖，避免读取时选中旧文件
+		_ = os.Remove(d.path)
+		w, err := newVolumeWriter(d.path, d.volumeSize, d.deterministic)
+		if err != nil {
+			return nil, err
+		}
+		d.file = w
+		return w, nil
+	}
+	f, err := os.Create(d.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create destination file: %w", err)
+	}
+	d.file = f
+	return f, nil
+}
+
+// close 关闭目标文件 (分卷时标记最后一个分卷) 并返回第一个错误
+func (d *backupDest) close(err error) error {
+	if d.file == nil {
+		return err
+	}
+	if closeErr := d.file.Close(); err == nil && closeErr != nil {
+		return fmt.Errorf("failed to close destination file: %w", closeErr)
+	}
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+type chainedWriteCloser struct {
+	w         io.Writer
+	closers   []io.Closer
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (c *chainedWriteCloser) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+// setStored 转发给压缩层；没有压缩层时数据本来就按原样保存
+func (c *chainedWriteCloser) setStored(stored bool) error {
+	if sw, ok := c.w.(storeSwitcher); ok {
+		return sw.setStored(stored)
+	}
+	return nil
+}
+
+func (c *chainedWriteCloser) Close() error {
+	c.closeOnce.Do(func() {
+		for i := len(c.closers) - 1; i >= 0; i-- {
+			if err := c.closers[i].Close(); err != nil && c.closeErr == nil {
+				c.closeErr = err
+			}
+		}
+	})
+	return c.closeErr
+}
+
+// newBackupWriter 在 w 之上按需叠加加密层和压缩层。Close 会依次刷新各层，但不会关闭 w。
+func (m *BackupManager) newBackupWriter(w io.Writer, codecName string, useEncryption bool, algorithm uint8, password string) (io.WriteCloser, error) {
+	codec, err := CodecByName(codecName)
+	if err != nil {
+		return nil, err
+	}
+
+	var writer io.WriteCloser = nopWriteCloser{w}
+	closers := make([]io.Closer, 0, 2)
+
+	if useEncryption {
+		m.emitProgress("正在加密...", 0, 0)
+		var encryptedWriter io.WriteCloser
+		var err error
+		if m.Deterministic {
+			if len(m.Salt) == 0 {
+				return nil, ErrSaltRequired
+			}
+			encryptedWriter, err = NewDeterministicEncryptedWriter(writer, password, algorithm, m.Salt)
+		} else {
+			encryptedWriter, err = NewEncryptedWriter(writer, password, algorithm)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create encrypted writer: %w", err)
+		}
+		writer = encryptedWriter
+		closers = append(closers, encryptedWriter)
+	}
+
+	if codec.Name() != CodecStore {
+		m.emitProgress("正在压缩...", 0, 0)
+		compressedWriter, err := newCodecWriter(writer, codec)
+		if err != nil {
+			return nil, err
+		}
+		writer = compressedWriter
+		closers = append(closers, compressedWriter)
+	}
+
+	return &chainedWriteCloser{w: writer, closers: closers}, nil
+}
+
 func (m *BackupManager) getReaderPipe(backupFile string, password string) (io.ReadCloser, error) {
-	inFile, err := os.Open(backupFile)
+	inFile, err := openBackupSource(backupFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open backup file: %w", err)
 	}
+	return m.newReaderPipe(inFile, inFile, password)
+}
+
+// newReaderPipe 识别 r 上的加密层和压缩层并返回明文归档流；closer 不为 nil 时会随返回值一起关闭
+func (m *BackupManager) newReaderPipe(r io.Reader, closer io.Closer, password string) (io.ReadCloser, error) {
+	return m.newReaderPipeWith(r, closer, password, Codec.NewReader)
+}
 
-	var reader io.Reader = inFile
-	closers := []io.Closer{inFile}
+// newReaderPipeWith 与 newReaderPipe 相同，压缩层由 decompress 解压；传给 decompress 的 r 位于流头之后
+func (m *BackupManager) newReaderPipeWith(r io.Reader, closer io.Closer, password string, decompress func(c Codec, r io.Reader) (io.ReadCloser, error)) (io.ReadCloser, error) {
+	var reader io.Reader = r
+	closers := make([]io.Closer, 0, 3)
+	if closer != nil {
+		closers = append(closers, closer)
+	}
 	closeAll := func() {
 		for i := len(closers) - 1; i >= 0; i-- {
 			_ = closers[i].Close()
@@ -361,10 +560,16 @@ func (m *BackupManager) getReaderPipe(backupFile string, password string) (io.Re
 	}
 
 	bufReaderForCompression := bufio.NewReaderSize(reader, copyBufferSize)
-	magic, err = bufReaderForCompression.Peek(len(huffmanMagic))
-	if err == nil && bytes.Equal(magic, huffmanMagic) {
-		log.Println("Compressed data detected.")
-		compressedReader, err := NewCompressedReader(bufReaderForCompression)
+	magic, _ = bufReaderForCompression.Peek(codecHeaderLen)
+	codec, headerLen, err := detectCodec(magic)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	if codec != nil {
+		log.Printf("Compressed data detected (%s).", codec.Name())
+		_, _ = bufReaderForCompression.Discard(headerLen)
+		compressedReader, err := decompress(codec, bufReaderForCompression)
 		if err != nil {
 			closeAll()
 			return nil, fmt.Errorf("failed to create decompressor: %w", err)
@@ -375,12 +580,7 @@ func (m *BackupManager) getReaderPipe(backupFile string, password string) (io.Re
 		// For encrypted files, validate the next layer early so incorrect passwords fail fast.
 		if encrypted {
 			peek, peekErr := bufReaderForCompression.Peek(5)
-			if peekErr != nil {
-				closeAll()
-				return nil, ErrInvalidPassword
-			}
-			headerLen := binary.BigEndian.Uint32(peek[:4])
-			if headerLen == 0 || headerLen > maxArchiveHeaderLen || peek[4] != '{' {
+			if peekErr != nil || !looksLikeArchiveStart(peek) {
 				closeAll()
 				return nil, ErrInvalidPassword
 			}
@@ -391,8 +591,20 @@ func (m *BackupManager) getReaderPipe(backupFile string, password string) (io.Re
 	return &chainedReadCloser{r: reader, closers: closers}, nil
 }
 
-// runRestore 并行、分块恢复文件
-func (m *BackupManager) runRestore(archiveReader *ArchiveReader, restoreDir string) error {
+// looksLikeArchiveStart 判断数据开头是否像一个归档 (v2 的魔数或 v1 的条目头部)，用于尽早识别错误的密码
+func looksLikeArchiveStart(peek []byte) bool {
+	if bytes.HasPrefix(peek, archiveMagicV2) {
+		return true
+	}
+	if len(peek) < 5 {
+		return false
+	}
+	headerLen := binary.BigEndian.Uint32(peek[:4])
+	return headerLen != 0 && headerLen <= maxArchiveHeaderLen && peek[4] == '{'
+}
+
+// runRestore 并行、分块恢复文件；未被 opts 选中的条目 (包括删除标记) 会被直接跳过
+func (m *BackupManager) runRestore(archiveReader *ArchiveReader, restoreDir string, opts RestoreOptions) error {
 	m.emitProgressDetail("正在扫描备份文件...", 0, 0, 0, 0, "scanning")
 
 	var totalFiles int64
@@ -446,6 +658,17 @@ func (m *BackupManager) runRestore(archiveReader *ArchiveReader, restoreDir stri
 		}()
 	}
 
+	// 硬链接在所有数据写完之后再创建
+	var pendingLinks []pendingHardLink
+	// 选择性恢复时，如果硬链接被选中而它指向的路径没有被选中，数据改为恢复到第一个被选中的链接路径
+	linkHolders := make(map[string]string)
+	// 符号链接在硬链接之后创建，这样之后写入的条目都不会经过归档中的链接
+	var pendingSymlinks []FileMetadata
+	owners := newOwnerMapper(opts)
+	root := newRestoreRoot(restoreDir)
+
+	manifestSeen := false
+
 	producerErr := func() error {
 		defer close(jobsChan)
 		producerBuffer := make([]byte, copyBufferSize)
@@ -471,8 +694,6 @@ func (m *BackupManager) runRestore(archiveReader *ArchiveReader, restoreDir stri
 			default:
 			}
 
-			destPath := filepath.Join(restoreDir, meta.Path)
-
 			// Internal metadata entries (e.g. manifest).
 			if isInternalPath(meta.Path) {
 				if meta.Path == manifestEntryPath {
@@ -493,22 +714,39 @@ func (m *BackupManager) runRestore(archiveReader *ArchiveReader, restoreDir stri
 						}
 					}
 
+					// 数据之后还有一份带内容哈希的清单，文件列表与第一份相同
+					if manifestSeen {
+						continue
+					}
+					manifestSeen = true
+
 					manifest, err := UnmarshalManifest(payload)
 					if err != nil {
 						return fmt.Errorf("failed to parse manifest: %w", err)
 					}
 
+					if manifest != nil {
+						for _, f := range manifest.Files {
+							if f.HardLink == "" || !opts.ShouldRestore(f.Path) || opts.ShouldRestore(f.HardLink) {
+								continue
+							}
+							if _, ok := linkHolders[f.HardLink]; !ok {
+								linkHolders[f.HardLink] = f.Path
+							}
+						}
+					}
+
 					if manifest != nil && manifest.Type == BackupTypeFull {
 						var files int64
 						var bytes int64
 						for _, f := range manifest.Files {
-							if f.IsDir {
+							if f.IsDir || !opts.ShouldRestore(f.Path) {
 								continue
 							}
 							if f.IsLink || f.Mode.IsRegular() {
 								files++
 							}
-							if !f.IsLink && f.Mode.IsRegular() && f.Size > 0 {
+							if !f.IsLink && f.HardLink == "" && f.Mode.IsRegular() && f.Size > 0 {
 								bytes += f.Size
 							}
 						}
@@ -523,22 +761,41 @@ func (m *BackupManager) runRestore(archiveReader *ArchiveReader, restoreDir stri
 					continue
 				}
 
-				if meta.Size > 0 {
-					if _, err := io.CopyN(io.Discard, archiveReader.r, meta.Size); err != nil {
-						return fmt.Errorf("failed to skip internal entry %s: %w", meta.Path, err)
-					}
+				if err := archiveReader.copyEntryData(meta, io.Discard, producerBuffer); err != nil {
+					return fmt.Errorf("failed to skip internal entry %s: %w", meta.Path, err)
 				}
-				if meta.HasCRC {
-					var ignored uint32
-					if err := binary.Read(archiveReader.r, binary.BigEndian, &ignored); err != nil {
-						return fmt.Errorf("failed to skip internal crc32 for %s: %w", meta.Path, err)
+				continue
+			}
+
+			destRel := meta.Path
+			if !opts.ShouldRestore(meta.Path) {
+				holder, ok := linkHolders[meta.Path]
+				if !ok || meta.Deleted || meta.HardLink != "" {
+					if err := archiveReader.SkipEntry(meta); err != nil {
+						return fmt.Errorf("failed to skip entry %s: %w", meta.Path, err)
 					}
+					continue
+				}
+				destRel = holder
+			}
+			destPath, err := root.path(destRel)
+			if m.skipSymlinked(err) {
+				if err := archiveReader.SkipEntry(meta); err != nil {
+					return fmt.Errorf("failed to skip entry %s: %w", meta.Path, err)
 				}
 				continue
 			}
+			if err != nil {
+				return err
+			}
+			if opts.SkipXattrs {
+				meta.Xattrs = nil
+			}
+			meta.Owner = owners.resolve(meta.Owner)
 
 			// Deletion marker (incremental backups).
 			if meta.Deleted {
+				root.forget(meta.Path)
 				if meta.Size > 0 {
 					if _, err := io.CopyN(io.Discard, archiveReader.r, meta.Size); err != nil {
 						return fmt.Errorf("failed to skip deleted entry payload for %s: %w", meta.Path, err)
@@ -569,11 +826,37 @@ func (m *BackupManager) runRestore(archiveReader *ArchiveReader, restoreDir stri
 			}
 
 			switch {
-			case meta.IsLink, meta.IsDir:
+			case meta.HardLink != "":
+				target := meta.HardLink
+				if holder, ok := linkHolders[target]; ok {
+					if holder == meta.Path {
+						continue // 数据已经恢复到这个路径
+					}
+					target = holder
+				}
+				targetPath, err := root.path(target)
+				if m.skipSymlinked(err) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				pendingLinks = append(pendingLinks, pendingHardLink{
+					meta:       *meta,
+					destPath:   destPath,
+					targetPath: targetPath,
+				})
+			case meta.IsLink:
+				if !m.refuseSymlink(meta, opts) {
+					pendingSymlinks = append(pendingSymlinks, *meta)
+				}
+			case meta.IsDir:
+				// 在这里而不是在 worker 中替换已有的符号链接，后续条目检查上级目录时才不会看到它
+				if err := removeSymlink(destPath); err != nil {
+					return err
+				}
 				metaCopy := *meta
 				destPathCopy := destPath
-				relPath := metaCopy.Path
-				isDir := metaCopy.IsDir
 				select {
 				case <-m.ctx.Done():
 					return m.ctx.Err()
@@ -586,17 +869,11 @@ func (m *BackupManager) runRestore(archiveReader *ArchiveReader, restoreDir stri
 					default:
 					}
 
-					err := m.createDirOrLink(&metaCopy, destPathCopy)
-					if err != nil {
+					if err := m.createDirOrLink(&metaCopy, destPathCopy); err != nil {
 						select {
 						case errChan <- err:
 						default:
 						}
-						return
-					}
-					if !isDir {
-						atomic.AddInt64(&restoredFiles, 1)
-						emitRestoreProgress(fmt.Sprintf("已恢复: %s", relPath), true)
 					}
 				}
 			case meta.Mode.IsRegular():
@@ -641,14 +918,20 @@ func (m *BackupManager) runRestore(archiveReader *ArchiveReader, restoreDir stri
 					},
 				}
 
-				limitedReader := io.LimitReader(archiveReader.r, metaCopy.Size)
+				limitedReader := io.LimitReader(archiveReader.r, metaCopy.payloadSize())
+				var dataReader io.Reader = limitedReader
+				var contentHash *contentHasher
+				if metaCopy.hasSHA256Trailer() {
+					contentHash = newContentHasher(&metaCopy)
+					dataReader = io.TeeReader(dataReader, contentHash)
+				}
 				var crcSum uint32
 				if metaCopy.HasCRC {
 					h := crc32.NewIEEE()
-					_, err = io.CopyBuffer(writer, io.TeeReader(limitedReader, h), producerBuffer)
+					_, err = io.CopyBuffer(writer, io.TeeReader(dataReader, h), producerBuffer)
 					crcSum = h.Sum32()
 				} else {
-					_, err = io.CopyBuffer(writer, limitedReader, producerBuffer)
+					_, err = io.CopyBuffer(writer, dataReader, producerBuffer)
 				}
 				if err != nil {
 					pw.CloseWithError(err)
@@ -656,21 +939,57 @@ func (m *BackupManager) runRestore(archiveReader *ArchiveReader, restoreDir stri
 				}
 
 				if metaCopy.HasCRC {
-					var expected uint32
-					if err := binary.Read(archiveReader.r, binary.BigEndian, &expected); err != nil {
+					// 尾部中的内容哈希写入 meta 而不是 worker 正在使用的 metaCopy
+					expected, err := readTrailer(archiveReader.r, meta)
+					if err != nil {
 						pw.CloseWithError(err)
-						return fmt.Errorf("failed to read crc32 for %s: %w", relPath, err)
+						return err
 					}
 					if crcSum != expected {
-						mismatchErr := fmt.Errorf("crc32 mismatch for %s", relPath)
+						mismatchErr := fmt.Errorf("%w for %s", ErrChecksumMismatch, relPath)
 						pw.CloseWithError(mismatchErr)
 						return mismatchErr
 					}
 				}
+				if contentHash != nil {
+					if err := contentHash.check(meta); err != nil {
+						pw.CloseWithError(err)
+						return err
+					}
+				}
 
 				pw.Close()
 				atomic.AddInt64(&restoredFiles, 1)
 				emitRestoreProgress(fmt.Sprintf("已恢复: %s", relPath), true)
+			case meta.Mode&(os.ModeNamedPipe|os.ModeDevice) != 0:
+				if !opts.SpecialFiles {
+					log.Printf("Skipped special file %s (%s)", meta.Path, meta.Mode.Type())
+					m.emitLog(fmt.Sprintf("已跳过特殊文件: %s", meta.Path))
+					continue
+				}
+				metaCopy := *meta
+				destPathCopy := destPath
+				jobsChan <- func() {
+					select {
+					case <-m.ctx.Done():
+						return
+					default:
+					}
+
+					if err := m.createSpecialFile(&metaCopy, destPathCopy); err != nil {
+						select {
+						case errChan <- err:
+						default:
+						}
+						return
+					}
+					atomic.AddInt64(&restoredFiles, 1)
+					emitRestoreProgress(fmt.Sprintf("已恢复: %s", metaCopy.Path), true)
+				}
+			default:
+				// 旧版本备份中可能有套接字条目
+				log.Printf("Skipped %s: unsupported entry type %s", meta.Path, meta.Mode.Type())
+				m.emitLog(fmt.Sprintf("已跳过不支持的条目: %s", meta.Path))
 			}
 		}
 	}()
@@ -692,80 +1011,235 @@ func (m *BackupManager) runRestore(archiveReader *ArchiveReader, restoreDir stri
 		return err
 	}
 
+	for i := range pendingLinks {
+		link := &pendingLinks[i]
+		err := m.restoreHardLink(&link.meta, link.destPath, link.targetPath)
+		if m.skipSymlinked(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		atomic.AddInt64(&restoredFiles, 1)
+		emitRestoreProgress(fmt.Sprintf("已恢复: %s", link.meta.Path), true)
+	}
+
+	// 前面创建的符号链接可能成为后面链接的上级目录，因此重新检查路径
+	root = newRestoreRoot(restoreDir)
+	for i := range pendingSymlinks {
+		link := &pendingSymlinks[i]
+		destPath, err := root.path(link.Path)
+		if m.skipSymlinked(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := m.createDirOrLink(link, destPath); err != nil {
+			return err
+		}
+		atomic.AddInt64(&restoredFiles, 1)
+		emitRestoreProgress(fmt.Sprintf("已恢复: %s", link.Path), true)
+	}
+
 	emitRestoreProgress("恢复完成", true)
 	return nil
 }
 
+type pendingHardLink struct {
+	meta       FileMetadata
+	destPath   string
+	targetPath string
+}
+
+// restoreHardLink 创建硬链接；失败时 (例如跨文件系统，或文件系统不支持硬链接) 退化为复制文件。
+// 目标是符号链接时返回 ErrSymlinkedPath: 链接符号链接会在 destPath 得到同样的链接，复制则会跟随它读取恢复目录之外的文件
+func (m *BackupManager) restoreHardLink(meta *FileMetadata, destPath, targetPath string) error {
+	if info, err := os.Lstat(targetPath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%w: hard link target %s is a symbolic link", ErrSymlinkedPath, targetPath)
+	}
+	destPath, skip, err := m.resolveConflict(destPath)
+	if err != nil || skip {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create parent dir for %s: %w", destPath, err)
+	}
+	// os.Link 不会覆盖已存在的文件
+	if err := os.Remove(destPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to replace %s: %w", destPath, err)
+	}
+
+	err = os.Link(targetPath, destPath)
+	if err == nil {
+		return nil
+	}
+	log.Printf("Warn: could not create hard link %s -> %s, copying instead: %v", destPath, targetPath, err)
+
+	src, err := os.Open(targetPath)
+	if err != nil {
+		return fmt.Errorf("failed to open hard link target %s: %w", targetPath, err)
+	}
+	defer src.Close()
+	outFile, err := os.Create(destPath)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", destPath, err)
+	}
+	defer outFile.Close()
+
+	buffer := restoreCopyBufferPool.Get().([]byte)
+	defer restoreCopyBufferPool.Put(buffer)
+	if _, err := io.CopyBuffer(outFile, src, buffer); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", targetPath, destPath, err)
+	}
+
+	m.restoreOwner(meta, destPath)
+	if err := outFile.Chmod(meta.Mode.Perm()); err != nil {
+		log.Printf("Warn: could not chmod %s: %v", destPath, err)
+	}
+	m.restoreXattrs(meta, destPath)
+	_ = os.Chtimes(destPath, meta.ModTime, meta.ModTime)
+	return nil
+}
+
 func (m *BackupManager) createDirOrLink(meta *FileMetadata, destPath string) error {
 	if _, err := os.Lstat(destPath); err == nil {
 		// TODO
 		// 文件夹冲突处理
 	}
+	if err := removeSymlink(destPath); err != nil {
+		return err
+	}
 
 	if meta.IsLink {
+		// 选择性恢复时父目录条目可能没有被选中
+		_ = os.MkdirAll(filepath.Dir(destPath), 0755)
 		if err := os.Symlink(meta.LinkDest, destPath); err != nil {
 			log.Printf("Warn: could not create symlink %s -> %s: %v", destPath, meta.LinkDest, err)
+			return nil
 		}
-	} else if meta.IsDir {
+		m.restoreOwner(meta, destPath)
+		m.restoreXattrs(meta, destPath)
+		// Chmod/Chtimes 会跟随链接修改目标文件，因此不对符号链接执行
+		return nil
+	}
+	if meta.IsDir {
 		if err := os.MkdirAll(destPath, meta.Mode.Perm()); err != nil {
 			return fmt.Errorf("failed to create directory %s: %w", destPath, err)
 		}
 	}
 
+	m.restoreOwner(meta, destPath)
 	if err := os.Chmod(destPath, meta.Mode.Perm()); err != nil {
 		log.Printf("Warn: could not chmod %s: %v", destPath, err)
 	}
+	m.restoreXattrs(meta, destPath)
 	_ = os.Chtimes(destPath, meta.ModTime, meta.ModTime)
 	return nil
 }
 
-func (m *BackupManager) writeFileFromPipe(meta *FileMetadata, destPath string, pr *io.PipeReader, buffer []byte) error {
-	defer pr.Close()
+// createSpecialFile 重建 FIFO 或设备节点，创建失败 (例如没有权限创建设备节点) 时只记录警告
+func (m *BackupManager) createSpecialFile(meta *FileMetadata, destPath string) error {
+	destPath, skip, err := m.resolveConflict(destPath)
+	if err != nil || skip {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create parent dir for %s: %w", destPath, err)
+	}
+	if info, err := os.Lstat(destPath); err == nil && !info.IsDir() {
+		_ = os.Remove(destPath)
+	}
 
-	// Conflict Resolution
-	if _, err := os.Lstat(destPath); err == nil {
-		if m.ConflictHandler != nil {
-			action, err := m.ConflictHandler(destPath)
-			if err != nil {
-				return err
-			}
-			switch action {
-			case ActionSkip:
-				m.emitLog(fmt.Sprintf("Skipping existing file: %s", destPath))
-				// BUG FIX: 必须消费掉管道中的数据，否则写入端会阻塞然后报错"write on closed pipe"
-				_, _ = io.Copy(io.Discard, pr)
-				return nil
-			case ActionKeepBoth:
-				// Find a new name, e.g., file.txt -> file (1).txt
-				dir, file := filepath.Split(destPath)
-				ext := filepath.Ext(file)
-				base := strings.TrimSuffix(file, ext)
-				for i := 1; ; i++ {
-					newName := fmt.Sprintf("%s (%d)%s", base, i, ext)
-					newPath := filepath.Join(dir, newName)
-					if _, err := os.Lstat(newPath); os.IsNotExist(err) {
-						destPath = newPath
-						break
-					}
-				}
-				m.emitLog(fmt.Sprintf("Keeping both, restoring to: %s", destPath))
-			case ActionOverwrite:
-				m.emitLog(fmt.Sprintf("Overwriting existing file: %s", destPath))
-				// Proceed to create/truncate
+	if err := mknod(destPath, meta.Mode, meta.DevMajor, meta.DevMinor); err != nil {
+		log.Printf("Warn: could not create %s: %v", destPath, err)
+		return nil
+	}
+	m.restoreOwner(meta, destPath)
+	if err := os.Chmod(destPath, meta.Mode.Perm()); err != nil {
+		log.Printf("Warn: could not chmod %s: %v", destPath, err)
+	}
+	m.restoreXattrs(meta, destPath)
+	_ = os.Chtimes(destPath, meta.ModTime, meta.ModTime)
+	return nil
+}
+
+// restoreXattrs 恢复扩展属性，失败时只记录警告 (例如目标文件系统不支持，或没有权限设置 security.* 属性)
+func (m *BackupManager) restoreXattrs(meta *FileMetadata, destPath string) {
+	if len(meta.Xattrs) == 0 {
+		return
+	}
+	if err := applyXattrs(destPath, meta.Xattrs); err != nil {
+		log.Printf("Warn: could not restore xattrs of %s: %v", destPath, err)
+	}
+}
+
+// resolveConflict 在目标已存在时询问 ConflictHandler，返回实际要写入的路径以及是否跳过
+func (m *BackupManager) resolveConflict(destPath string) (string, bool, error) {
+	if _, err := os.Lstat(destPath); err != nil || m.ConflictHandler == nil {
+		return destPath, false, nil
+	}
+
+	action, err := m.ConflictHandler(destPath)
+	if err != nil {
+		return "", false, err
+	}
+	switch action {
+	case ActionSkip:
+		m.emitLog(fmt.Sprintf("Skipping existing file: %s", destPath))
+		return destPath, true, nil
+	case ActionKeepBoth:
+		// Find a new name, e.g., file.txt -> file (1).txt
+		dir, file := filepath.Split(destPath)
+		ext := filepath.Ext(file)
+		base := strings.TrimSuffix(file, ext)
+		for i := 1; ; i++ {
+			newName := fmt.Sprintf("%s (%d)%s", base, i, ext)
+			newPath := filepath.Join(dir, newName)
+			if _, err := os.Lstat(newPath); os.IsNotExist(err) {
+				destPath = newPath
+				break
 			}
 		}
+		m.emitLog(fmt.Sprintf("Keeping both, restoring to: %s", destPath))
+	case ActionOverwrite:
+		m.emitLog(fmt.Sprintf("Overwriting existing file: %s", destPath))
+		// Proceed to create/truncate
+	}
+	return destPath, false, nil
+}
+
+func (m *BackupManager) writeFileFromPipe(meta *FileMetadata, destPath string, pr *io.PipeReader, buffer []byte) error {
+	defer pr.Close()
+
+	destPath, skip, err := m.resolveConflict(destPath)
+	if err != nil {
+		return err
+	}
+	if skip {
+		// BUG FIX: 必须消费掉管道中的数据，否则写入端会阻塞然后报错"write on closed pipe"
+		_, _ = io.Copy(io.Discard, pr)
+		return nil
 	}
 
 	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
 		return fmt.Errorf("failed to create parent dir for %s: %w", destPath, err)
 	}
+	// os.Create 会跟随已有的符号链接
+	if err := removeSymlink(destPath); err != nil {
+		return err
+	}
 	outFile, err := os.Create(destPath)
 	if err != nil {
 		return fmt.Errorf("failed to create file %s: %w", destPath, err)
 	}
 	defer outFile.Close()
 
-	_, err = io.CopyBuffer(outFile, pr, buffer)
+	if meta.Sparse {
+		err = writeSparse(outFile, pr, meta, buffer)
+	} else {
+		_, err = io.CopyBuffer(outFile, pr, buffer)
+	}
 	if err != nil {
 		// 检查错误是否是由于管道关闭引起的，这通常是正常情况，因为生产者完成了写入。
 		if !errors.Is(err, io.ErrClosedPipe) {
@@ -773,9 +1247,11 @@ func (m *BackupManager) writeFileFromPipe(meta *FileMetadata, destPath string, p
 		}
 	}
 
+	m.restoreOwner(meta, destPath)
 	if err := outFile.Chmod(meta.Mode.Perm()); err != nil {
 		log.Printf("Warn: could not chmod %s: %v", destPath, err)
 	}
+	m.restoreXattrs(meta, destPath)
 	_ = os.Chtimes(destPath, meta.ModTime, meta.ModTime)
 	return nil
 }
@@ -25,7 +25,7 @@ func TestBackupFailsWhenNoFilesSelectedByFilters(t *testing.T) {
 		MaxSize:      -1,
 	}
 
-	err := manager.Backup([]string{srcDir}, destFile, filters, true, false, 0, "")
+	err := manager.Backup([]string{srcDir}, destFile, filters, CodecHuffman, false, 0, "")
 	require.Error(t, err)
 	require.ErrorIs(t, err, ErrNoFilesSelected)
 
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"os/user"
+	"strconv"
+)
+
+// FileOwner 记录文件的属主，名称在备份时解析，解析失败时为空
+type FileOwner struct {
+	UID   int    `json:"uid"`
+	GID   int    `json:"gid"`
+	User  string `json:"user,omitempty"`
+	Group string `json:"group,omitempty"`
+}
+
+// OwnershipMode 决定恢复时如何设置文件属主
+type OwnershipMode string
+
+const (
+	OwnershipIgnore OwnershipMode = "ignore" // 不修改属主 (默认)，文件属于执行恢复的用户
+	OwnershipAsIs   OwnershipMode = "asIs"   // 使用备份时的 uid/gid
+	OwnershipByName OwnershipMode = "byName" // 按用户名/组名在本机查找，找不到时使用备份时的 uid/gid
+	OwnershipMap    OwnershipMode = "map"    // 按 UIDMap/GIDMap 转换，表中没有的 id 保持不变
+)
+
+func (mode OwnershipMode) validate() error {
+	switch mode {
+	case "", OwnershipIgnore, OwnershipAsIs, OwnershipByName, OwnershipMap:
+		return nil
+	}
+	return fmt.Errorf("unknown ownership mode %q", mode)
+}
+
+func equalOwner(a, b *FileOwner) bool {
+	// 旧版本备份没有记录属主，此时不作比较
+	if a == nil || b == nil {
+		return true
+	}
+	return a.UID == b.UID && a.GID == b.GID
+}
+
+// ownerNames 缓存 uid/gid 到名称的解析结果，避免每个文件都读取一次用户数据库
+type ownerNames struct {
+	users  map[int]string
+	groups map[int]string
+}
+
+func newOwnerNames() *ownerNames {
+	return &ownerNames{users: make(map[int]string), groups: make(map[int]string)}
+}
+
+func (n *ownerNames) owner(uid, gid int) *FileOwner {
+	name, ok := n.users[uid]
+	if !ok {
+		if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+			name = u.Username
+		}
+		n.users[uid] = name
+	}
+	group, ok := n.groups[gid]
+	if !ok {
+		if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+			group = g.Name
+		}
+		n.groups[gid] = group
+	}
+	return &FileOwner{UID: uid, GID: gid, User: name, Group: group}
+}
+
+// ownerMapper 按恢复选项把备份中的属主转换为本机的 uid/gid
+type ownerMapper struct {
+	opts   RestoreOptions
+	users  map[string]int
+	groups map[string]int
+}
+
+func newOwnerMapper(opts RestoreOptions) *ownerMapper {
+	return &ownerMapper{opts: opts, users: make(map[string]int), groups: make(map[string]int)}
+}
+
+// resolve 返回恢复时要设置的属主，nil 表示不修改
+func (m *ownerMapper) resolve(owner *FileOwner) *FileOwner {
+	if owner == nil {
+		return nil
+	}
+	resolved := *owner
+	switch m.opts.Ownership {
+	case OwnershipAsIs:
+	case OwnershipByName:
+		if uid, ok := m.lookupUser(owner.User); ok {
+			resolved.UID = uid
+		}
+		if gid, ok := m.lookupGroup(owner.Group); ok {
+			resolved.GID = gid
+		}
+	case OwnershipMap:
+		if uid, ok := m.opts.UIDMap[owner.UID]; ok {
+			resolved.UID = uid
+		}
+		if gid, ok := m.opts.GIDMap[owner.GID]; ok {
+			resolved.GID = gid
+		}
+	default:
+		return nil
+	}
+	return &resolved
+}
+
+func (m *ownerMapper) lookupUser(name string) (int, bool) {
+	if name == "" {
+		return 0, false
+	}
+	uid, ok := m.users[name]
+	if !ok {
+		uid = -1
+		if u, err := user.Lookup(name); err == nil {
+			if id, err := strconv.Atoi(u.Uid); err == nil {
+				uid = id
+			}
+		}
+		m.users[name] = uid
+	}
+	return uid, uid >= 0
+}
+
+func (m *ownerMapper) lookupGroup(name string) (int, bool) {
+	if name == "" {
+		return 0, false
+	}
+	gid, ok := m.groups[name]
+	if !ok {
+		gid = -1
+		if g, err := user.LookupGroup(name); err == nil {
+			if id, err := strconv.Atoi(g.Gid); err == nil {
+				gid = id
+			}
+		}
+		m.groups[name] = gid
+	}
+	return gid, gid >= 0
+}
+
+// restoreOwner 设置属主 (不跟随符号链接)，失败时只记录警告 (例如没有 root 权限)。
+// 需要在 Chmod 之前调用，因为修改属主会清除 setuid/setgid 位。
+func (m *BackupManager) restoreOwner(meta *FileMetadata, destPath string) {
+	if meta.Owner == nil {
+		return
+	}
+	if err := applyOwner(destPath, meta.Owner.UID, meta.Owner.GID); err != nil {
+		log.Printf("Warn: could not chown %s to %d:%d: %v", destPath, meta.Owner.UID, meta.Owner.GID, err)
+	}
+}
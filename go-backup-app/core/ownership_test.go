@@ -0,0 +1,80 @@
+//go:build !windows
+
+package core
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnerMapper_Resolve(t *testing.T) {
+	owner := &FileOwner{UID: 1000, GID: 1000, User: "no-such-user-qbak", Group: "no-such-group-qbak"}
+
+	require.Nil(t, newOwnerMapper(RestoreOptions{}).resolve(owner))
+	require.Nil(t, newOwnerMapper(RestoreOptions{Ownership: OwnershipAsIs}).resolve(nil))
+	require.Equal(t, owner, newOwnerMapper(RestoreOptions{Ownership: OwnershipAsIs}).resolve(owner))
+
+	mapped := newOwnerMapper(RestoreOptions{Ownership: OwnershipMap, UIDMap: map[int]int{1000: 2000}}).resolve(owner)
+	require.Equal(t, 2000, mapped.UID)
+	require.Equal(t, 1000, mapped.GID)
+
+	// 本机没有的名称保留原来的 id
+	byName := newOwnerMapper(RestoreOptions{Ownership: OwnershipByName}).resolve(owner)
+	require.Equal(t, 1000, byName.UID)
+
+	current, err := user.Current()
+	require.NoError(t, err)
+	uid, err := strconv.Atoi(current.Uid)
+	require.NoError(t, err)
+	byName = newOwnerMapper(RestoreOptions{Ownership: OwnershipByName}).resolve(&FileOwner{UID: 4321, GID: 4321, User: current.Username})
+	require.Equal(t, uid, byName.UID)
+	require.Equal(t, 4321, byName.GID)
+
+	opts := RestoreOptions{Ownership: "chown"}
+	require.Error(t, opts.Validate())
+}
+
+func TestBackupRestore_Ownership(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "dir"), 0755))
+	filePath := filepath.Join(srcDir, "dir", "owned.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("data"), 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	backupFile := filepath.Join(tempDir, "owned.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, FilterConfig{MaxSize: -1}, CodecHuffman, false, 0, ""))
+
+	root, err := manager.ListBackup(backupFile, "")
+	require.NoError(t, err)
+	node := findNode(root, "dir/owned.txt")
+	require.NotNil(t, node)
+	require.NotNil(t, node.Owner)
+	require.Equal(t, os.Getuid(), node.Owner.UID)
+	require.Equal(t, os.Getgid(), node.Owner.GID)
+
+	// 没有权限修改属主时只记录警告，恢复仍然成功
+	restoreDir := filepath.Join(tempDir, "restore")
+	opts := RestoreOptions{Ownership: OwnershipMap, UIDMap: map[int]int{os.Getuid(): 4242}, GIDMap: map[int]int{os.Getgid(): 4343}}
+	require.NoError(t, manager.RestoreWithOptions(backupFile, restoreDir, "", opts))
+
+	if os.Geteuid() != 0 {
+		t.Skip("chown requires root")
+	}
+	for _, p := range []string{"dir", "dir/owned.txt"} {
+		info, err := os.Lstat(filepath.Join(restoreDir, p))
+		require.NoError(t, err)
+		st := info.Sys().(*syscall.Stat_t)
+		require.Equal(t, uint32(4242), st.Uid, p)
+		require.Equal(t, uint32(4343), st.Gid, p)
+	}
+}
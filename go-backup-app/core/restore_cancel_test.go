@@ -25,7 +25,7 @@ func TestRestoreWrongPasswordFailsFast(t *testing.T) {
 		[]string{srcFile},
 		backupFile,
 		FilterConfig{MaxSize: -1},
-		true,
+		CodecHuffman,
 		true,
 		AlgoAES256_CTR,
 		correct,
@@ -60,7 +60,7 @@ func TestRestoreCancelStopsQuickly(t *testing.T) {
 		[]string{srcFile},
 		backupFile,
 		FilterConfig{MaxSize: -1},
-		true,
+		CodecHuffman,
 		true,
 		AlgoAES256_CTR,
 		password,
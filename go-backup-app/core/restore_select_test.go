@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchArchivePattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"src/config/**", "src/config", true},
+		{"src/config/**", "src/config/app.yaml", true},
+		{"src/config/**", "src/config/nested/db.yaml", true},
+		{"src/config/**", "src/configs/app.yaml", false},
+		{"src/config", "src/config/app.yaml", true},
+		{"src/*.go", "src/main.go", true},
+		{"src/*.go", "src/pkg/util.go", false},
+		{"src/**/*.go", "src/pkg/util.go", true},
+		{"src/**/*.go", "src/main.go", true},
+		{"**/testdata", "a/b/testdata/x.txt", true},
+		{"*.log", "logs/app.log", true},
+		{"*.log", "app.log.bak", false},
+		{"node_modules", "web/node_modules/react/index.js", true},
+		{"/README.md", "README.md", true},
+		{"/README.md", "docs/README.md", false},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.want, matchArchivePattern(c.pattern, c.path), "pattern %q path %q", c.pattern, c.path)
+	}
+
+	opts := RestoreOptions{Include: []string{"[bad"}}
+	require.Error(t, opts.Validate())
+}
+
+func TestRestoreWithOptions_SelectsEntries(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "src", "config"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "docs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "src", "config", "app.yaml"), []byte("app"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "src", "config", "debug.log"), []byte("log"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "src", "main.go"), []byte("main"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "docs", "README.md"), []byte("readme"), 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	backupFile := filepath.Join(tempDir, "out.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, FilterConfig{MaxSize: -1}, CodecHuffman, true, AlgoAES256_CTR, "pw"))
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	opts := RestoreOptions{
+		Include: []string{"src/config/**", "README.md"},
+		Exclude: []string{"*.log"},
+	}
+	require.NoError(t, manager.RestoreWithOptions(backupFile, restoreDir, "pw", opts))
+
+	got, err := os.ReadFile(filepath.Join(restoreDir, "src", "config", "app.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "app", string(got))
+	got, err = os.ReadFile(filepath.Join(restoreDir, "docs", "README.md"))
+	require.NoError(t, err)
+	require.Equal(t, "readme", string(got))
+
+	require.NoFileExists(t, filepath.Join(restoreDir, "src", "config", "debug.log"))
+	require.NoFileExists(t, filepath.Join(restoreDir, "src", "main.go"))
+}
+
+func TestRestoreWithOptions_IncrementalDeletionMarkers(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "keep.txt"), []byte("keep"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "gone.txt"), []byte("gone"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "other.txt"), []byte("other"), 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	filters := FilterConfig{MaxSize: -1}
+
+	baseFile := filepath.Join(tempDir, "base.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, baseFile, filters, CodecStore, false, 0, ""))
+
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "gone.txt")))
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "other.txt")))
+	incFile := filepath.Join(tempDir, "inc.qbak")
+	require.NoError(t, manager.BackupIncremental([]string{srcDir}, incFile, baseFile, filters, CodecStore, false, 0, ""))
+
+	// 恢复目录中已存在的文件: 只有被选中的删除标记才会生效
+	restoreDir := filepath.Join(tempDir, "restore")
+	require.NoError(t, os.MkdirAll(restoreDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(restoreDir, "other.txt"), []byte("local"), 0644))
+
+	require.NoError(t, manager.RestoreWithOptions(incFile, restoreDir, "", RestoreOptions{Exclude: []string{"other.txt"}}))
+
+	require.FileExists(t, filepath.Join(restoreDir, "keep.txt"))
+	require.NoFileExists(t, filepath.Join(restoreDir, "gone.txt"))
+	got, err := os.ReadFile(filepath.Join(restoreDir, "other.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "local", string(got))
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// restoreRoot 把归档中的路径映射到恢复目录中，并保证恢复时不会写到恢复目录之外:
+// 拒绝绝对路径和含有 ".." 的路径，也不允许经过符号链接的路径 (无论链接来自归档还是恢复目录中原有的文件)。
+// 确认过的目录会被缓存，因此不能在多个 goroutine 中同时使用。
+type restoreRoot struct {
+	dir     string
+	checked map[string]struct{} // 已确认是真实目录的相对路径
+}
+
+func newRestoreRoot(dir string) *restoreRoot {
+	return &restoreRoot{dir: dir, checked: make(map[string]struct{})}
+}
+
+// path 返回 relPath 在恢复目录中的位置。绝对路径和含有 ".." 的路径返回 ErrUnsafePath；
+// 上级目录是符号链接时返回 ErrSymlinkedPath，调用方跳过这个条目而不是让整个恢复失败
+func (r *restoreRoot) path(relPath string) (string, error) {
+	if !isLocalEntryPath(relPath) {
+		return "", fmt.Errorf("%w: %q", ErrUnsafePath, relPath)
+	}
+	rel := filepath.Clean(filepath.FromSlash(relPath))
+	if parent := filepath.Dir(rel); parent != "." {
+		if err := r.checkDir(parent); err != nil {
+			return "", fmt.Errorf("%w: %q passes through %v", ErrSymlinkedPath, relPath, err)
+		}
+	}
+	return filepath.Join(r.dir, rel), nil
+}
+
+// checkDir 检查 rel 及其上级目录都不是符号链接；还不存在的目录之后由 MkdirAll 创建
+func (r *restoreRoot) checkDir(rel string) error {
+	if _, ok := r.checked[rel]; ok {
+		return nil
+	}
+	if parent := filepath.Dir(rel); parent != "." {
+		if err := r.checkDir(parent); err != nil {
+			return err
+		}
+	}
+	info, err := os.Lstat(filepath.Join(r.dir, rel))
+	if err != nil {
+		return nil
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("symbolic link %s", filepath.ToSlash(rel))
+	}
+	if info.IsDir() {
+		r.checked[rel] = struct{}{}
+	}
+	return nil
+}
+
+// forget 丢弃 relPath 及其下所有路径的检查结果。路径被删除或被其他类型的条目替换之后调用，
+// 之后经过它的路径会重新检查
+func (r *restoreRoot) forget(relPath string) {
+	rel := filepath.Clean(filepath.FromSlash(relPath))
+	prefix := rel + string(filepath.Separator)
+	for p := range r.checked {
+		if p == rel || strings.HasPrefix(p, prefix) {
+			delete(r.checked, p)
+		}
+	}
+}
+
+// isLocalEntryPath 判断归档中的路径是否位于归档根之下。
+// 除了 filepath.IsLocal 的检查外，任何 ".." 元素 (包括以 \ 分隔的) 都会被拒绝，即使清理后仍在根之下。
+func isLocalEntryPath(relPath string) bool {
+	if relPath == "" || path.IsAbs(relPath) || strings.IndexByte(relPath, 0) >= 0 {
+		return false
+	}
+	for _, part := range strings.FieldsFunc(relPath, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return false
+		}
+	}
+	return filepath.IsLocal(filepath.FromSlash(relPath))
+}
+
+// symlinkEscapes 判断位于 relPath 的符号链接是否可能指向恢复目录之外。
+// 绝对路径总是视为在外部；相对路径只允许在开头出现 ".."，且不能超过链接所在目录的深度。
+// 出现在普通元素之后的 ".." 会作用于符号链接解析后的位置，无法只凭路径判断，因此也视为在外部。
+func symlinkEscapes(relPath, linkDest string) bool {
+	dest := filepath.ToSlash(linkDest)
+	if dest == "" || path.IsAbs(dest) || filepath.IsAbs(linkDest) || filepath.VolumeName(linkDest) != "" {
+		return true
+	}
+	depth := 0
+	if dir := path.Dir(path.Clean(relPath)); dir != "." {
+		depth = strings.Count(dir, "/") + 1
+	}
+	descended := false
+	for _, part := range strings.Split(dest, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if descended || depth == 0 {
+				return true
+			}
+			depth--
+		default:
+			descended = true
+		}
+	}
+	return false
+}
+
+// refuseSymlink 在 opts.RefuseEscapingSymlinks 时拒绝指向恢复目录之外的符号链接
+func (m *BackupManager) refuseSymlink(meta *FileMetadata, opts RestoreOptions) bool {
+	if !meta.IsLink || !opts.RefuseEscapingSymlinks || !symlinkEscapes(meta.Path, meta.LinkDest) {
+		return false
+	}
+	log.Printf("Warn: refused symlink %s -> %s pointing outside the restore directory", meta.Path, meta.LinkDest)
+	m.emitLog(fmt.Sprintf("已拒绝指向恢复目录之外的符号链接: %s -> %s", meta.Path, meta.LinkDest))
+	return true
+}
+
+// skipSymlinked 在 err 是 ErrSymlinkedPath 时记录警告并返回 true，调用方跳过这个条目
+func (m *BackupManager) skipSymlinked(err error) bool {
+	if !errors.Is(err, ErrSymlinkedPath) {
+		return false
+	}
+	log.Printf("Warn: skipped %v", err)
+	m.emitLog(fmt.Sprintf("已跳过经过符号链接的条目: %v", err))
+	return true
+}
+
+// removeSymlink 删除 destPath 处已有的符号链接 (例如备份链中较早的备份恢复的链接)，避免写入时跟随链接
+func removeSymlink(destPath string) error {
+	info, err := os.Lstat(destPath)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	if err := os.Remove(destPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to replace symlink %s: %w", destPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeCraftedArchive 按给定顺序写入条目，模拟恶意构造的归档
+func writeCraftedArchive(t *testing.T, entries []FileMetadata, contents map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	aw := NewArchiveWriter(&buf)
+	buffer := make([]byte, copyBufferSize)
+	for _, meta := range entries {
+		data := contents[meta.Path]
+		if meta.Mode.IsRegular() && meta.HardLink == "" {
+			meta.Size = int64(len(data))
+			meta.HasCRC = true
+		}
+		require.NoError(t, aw.WriteEntry(meta, bytes.NewReader([]byte(data)), buffer, nil))
+	}
+	require.NoError(t, aw.WriteIndex())
+	return buf.Bytes()
+}
+
+func TestRestore_RejectsUnsafePaths(t *testing.T) {
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	for _, evil := range []string{"../evil.txt", "/evil.txt", "a/../../evil.txt", "a/..", `..\evil.txt`} {
+		t.Run(evil, func(t *testing.T) {
+			tempDir := t.TempDir()
+			restoreDir := filepath.Join(tempDir, "restore", "inner")
+			archive := writeCraftedArchive(t, []FileMetadata{
+				{Path: "ok.txt", Mode: 0644},
+				{Path: evil, Mode: 0644},
+			}, map[string]string{"ok.txt": "fine", evil: "pwned"})
+
+			err := manager.RestoreFrom(bytes.NewReader(archive), restoreDir, "", RestoreOptions{})
+			require.ErrorIs(t, err, ErrUnsafePath)
+			require.NoFileExists(t, filepath.Join(tempDir, "restore", "evil.txt"))
+			require.NoFileExists(t, filepath.Join(tempDir, "evil.txt"))
+		})
+	}
+
+	// 删除标记和硬链接目标同样要检查
+	tempDir := t.TempDir()
+	victim := filepath.Join(tempDir, "victim.txt")
+	require.NoError(t, os.WriteFile(victim, []byte("keep"), 0644))
+	archive := writeCraftedArchive(t, []FileMetadata{{Path: "../victim.txt", Deleted: true}}, nil)
+	err := manager.RestoreFrom(bytes.NewReader(archive), filepath.Join(tempDir, "restore"), "", RestoreOptions{})
+	require.ErrorIs(t, err, ErrUnsafePath)
+	require.FileExists(t, victim)
+
+	archive = writeCraftedArchive(t, []FileMetadata{{Path: "copy.txt", Mode: 0644, HardLink: "../victim.txt"}}, nil)
+	err = manager.RestoreFrom(bytes.NewReader(archive), filepath.Join(tempDir, "restore"), "", RestoreOptions{})
+	require.ErrorIs(t, err, ErrUnsafePath)
+}
+
+func TestRestore_DoesNotFollowSymlinks(t *testing.T) {
+	tempDir := t.TempDir()
+	outside := filepath.Join(tempDir, "outside")
+	require.NoError(t, os.MkdirAll(outside, 0755))
+	restoreDir := filepath.Join(tempDir, "restore")
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	// 先创建指向外部的链接，再通过它写入文件
+	archive := writeCraftedArchive(t, []FileMetadata{
+		{Path: "link", IsLink: true, LinkDest: outside, Mode: os.ModeSymlink | 0777},
+		{Path: "link/pwned.txt", Mode: 0644},
+	}, map[string]string{"link/pwned.txt": "pwned"})
+	require.NoError(t, manager.RestoreFrom(bytes.NewReader(archive), restoreDir, "", RestoreOptions{}))
+	require.NoFileExists(t, filepath.Join(outside, "pwned.txt"))
+	data, err := os.ReadFile(filepath.Join(restoreDir, "link", "pwned.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "pwned", string(data))
+
+	// 经过另一个链接的链接被跳过，其余条目照常恢复
+	restoreDir = filepath.Join(tempDir, "restore2")
+	archive = writeCraftedArchive(t, []FileMetadata{
+		{Path: "a", IsLink: true, LinkDest: outside, Mode: os.ModeSymlink | 0777},
+		{Path: "a/b", IsLink: true, LinkDest: "/etc/passwd", Mode: os.ModeSymlink | 0777},
+	}, nil)
+	require.NoError(t, manager.RestoreFrom(bytes.NewReader(archive), restoreDir, "", RestoreOptions{}))
+	_, err = os.Lstat(filepath.Join(restoreDir, "a"))
+	require.NoError(t, err)
+	_, err = os.Lstat(filepath.Join(outside, "b"))
+	require.True(t, os.IsNotExist(err))
+
+	// 恢复目录中已有的链接 (例如增量备份链中较早的备份恢复的) 被替换而不是被跟随
+	restoreDir = filepath.Join(tempDir, "restore3")
+	require.NoError(t, os.MkdirAll(restoreDir, 0755))
+	target := filepath.Join(outside, "target.txt")
+	require.NoError(t, os.WriteFile(target, []byte("original"), 0644))
+	require.NoError(t, os.Symlink(target, filepath.Join(restoreDir, "file.txt")))
+	require.NoError(t, os.Symlink(outside, filepath.Join(restoreDir, "dir")))
+	archive = writeCraftedArchive(t, []FileMetadata{
+		{Path: "file.txt", Mode: 0644},
+		{Path: "dir", IsDir: true, Mode: os.ModeDir | 0700},
+		{Path: "dir/inner.txt", Mode: 0644},
+	}, map[string]string{"file.txt": "replaced", "dir/inner.txt": "inner"})
+	require.NoError(t, manager.RestoreFrom(bytes.NewReader(archive), restoreDir, "", RestoreOptions{}))
+	data, err = os.ReadFile(target)
+	require.NoError(t, err)
+	require.Equal(t, "original", string(data))
+	info, err := os.Lstat(filepath.Join(restoreDir, "file.txt"))
+	require.NoError(t, err)
+	require.True(t, info.Mode().IsRegular())
+	info, err = os.Stat(outside)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	require.NoFileExists(t, filepath.Join(outside, "inner.txt"))
+	require.FileExists(t, filepath.Join(restoreDir, "dir", "inner.txt"))
+}
+
+func TestRestore_RefuseEscapingSymlinks(t *testing.T) {
+	links := map[string]string{
+		"abs":        "/etc/passwd",
+		"up":         "../x",
+		"dir/ok":     "../file.txt",
+		"dir/down":   "sub/file.txt",
+		"dir/deep":   "../../x",
+		"dir/sneaky": "sub/../../../x",
+	}
+	var entries []FileMetadata
+	for p, dest := range links {
+		entries = append(entries, FileMetadata{Path: p, IsLink: true, LinkDest: dest, Mode: os.ModeSymlink | 0777})
+	}
+	archive := writeCraftedArchive(t, entries, nil)
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	tempDir := t.TempDir()
+
+	restoreDir := filepath.Join(tempDir, "strict")
+	require.NoError(t, manager.RestoreFrom(bytes.NewReader(archive), restoreDir, "", RestoreOptions{RefuseEscapingSymlinks: true}))
+	for p := range links {
+		_, err := os.Lstat(filepath.Join(restoreDir, p))
+		if p == "dir/ok" || p == "dir/down" {
+			require.NoError(t, err, p)
+		} else {
+			require.True(t, os.IsNotExist(err), p)
+		}
+	}
+
+	// 默认仍然原样恢复所有链接
+	restoreDir = filepath.Join(tempDir, "default")
+	require.NoError(t, manager.RestoreFrom(bytes.NewReader(archive), restoreDir, "", RestoreOptions{}))
+	for p, dest := range links {
+		got, err := os.Readlink(filepath.Join(restoreDir, p))
+		require.NoError(t, err, p)
+		require.Equal(t, dest, got)
+	}
+}
+
+func TestSalvageRestore_UnsafePaths(t *testing.T) {
+	tempDir := t.TempDir()
+	backupFile := filepath.Join(tempDir, "crafted.qbak")
+	archive := writeCraftedArchive(t, []FileMetadata{
+		{Path: "good.txt", Mode: 0644},
+		{Path: "../evil.txt", Mode: 0644},
+		{Path: "link", IsLink: true, LinkDest: tempDir, Mode: os.ModeSymlink | 0777},
+		{Path: "link/evil.txt", Mode: 0644},
+	}, map[string]string{"good.txt": "good", "../evil.txt": "evil", "link/evil.txt": "evil"})
+	require.NoError(t, os.WriteFile(backupFile, archive, 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	restoreDir := filepath.Join(tempDir, "restore")
+	report, err := manager.SalvageRestore(backupFile, restoreDir, "", RestoreOptions{})
+	require.NoError(t, err)
+	require.NoFileExists(t, filepath.Join(tempDir, "evil.txt"))
+	require.FileExists(t, filepath.Join(restoreDir, "good.txt"))
+
+	// "../evil.txt" 的头部在校验时就被当作损坏数据跳过；与 runRestore 相同，符号链接最后创建，
+	// "link/evil.txt" 恢复到恢复目录中的真实目录，链接本身因此无法创建
+	require.NoFileExists(t, filepath.Join(tempDir, "link", "evil.txt"))
+	require.FileExists(t, filepath.Join(restoreDir, "link", "evil.txt"))
+	require.Len(t, report.Lost, 2)
+	require.Equal(t, "link", report.Lost[1].Path)
+	require.Contains(t, report.Lost[1].Reason, "symbolic link")
+}
+
+func TestSalvageRestore_SymlinkReplacingDeletedDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+	outside := filepath.Join(tempDir, "outside")
+	require.NoError(t, os.MkdirAll(outside, 0755))
+	backupFile := filepath.Join(tempDir, "crafted.qbak")
+	archive := writeCraftedArchive(t, []FileMetadata{
+		{Path: "a", IsDir: true, Mode: os.ModeDir | 0755},
+		{Path: "a/x", Mode: 0644},
+		{Path: "a", IsDir: true, Mode: os.ModeDir | 0755, Deleted: true},
+		{Path: "a", IsLink: true, LinkDest: "../outside", Mode: os.ModeSymlink | 0777},
+		{Path: "a/pwned", Mode: 0644},
+	}, map[string]string{"a/x": "x", "a/pwned": "pwned"})
+	require.NoError(t, os.WriteFile(backupFile, archive, 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	restoreDir := filepath.Join(tempDir, "restore")
+	report, err := manager.SalvageRestore(backupFile, restoreDir, "", RestoreOptions{})
+	require.NoError(t, err)
+	require.NoFileExists(t, filepath.Join(outside, "pwned"))
+	data, err := os.ReadFile(filepath.Join(restoreDir, "a", "pwned"))
+	require.NoError(t, err)
+	require.Equal(t, "pwned", string(data))
+	require.NoFileExists(t, filepath.Join(restoreDir, "a", "x"))
+	require.Equal(t, []string{"a/pwned"}, report.Recovered)
+
+	// 正常恢复的结果相同
+	restoreDir = filepath.Join(tempDir, "restore2")
+	require.NoError(t, manager.RestoreWithOptions(backupFile, restoreDir, "", RestoreOptions{}))
+	require.NoFileExists(t, filepath.Join(outside, "pwned"))
+	require.FileExists(t, filepath.Join(restoreDir, "a", "pwned"))
+}
+
+func TestSymlinkEscapes(t *testing.T) {
+	for _, tc := range []struct {
+		path, dest string
+		escapes    bool
+	}{
+		{"a", "b", false},
+		{"a", "./b/c", false},
+		{"a", "..", true},
+		{"a", "/etc", true},
+		{"a", "", true},
+		{"x/y/a", "../../b", false},
+		{"x/y/a", "../../../b", true},
+		{"x/a", "b/../c", true},
+		{"x/a", "../x/../b", true},
+	} {
+		require.Equal(t, tc.escapes, symlinkEscapes(tc.path, tc.dest), "%s -> %s", tc.path, tc.dest)
+	}
+}
+
+func TestRestore_ChainReplacingSymlinkWithDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "real"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "real", "a.txt"), []byte("real"), 0644))
+	require.NoError(t, os.Symlink("real", filepath.Join(srcDir, "docs")))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	filters := FilterConfig{MaxSize: -1}
+
+	baseFile := filepath.Join(tempDir, "base.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, baseFile, filters, CodecHuffman, false, 0, ""))
+
+	// 符号链接被替换为真实目录
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "docs")))
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "docs", "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "docs", "sub", "b.txt"), []byte("docs"), 0644))
+	incFile := filepath.Join(tempDir, "inc.qbak")
+	require.NoError(t, manager.BackupIncremental([]string{srcDir}, incFile, baseFile, filters, CodecHuffman, false, 0, ""))
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	require.NoError(t, manager.Restore(incFile, restoreDir, ""))
+	info, err := os.Lstat(filepath.Join(restoreDir, "docs"))
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+	data, err := os.ReadFile(filepath.Join(restoreDir, "docs", "sub", "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "docs", string(data))
+	require.NoFileExists(t, filepath.Join(restoreDir, "real", "sub", "b.txt"))
+
+	// 恢复目录中保留着之前恢复基础备份时创建的符号链接，只恢复其下的条目时这些条目被跳过，
+	// 不经过链接写入，也不让整个恢复失败
+	restoreDir = filepath.Join(tempDir, "restore2")
+	require.NoError(t, manager.Restore(baseFile, restoreDir, ""))
+	require.NoError(t, manager.RestoreWithOptions(incFile, restoreDir, "", RestoreOptions{Include: []string{"docs/sub/**"}}))
+	require.NoFileExists(t, filepath.Join(restoreDir, "real", "sub", "b.txt"))
+	require.FileExists(t, filepath.Join(restoreDir, "real", "a.txt"))
+}
+
+func TestRestore_HardLinkToSymlinkSkipped(t *testing.T) {
+	tempDir := t.TempDir()
+	secret := filepath.Join(tempDir, "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("secret"), 0644))
+	restoreDir := filepath.Join(tempDir, "restore")
+	require.NoError(t, os.MkdirAll(restoreDir, 0755))
+	// 例如备份链中较早的备份恢复的、指向外部的链接
+	require.NoError(t, os.Symlink(secret, filepath.Join(restoreDir, "s")))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	archive := writeCraftedArchive(t, []FileMetadata{
+		{Path: "ok.txt", Mode: 0644},
+		{Path: "h", Mode: 0644, HardLink: "s"},
+	}, map[string]string{"ok.txt": "ok"})
+	require.NoError(t, manager.RestoreFrom(bytes.NewReader(archive), restoreDir, "", RestoreOptions{}))
+	_, err := os.Lstat(filepath.Join(restoreDir, "h"))
+	require.True(t, os.IsNotExist(err), "hard link to a symlink must not create another link")
+	require.FileExists(t, filepath.Join(restoreDir, "ok.txt"))
+}
@@ -0,0 +1,733 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 抢救恢复会尽量从截断或损坏的备份中恢复可读的条目:
+// 压缩层中无法解压的块被跳过，并从下一个能够解压的 "HCHK" 块继续；
+// 归档层中头部或数据损坏的条目被跳过，并向后查找下一个合理的条目头部。
+// 归档头部的路径前缀依赖上一个条目，重新同步后无法确定的前缀借助清单中的路径还原。
+
+// salvageRewindLen 是归档流中保留的已读数据长度。条目数据损坏时从该条目头部之后重新查找，
+// 因为丢失的压缩块可能使下一个条目的实际位置早于按条目大小计算的位置。
+const salvageRewindLen = 8 << 20
+
+// unknownPathPrefix 代替重新同步后未知的上一个条目路径，还原出的路径以 NUL 开头
+var unknownPathPrefix = strings.Repeat("\x00", 4096)
+
+// SalvageLoss 是抢救恢复中丢失的一个条目或一段无法识别的数据
+type SalvageLoss struct {
+	Backup string `json:"backup"`
+	Path   string `json:"path,omitempty"` // 为空表示无法确定属于哪个条目的数据
+	Offset int64  `json:"offset"`         // 在归档流中的位置，压缩数据的损坏为压缩流中的位置；-1 表示清单中有但没有读到
+	Reason string `json:"reason"`
+}
+
+// SalvageReport 是 SalvageRestore 的结果
+type SalvageReport struct {
+	Backups      []string      `json:"backups"`
+	Recovered    []string      `json:"recovered"`    // 恢复的条目，按路径排序
+	Lost         []SalvageLoss `json:"lost"`         // 损坏或缺失的条目，以及跳过的数据
+	SkippedBytes int64         `json:"skippedBytes"` // 重新同步时跳过的字节数
+}
+
+// SalvageRestore 以抢救模式恢复备份 (增量备份则恢复整条备份链)。
+// 损坏的条目被记录并跳过，读取在下一个合理的条目处继续，最后返回恢复和丢失的内容。
+// 只有密码错误、取消以及写入目标目录失败才返回 error。
+func (m *BackupManager) SalvageRestore(backupFile, restoreDir, password string, opts RestoreOptions) (*SalvageReport, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	m.emitProgressDetail("正在准备抢救恢复...", 0, 0, 0, 0, "salvaging")
+
+	st := &salvageState{
+		m:          m,
+		root:       newRestoreRoot(restoreDir),
+		opts:       opts,
+		owners:     newOwnerMapper(opts),
+		report:     &SalvageReport{Backups: []string{}, Recovered: []string{}, Lost: []SalvageLoss{}},
+		recovered:  make(map[string]struct{}, 1024),
+		lostPaths:  make(map[string]struct{}),
+		known:      make(map[string]struct{}, 1024),
+		knownByLen: make(map[int][]string),
+		buffer:     make([]byte, copyBufferSize),
+	}
+
+	chain, err := m.resolveRestoreChain(backupFile, password)
+	if err != nil {
+		if isPasswordError(err) || m.ctx.Err() != nil {
+			return nil, err
+		}
+		// 目标备份的清单损坏时无法找到父备份，只抢救目标备份本身
+		st.backup = backupFile
+		st.lose("", 0, "cannot resolve backup chain: %v", err)
+		chain = []string{backupFile}
+	}
+	st.report.Backups = chain
+
+	for i, file := range chain {
+		st.last = i == len(chain)-1
+		if err := st.salvageBackup(file, password); err != nil {
+			return nil, err
+		}
+	}
+	if err := st.finish(); err != nil {
+		return nil, err
+	}
+
+	m.emitProgressDetail("抢救恢复完成", len(st.report.Recovered), len(st.report.Recovered), 0, 0, "salvaging")
+	return st.report, nil
+}
+
+type salvageState struct {
+	m      *BackupManager
+	root   *restoreRoot // 归档中的符号链接在 finish 中最后创建，恢复其他条目时只会遇到恢复目录中原有的链接
+	opts   RestoreOptions
+	owners *ownerMapper
+	report *SalvageReport
+	buffer []byte
+
+	backup string // 当前处理的备份文件
+	last   bool   // 当前备份是否为备份链中的最后一个
+
+	recovered map[string]struct{}
+	lostPaths map[string]struct{}
+	links     []salvageLink
+	symlinks  []salvageLink
+
+	// 读到的所有清单中的路径，用于检验重新同步后找到的头部并还原路径前缀
+	known      map[string]struct{}
+	knownByLen map[int][]string
+	manifest   *BackupManifest // 最后一个备份的清单
+	total      int
+
+	lastEmit time.Time
+}
+
+type salvageLink struct {
+	pendingHardLink
+	backup string
+	offset int64
+}
+
+func (st *salvageState) lose(relPath string, offset int64, format string, args ...interface{}) {
+	reason := fmt.Sprintf(format, args...)
+	st.report.Lost = append(st.report.Lost, SalvageLoss{Backup: st.backup, Path: relPath, Offset: offset, Reason: reason})
+	if relPath != "" {
+		delete(st.recovered, relPath)
+		st.lostPaths[relPath] = struct{}{}
+	}
+	log.Printf("Warn: salvage %s at offset %d: %s %s", st.backup, offset, relPath, reason)
+	st.m.emitLog(fmt.Sprintf("已跳过损坏的数据: %s %s", relPath, reason))
+}
+
+func (st *salvageState) recover(relPath string) {
+	if relPath != "." {
+		st.recovered[relPath] = struct{}{}
+	}
+	if time.Since(st.lastEmit) >= 150*time.Millisecond {
+		st.lastEmit = time.Now()
+		st.m.emitProgressDetail(fmt.Sprintf("已恢复: %s", relPath), len(st.recovered), st.total, 0, 0, "salvaging")
+	}
+}
+
+// salvageBackup 抢救单个备份文件
+func (st *salvageState) salvageBackup(backupFile, password string) error {
+	m := st.m
+	st.backup = backupFile
+
+	src, err := openBackupSource(backupFile)
+	if err != nil {
+		st.lose("", 0, "cannot open backup: %v", err)
+		return nil
+	}
+	reader, err := m.newReaderPipeWith(src, src, password, func(c Codec, r io.Reader) (io.ReadCloser, error) {
+		sc, ok := c.(salvageCodec)
+		if !ok {
+			return c.NewReader(r)
+		}
+		return sc.newSalvageReader(r, func(offset, skipped int64, reason string) {
+			st.report.SkippedBytes += skipped
+			st.lose("", offset, "%s, %d bytes skipped", reason, skipped)
+		}), nil
+	})
+	if err != nil {
+		if isPasswordError(err) {
+			return err
+		}
+		st.lose("", 0, "cannot read backup: %v", err)
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-m.ctx.Done():
+			_ = reader.Close()
+		case <-done:
+		}
+	}()
+	defer close(done)
+	defer reader.Close()
+
+	s := newSalvageStream(reader, maxArchiveHeaderLen+binary.MaxVarintLen64, salvageRewindLen)
+	err = st.salvageEntries(NewArchiveReader(s), s)
+	if m.ctx.Err() != nil {
+		return m.ctx.Err()
+	}
+	return err
+}
+
+// salvageEntries 逐个恢复条目。头部无法读取时回到上一个问题出现的位置，向后查找下一个合理的头部。
+func (st *salvageState) salvageEntries(ar *ArchiveReader, s *salvageStream) error {
+	resyncFrom := int64(-1) // 上一个条目的数据损坏时，重新查找头部的起点
+	for {
+		if err := st.m.ctx.Err(); err != nil {
+			return err
+		}
+
+		start := s.pos()
+		version := ar.version
+		meta, err := ar.NextEntry()
+		if err == io.EOF {
+			return nil
+		}
+		if err == nil {
+			st.resolvePath(ar, meta)
+		} else if version == 0 {
+			// 流开头损坏时无法确定格式版本，重新同步时两种头部都要尝试
+			ar.version = 0
+		}
+		// 上一个条目损坏之后读到的头部可能只是数据中的巧合，需要更严格的检查
+		if err != nil || !st.plausible(meta, resyncFrom >= 0) {
+			from := start + 1
+			if resyncFrom >= 0 && s.rewind(resyncFrom) {
+				from = resyncFrom
+			}
+			if !s.rewind(from) {
+				return fmt.Errorf("salvage: cannot rewind to offset %d", from)
+			}
+			meta, start = st.resync(ar, s)
+			if meta == nil {
+				return nil
+			}
+		}
+		resyncFrom = -1
+
+		damaged, err := st.restoreEntry(ar, meta, start)
+		if err != nil {
+			return err
+		}
+		if damaged {
+			resyncFrom = start + 1
+		}
+	}
+}
+
+// resync 从当前位置向后查找下一个合理的条目头部并读取它，返回条目及其头部的位置；到达流末尾时返回 nil
+func (st *salvageState) resync(ar *ArchiveReader, s *salvageStream) (*FileMetadata, int64) {
+	from := s.pos()
+	report := func(to int64) {
+		if skipped := to - from; skipped > 0 {
+			st.report.SkippedBytes += skipped
+			st.lose("", from, "damaged archive data, %d bytes skipped", skipped)
+		}
+	}
+	for st.m.ctx.Err() == nil {
+		at := s.pos()
+		if meta, n := st.headerAt(ar, s); meta != nil {
+			report(at)
+			s.discard(n)
+			if !isInternalPath(meta.Path) {
+				ar.prevPath = meta.Path
+			}
+			return meta, at
+		}
+		if s.discard(1) == 0 {
+			break
+		}
+	}
+	report(s.pos())
+	return nil, 0
+}
+
+// headerAt 判断当前位置是否是一个合理的条目头部，返回解析结果和头部长度
+func (st *salvageState) headerAt(ar *ArchiveReader, s *salvageStream) (*FileMetadata, int) {
+	if ar.version != archiveVersion1 {
+		head := s.peek(binary.MaxVarintLen32 + 2)
+		n, k := binary.Uvarint(head)
+		// 标志位只使用低 12 位，头部第一个字节不会大于 0x0F
+		if k > 0 && n > 2 && n <= maxArchiveHeaderLen && len(head) > k && head[k] <= 0x0F {
+			buf := s.peek(k + int(n))
+			if len(buf) == k+int(n) {
+				if meta, err := decodeHeaderV2(buf[k:], unknownPathPrefix); err == nil {
+					st.resolvePath(nil, meta)
+					if st.plausible(meta, true) {
+						ar.version = archiveVersion2
+						return meta, len(buf)
+					}
+				}
+			}
+		}
+	}
+	if ar.version != archiveVersion2 {
+		head := s.peek(5)
+		if len(head) == 5 && head[4] == '{' {
+			n := int(binary.BigEndian.Uint32(head))
+			if n <= maxArchiveHeaderLen {
+				buf := s.peek(4 + n)
+				var meta FileMetadata
+				if len(buf) == 4+n && json.Unmarshal(buf[4:], &meta) == nil && st.plausible(&meta, true) {
+					ar.version = archiveVersion1
+					return &meta, len(buf)
+				}
+			}
+		}
+	}
+	return nil, 0
+}
+
+// resolvePath 还原以 NUL 开头 (路径前缀未知) 的路径: 清单中长度相同且后缀一致的路径只有一个时使用它。
+// ar 不为 nil 时同时更新下一个条目的前缀基准。
+func (st *salvageState) resolvePath(ar *ArchiveReader, meta *FileMetadata) {
+	unknown := strings.LastIndexByte(meta.Path, 0) + 1
+	if unknown == 0 {
+		return
+	}
+	tail := meta.Path[unknown:]
+	match := ""
+	for _, p := range st.knownByLen[len(meta.Path)] {
+		if strings.HasSuffix(p, tail) {
+			if match != "" {
+				return
+			}
+			match = p
+		}
+	}
+	if match == "" {
+		return
+	}
+	meta.Path = match
+	if ar != nil && !isInternalPath(match) {
+		ar.prevPath = match
+	}
+}
+
+// plausible 检查头部是否自洽；strict 时还要求路径出现在已读到的清单中
+func (st *salvageState) plausible(meta *FileMetadata, strict bool) bool {
+	if isInternalPath(meta.Path) {
+		return meta.Path == manifestEntryPath || meta.Path == archiveIndexPath
+	}
+	if len(checkEntryHeader(meta, nil)) > 0 {
+		return false
+	}
+	if meta.IsDir != meta.Mode.IsDir() || meta.IsLink != (meta.Mode&os.ModeSymlink != 0) {
+		return false
+	}
+	if meta.Sparse && meta.validateExtents() != nil {
+		return false
+	}
+	if strict && len(st.known) > 0 {
+		if _, ok := st.known[meta.Path]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (st *salvageState) addManifest(manifest *BackupManifest) {
+	for _, f := range manifest.Files {
+		if _, ok := st.known[f.Path]; !ok {
+			st.known[f.Path] = struct{}{}
+			st.knownByLen[len(f.Path)] = append(st.knownByLen[len(f.Path)], f.Path)
+		}
+	}
+	if st.last {
+		st.manifest = manifest
+		st.total = 0
+		for _, f := range manifest.Files {
+			if !f.IsDir && st.opts.ShouldRestore(f.Path) {
+				st.total++
+			}
+		}
+	}
+}
+
+// restoreEntry 恢复一个条目。damaged 表示条目的数据无法读取 (已记录)，之后的数据需要重新同步；
+// 返回的 error 只表示无法继续的错误，例如写入目标目录失败。
+func (st *salvageState) restoreEntry(ar *ArchiveReader, meta *FileMetadata, offset int64) (bool, error) {
+	m := st.m
+	skip := func() bool {
+		return ar.copyEntryData(meta, io.Discard, st.buffer) != nil
+	}
+
+	if isInternalPath(meta.Path) {
+		if meta.Path != manifestEntryPath {
+			return skip(), nil
+		}
+		var payload bytes.Buffer
+		if err := ar.copyEntryData(meta, &payload, st.buffer); err != nil {
+			st.lose(meta.Path, offset, "damaged manifest: %v", err)
+			return true, nil
+		}
+		manifest, err := UnmarshalManifest(payload.Bytes())
+		if err != nil || manifest == nil {
+			st.lose(meta.Path, offset, "invalid manifest: %v", err)
+			return false, nil
+		}
+		st.addManifest(manifest)
+		return false, nil
+	}
+
+	if strings.IndexByte(meta.Path, 0) >= 0 {
+		st.lose("", offset, "entry with unknown path (%d bytes of data)", meta.payloadSize())
+		return skip(), nil
+	}
+	if !st.opts.ShouldRestore(meta.Path) {
+		return skip(), nil
+	}
+	if st.opts.SkipXattrs {
+		meta.Xattrs = nil
+	}
+	meta.Owner = st.owners.resolve(meta.Owner)
+	destPath, err := st.root.path(meta.Path)
+	if err != nil {
+		st.lose(meta.Path, offset, "%v", err)
+		return skip(), nil
+	}
+
+	// 删除或替换之后，之前对这个路径的检查结果以及还没有创建的链接都不再有效
+	if meta.Deleted || !meta.IsDir {
+		st.root.forget(meta.Path)
+	}
+	st.dropPending(meta.Path, meta.Deleted)
+
+	switch {
+	case meta.Deleted:
+		if err := os.RemoveAll(destPath); err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("failed to remove %s: %w", destPath, err)
+		}
+		prefix := meta.Path + "/"
+		for p := range st.recovered {
+			if p == meta.Path || strings.HasPrefix(p, prefix) {
+				delete(st.recovered, p)
+			}
+		}
+		return skip(), nil
+	case meta.HardLink != "":
+		targetPath, err := st.root.path(meta.HardLink)
+		if err != nil {
+			st.lose(meta.Path, offset, "%v", err)
+			return false, nil
+		}
+		st.links = append(st.links, salvageLink{
+			pendingHardLink: pendingHardLink{meta: *meta, destPath: destPath, targetPath: targetPath},
+			backup:          st.backup,
+			offset:          offset,
+		})
+		return false, nil
+	case meta.IsLink:
+		if st.opts.RefuseEscapingSymlinks && symlinkEscapes(meta.Path, meta.LinkDest) {
+			st.lose(meta.Path, offset, "symlink to %s points outside the restore directory", meta.LinkDest)
+			return false, nil
+		}
+		// 与 runRestore 相同，符号链接在硬链接之后创建，之后写入的条目都不会经过归档中的链接
+		st.symlinks = append(st.symlinks, salvageLink{
+			pendingHardLink: pendingHardLink{meta: *meta},
+			backup:          st.backup,
+			offset:          offset,
+		})
+		return false, nil
+	case meta.IsDir:
+		if err := m.createDirOrLink(meta, destPath); err != nil {
+			return false, err
+		}
+	case meta.Mode.IsRegular():
+		return st.restoreFile(ar, meta, destPath, offset)
+	case meta.Mode&(os.ModeNamedPipe|os.ModeDevice) != 0:
+		if !st.opts.SpecialFiles {
+			return false, nil
+		}
+		if err := m.createSpecialFile(meta, destPath); err != nil {
+			return false, err
+		}
+	default:
+		return skip(), nil
+	}
+	st.recover(meta.Path)
+	return false, nil
+}
+
+// restoreFile 把文件数据写入临时文件，CRC 和内容哈希都通过之后才替换目标文件
+func (st *salvageState) restoreFile(ar *ArchiveReader, meta *FileMetadata, destPath string, offset int64) (bool, error) {
+	m := st.m
+	destPath, skip, err := m.resolveConflict(destPath)
+	if err != nil {
+		return false, err
+	}
+	if skip {
+		return ar.copyEntryData(meta, io.Discard, st.buffer) != nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return false, fmt.Errorf("failed to create parent dir for %s: %w", destPath, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(destPath), ".salvage-*")
+	if err != nil {
+		return false, fmt.Errorf("failed to create file in %s: %w", filepath.Dir(destPath), err)
+	}
+	tmpPath := tmp.Name()
+
+	w := &extentWriter{f: tmp, extents: meta.Extents}
+	if !meta.Sparse {
+		w.extents = []SparseExtent{{Offset: 0, Length: meta.Size}}
+	}
+	copyErr := ar.copyEntryData(meta, w, st.buffer)
+	if w.err == nil && copyErr == nil {
+		w.err = tmp.Truncate(meta.Size)
+	}
+	if closeErr := tmp.Close(); w.err == nil {
+		w.err = closeErr
+	}
+	if w.err != nil {
+		_ = os.Remove(tmpPath)
+		return false, fmt.Errorf("failed to write %s: %w", destPath, w.err)
+	}
+	if copyErr != nil {
+		_ = os.Remove(tmpPath)
+		st.lose(meta.Path, offset, "%v", copyErr)
+		return true, nil
+	}
+
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		// Windows 上 Rename 不会覆盖已存在的文件
+		_ = os.Remove(destPath)
+		if err := os.Rename(tmpPath, destPath); err != nil {
+			_ = os.Remove(tmpPath)
+			return false, fmt.Errorf("failed to move restored file to %s: %w", destPath, err)
+		}
+	}
+	m.restoreOwner(meta, destPath)
+	if err := os.Chmod(destPath, meta.Mode.Perm()); err != nil {
+		log.Printf("Warn: could not chmod %s: %v", destPath, err)
+	}
+	m.restoreXattrs(meta, destPath)
+	_ = os.Chtimes(destPath, meta.ModTime, meta.ModTime)
+	st.recover(meta.Path)
+	return false, nil
+}
+
+// extentWriter 把按顺序排列的数据段内容写到文件中对应的位置，空洞部分不写入；
+// 写入失败时记录在 err 中，以便与归档数据本身的错误区分
+type extentWriter struct {
+	f       *os.File
+	extents []SparseExtent
+	off     int64 // 当前数据段内已写入的长度
+	err     error
+}
+
+func (w *extentWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		for len(w.extents) > 0 && w.off >= w.extents[0].Length {
+			w.extents = w.extents[1:]
+			w.off = 0
+		}
+		if len(w.extents) == 0 {
+			return written, fmt.Errorf("sparse data exceeds recorded extents")
+		}
+		e := w.extents[0]
+		n := int64(len(p))
+		if remaining := e.Length - w.off; n > remaining {
+			n = remaining
+		}
+		k, err := w.f.WriteAt(p[:n], e.Offset+w.off)
+		written += k
+		w.off += int64(k)
+		if err != nil {
+			w.err = err
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// dropPending 丢弃 relPath 处 (subtree 为 true 时还包括其下所有路径) 还没有创建的硬链接和符号链接，
+// 它们已经被之后的条目删除或替换
+func (st *salvageState) dropPending(relPath string, subtree bool) {
+	prefix := relPath + "/"
+	keep := func(links []salvageLink) []salvageLink {
+		kept := links[:0]
+		for _, link := range links {
+			p := link.meta.Path
+			if p != relPath && (!subtree || !strings.HasPrefix(p, prefix)) {
+				kept = append(kept, link)
+			}
+		}
+		return kept
+	}
+	st.links = keep(st.links)
+	st.symlinks = keep(st.symlinks)
+}
+
+// finish 创建硬链接和符号链接，并把清单中记录但没有恢复的条目记为丢失
+func (st *salvageState) finish() error {
+	for _, link := range st.links {
+		st.backup = link.backup
+		if _, ok := st.recovered[link.meta.HardLink]; !ok {
+			st.lose(link.meta.Path, link.offset, "hard link target %s was not recovered", link.meta.HardLink)
+			continue
+		}
+		if err := st.m.restoreHardLink(&link.meta, link.destPath, link.targetPath); err != nil {
+			if errors.Is(err, ErrSymlinkedPath) {
+				st.lose(link.meta.Path, link.offset, "%v", err)
+				continue
+			}
+			return err
+		}
+		st.recover(link.meta.Path)
+	}
+
+	// 前面创建的符号链接可能成为后面链接的上级目录，因此重新检查路径
+	st.root = newRestoreRoot(st.root.dir)
+	for _, link := range st.symlinks {
+		st.backup = link.backup
+		destPath, err := st.root.path(link.meta.Path)
+		if err != nil {
+			st.lose(link.meta.Path, link.offset, "%v", err)
+			continue
+		}
+		if err := st.m.createDirOrLink(&link.meta, destPath); err != nil {
+			return err
+		}
+		// 归档中经过这个路径的条目已经在这里创建了目录或文件
+		if info, err := os.Lstat(destPath); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			st.lose(link.meta.Path, link.offset, "could not create symbolic link to %s: the path is already in use", link.meta.LinkDest)
+			continue
+		}
+		st.recover(link.meta.Path)
+	}
+
+	if st.manifest != nil {
+		st.backup = st.report.Backups[len(st.report.Backups)-1]
+		for _, f := range st.manifest.Files {
+			if f.IsDir || !st.opts.ShouldRestore(f.Path) {
+				continue
+			}
+			if f.Mode&(os.ModeNamedPipe|os.ModeDevice) != 0 && !st.opts.SpecialFiles {
+				continue
+			}
+			_, recovered := st.recovered[f.Path]
+			_, lost := st.lostPaths[f.Path]
+			if !recovered && !lost {
+				st.lose(f.Path, -1, "not found in the readable part of the backup")
+			}
+		}
+	}
+
+	for p := range st.recovered {
+		st.report.Recovered = append(st.report.Recovered, p)
+	}
+	sort.Strings(st.report.Recovered)
+	return nil
+}
+
+// salvageStream 是可以预读和回退的缓冲读取器: 预读最多 window 字节用于识别头部，
+// 并保留最近读过的 keep 字节，以便回到损坏条目的开头重新查找
+type salvageStream struct {
+	r          io.Reader
+	buf        []byte
+	base       int64 // buf[0] 在流中的位置
+	start, end int   // buf[start:end] 是尚未读取的数据
+	keep       int
+	err        error
+}
+
+func newSalvageStream(r io.Reader, window, keep int) *salvageStream {
+	return &salvageStream{r: r, buf: make([]byte, 2*(window+keep)), keep: keep}
+}
+
+func (s *salvageStream) pos() int64 { return s.base + int64(s.start) }
+
+func (s *salvageStream) fill(n int) {
+	for s.end-s.start < n && s.err == nil {
+		if s.end == len(s.buf) {
+			if drop := s.start - s.keep; drop > 0 {
+				s.end = copy(s.buf, s.buf[drop:s.end])
+				s.start -= drop
+				s.base += int64(drop)
+			} else {
+				s.buf = append(s.buf, make([]byte, len(s.buf))...)
+			}
+		}
+		k, err := s.r.Read(s.buf[s.end:])
+		s.end += k
+		if err != nil {
+			s.err = err
+		}
+	}
+}
+
+// peek 返回接下来的 n 个字节，只有在流结束时才会少于 n 个
+func (s *salvageStream) peek(n int) []byte {
+	s.fill(n)
+	if s.end-s.start < n {
+		n = s.end - s.start
+	}
+	return s.buf[s.start : s.start+n]
+}
+
+// discard 跳过 n 个字节，返回实际跳过的字节数
+func (s *salvageStream) discard(n int) int {
+	skipped := 0
+	for skipped < n {
+		if s.start == s.end {
+			s.fill(1)
+			if s.start == s.end {
+				break
+			}
+		}
+		k := s.end - s.start
+		if k > n-skipped {
+			k = n - skipped
+		}
+		s.start += k
+		skipped += k
+	}
+	return skipped
+}
+
+func (s *salvageStream) Read(p []byte) (int, error) {
+	if s.start == s.end {
+		s.fill(1)
+		if s.start == s.end {
+			if errors.Is(s.err, io.EOF) || s.err == nil {
+				return 0, io.EOF
+			}
+			return 0, s.err
+		}
+	}
+	n := copy(p, s.buf[s.start:s.end])
+	s.start += n
+	return n, nil
+}
+
+// rewind 回到之前读过的位置 pos，该位置的数据已经不在缓冲区中时返回 false
+func (s *salvageStream) rewind(pos int64) bool {
+	if pos < s.base || pos > s.base+int64(s.end) {
+		return false
+	}
+	s.start = int(pos - s.base)
+	return true
+}
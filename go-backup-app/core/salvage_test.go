@@ -0,0 +1,201 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var salvageNames = []string{"alpha.txt", "bravo.txt", "charlie.txt", "delta.txt", "echo.txt", "foxtrot.txt"}
+
+// writeSalvageSource 创建若干内容互不相同的文件，返回每个文件的内容
+func writeSalvageSource(t *testing.T, srcDir string, size int) map[string][]byte {
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+	contents := make(map[string][]byte, len(salvageNames))
+	for _, name := range salvageNames {
+		var buf bytes.Buffer
+		for i := 0; buf.Len() < size; i++ {
+			fmt.Fprintf(&buf, "%s line %d\n", name, i)
+		}
+		contents[name] = buf.Bytes()[:size]
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, name), contents[name], 0644))
+	}
+	return contents
+}
+
+// checkSalvage 检查恢复的文件内容正确，丢失的文件没有留在目标目录中，并返回丢失的文件
+func checkSalvage(t *testing.T, report *SalvageReport, restoreDir string, contents map[string][]byte) []string {
+	for _, name := range report.Recovered {
+		data, err := os.ReadFile(filepath.Join(restoreDir, name))
+		require.NoError(t, err)
+		require.Equal(t, contents[name], data, name)
+	}
+
+	lost := make(map[string]struct{})
+	for _, loss := range report.Lost {
+		if loss.Path != "" {
+			lost[loss.Path] = struct{}{}
+		}
+	}
+	var lostNames []string
+	for name := range lost {
+		require.NotContains(t, report.Recovered, name)
+		_, err := os.Stat(filepath.Join(restoreDir, name))
+		require.True(t, os.IsNotExist(err), name)
+		lostNames = append(lostNames, name)
+	}
+	sort.Strings(lostNames)
+
+	for _, name := range salvageNames {
+		_, isLost := lost[name]
+		require.True(t, isLost || containsString(report.Recovered, name), "%s is neither recovered nor reported lost", name)
+	}
+
+	leftovers, err := filepath.Glob(filepath.Join(restoreDir, ".salvage-*"))
+	require.NoError(t, err)
+	require.Empty(t, leftovers)
+	return lostNames
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSalvageRestore_DamagedArchive(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	contents := writeSalvageSource(t, srcDir, 4096)
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	backupFile := filepath.Join(tempDir, "plain.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, FilterConfig{MaxSize: -1}, CodecStore, false, 0, ""))
+	original, err := os.ReadFile(backupFile)
+	require.NoError(t, err)
+
+	salvage := func(t *testing.T, raw []byte) (*SalvageReport, string) {
+		damaged := filepath.Join(t.TempDir(), "damaged.qbak")
+		require.NoError(t, os.WriteFile(damaged, raw, 0644))
+		restoreDir := filepath.Join(t.TempDir(), "restore")
+		report, err := manager.SalvageRestore(damaged, restoreDir, "", RestoreOptions{})
+		require.NoError(t, err)
+		return report, restoreDir
+	}
+
+	t.Run("intact", func(t *testing.T) {
+		report, restoreDir := salvage(t, original)
+		require.Empty(t, report.Lost)
+		require.Zero(t, report.SkippedBytes)
+		require.Empty(t, checkSalvage(t, report, restoreDir, contents))
+	})
+
+	t.Run("damaged header", func(t *testing.T) {
+		raw := bytes.Clone(original)
+		// 条目头部中路径 (长度 + 字节) 之后是 mode，改成目录位与标志位不符的值
+		name := append([]byte{byte(len("charlie.txt"))}, "charlie.txt"...)
+		pos := bytes.Index(raw, name)
+		require.Greater(t, pos, 0)
+		pos += len(name)
+		copy(raw[pos:], []byte{0xFF, 0xFF, 0xFF, 0xFF})
+
+		report, restoreDir := salvage(t, raw)
+		require.Equal(t, []string{"charlie.txt"}, checkSalvage(t, report, restoreDir, contents))
+		require.Contains(t, report.Recovered, "delta.txt")
+		require.Contains(t, report.Recovered, "foxtrot.txt")
+		require.Greater(t, report.SkippedBytes, int64(4096))
+	})
+
+	t.Run("damaged data", func(t *testing.T) {
+		raw := bytes.Clone(original)
+		pos := bytes.Index(raw, contents["bravo.txt"])
+		require.Greater(t, pos, 0)
+		raw[pos+100] ^= 0xFF
+
+		report, restoreDir := salvage(t, raw)
+		require.Equal(t, []string{"bravo.txt"}, checkSalvage(t, report, restoreDir, contents))
+		require.Len(t, report.Recovered, len(salvageNames)-1)
+		require.Zero(t, report.SkippedBytes)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		pos := bytes.Index(original, contents["echo.txt"])
+		require.Greater(t, pos, 0)
+
+		report, restoreDir := salvage(t, original[:pos+1000])
+		require.Equal(t, []string{"echo.txt", "foxtrot.txt"}, checkSalvage(t, report, restoreDir, contents))
+		require.Len(t, report.Recovered, 4)
+		for _, loss := range report.Lost {
+			if loss.Path == "foxtrot.txt" {
+				require.Equal(t, int64(-1), loss.Offset)
+			}
+		}
+	})
+}
+
+func TestSalvageRestore_DamagedCompressedChunk(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	contents := writeSalvageSource(t, srcDir, 200*1024)
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	backupFile := filepath.Join(tempDir, "compressed.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, FilterConfig{MaxSize: -1}, CodecHuffman, false, 0, ""))
+
+	raw, err := os.ReadFile(backupFile)
+	require.NoError(t, err)
+	// 把第三个块的原始长度改成非法值，使整个块无法解压
+	pos := 0
+	for i := 0; i < 3; i++ {
+		next := bytes.Index(raw[pos:], chunkMagic)
+		require.GreaterOrEqual(t, next, 0)
+		pos += next + len(chunkMagic)
+	}
+	copy(raw[pos+4:], bytes.Repeat([]byte{0xFF}, 8))
+	require.NoError(t, os.WriteFile(backupFile, raw, 0644))
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	report, err := manager.SalvageRestore(backupFile, restoreDir, "", RestoreOptions{})
+	require.NoError(t, err)
+	lost := checkSalvage(t, report, restoreDir, contents)
+	require.NotEmpty(t, lost)
+	require.Contains(t, report.Recovered, "alpha.txt")
+	require.Contains(t, report.Recovered, "foxtrot.txt", "reading resumes at the next chunk")
+	require.Greater(t, report.SkippedBytes, int64(0))
+}
+
+func TestSalvageRestore_TruncatedEncrypted(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	contents := writeSalvageSource(t, srcDir, 100*1024)
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	backupFile := filepath.Join(tempDir, "encrypted.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, FilterConfig{MaxSize: -1}, CodecHuffman, true, AlgoAES256_CTR, "pw"))
+
+	raw, err := os.ReadFile(backupFile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(backupFile, raw[:len(raw)*6/10], 0644))
+
+	_, err = manager.SalvageRestore(backupFile, filepath.Join(tempDir, "wrong"), "wrong", RestoreOptions{})
+	require.ErrorIs(t, err, ErrInvalidPassword)
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	report, err := manager.SalvageRestore(backupFile, restoreDir, "pw", RestoreOptions{})
+	require.NoError(t, err)
+	lost := checkSalvage(t, report, restoreDir, contents)
+	require.Contains(t, report.Recovered, "alpha.txt")
+	require.Contains(t, lost, "foxtrot.txt")
+}
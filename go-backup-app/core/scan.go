@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 )
@@ -12,6 +13,18 @@ type archiveJob struct {
 	path    string
 	baseDir string
 	relPath string // slash-normalized path used in archive
+	xattrs  map[string][]byte
+	owner   *FileOwner
+
+	devMajor, devMinor uint32
+
+	hardLink string // 非空时为硬链接，指向同一 inode 第一次出现的归档路径
+}
+
+// inodeKey 唯一标识一个 inode，用于检测硬链接
+type inodeKey struct {
+	dev uint64
+	ino uint64
 }
 
 type scanResult struct {
@@ -22,6 +35,22 @@ type scanResult struct {
 	selectedBytes     int64
 }
 
+// linksLast 将硬链接条目排在最后，保证归档中数据总是先于指向它的链接出现
+func linksLast(jobs []archiveJob) []archiveJob {
+	ordered := make([]archiveJob, 0, len(jobs))
+	for _, job := range jobs {
+		if job.hardLink == "" {
+			ordered = append(ordered, job)
+		}
+	}
+	for _, job := range jobs {
+		if job.hardLink != "" {
+			ordered = append(ordered, job)
+		}
+	}
+	return ordered
+}
+
 func (m *BackupManager) scanSources(srcPaths []string, filters FilterConfig) (scanResult, error) {
 	if len(srcPaths) == 0 {
 		return scanResult{}, ErrNoFilesSelected
@@ -33,6 +62,9 @@ func (m *BackupManager) scanSources(srcPaths []string, filters FilterConfig) (sc
 		files:        make([]ManifestFile, 0, 1024),
 	}
 
+	inodes := make(map[inodeKey]string)
+	names := newOwnerNames()
+
 	addEntry := func(path string, baseDir string, info os.FileInfo) error {
 		rel, err := filepath.Rel(baseDir, path)
 		if err != nil {
@@ -40,20 +72,44 @@ func (m *BackupManager) scanSources(srcPaths []string, filters FilterConfig) (sc
 		}
 		rel = filepath.ToSlash(rel)
 
-		res.jobs = append(res.jobs, archiveJob{
-			path:    path,
-			baseDir: baseDir,
-			relPath: rel,
-		})
-		res.jobsByRelPath[rel] = archiveJob{
+		// 套接字只在创建它的进程运行时有意义，无法备份
+		if info.Mode()&os.ModeSocket != 0 {
+			log.Printf("Skipped socket %s", path)
+			m.emitLog(fmt.Sprintf("已跳过套接字: %s", path))
+			return nil
+		}
+
+		xattrs, err := readXattrs(path)
+		if err != nil {
+			log.Printf("Warn: %v", err)
+		}
+
+		job := archiveJob{
 			path:    path,
 			baseDir: baseDir,
 			relPath: rel,
+			xattrs:  xattrs,
+		}
+		if uid, gid, ok := fileOwnerIDs(info); ok {
+			job.owner = names.owner(uid, gid)
+		}
+		if info.Mode()&os.ModeDevice != 0 {
+			job.devMajor, job.devMinor = deviceNumbers(info)
+		}
+		// 同一个 inode 只保存第一次出现的路径的数据，之后的路径记录为硬链接
+		if key, ok := hardLinkKey(info); ok && rel != "." {
+			if first, seen := inodes[key]; seen {
+				job.hardLink = first
+			} else {
+				inodes[key] = rel
+			}
 		}
+		res.jobs = append(res.jobs, job)
+		res.jobsByRelPath[rel] = job
 
 		if !info.IsDir() {
 			res.selectedFileCount++
-			if info.Mode().IsRegular() {
+			if info.Mode().IsRegular() && job.hardLink == "" {
 				res.selectedBytes += info.Size()
 			}
 		}
@@ -64,11 +120,16 @@ func (m *BackupManager) scanSources(srcPaths []string, filters FilterConfig) (sc
 		}
 
 		file := ManifestFile{
-			Path:    rel,
-			Mode:    info.Mode(),
-			ModTime: info.ModTime(),
-			IsDir:   info.IsDir(),
-			IsLink:  info.Mode()&os.ModeSymlink != 0,
+			Path:     rel,
+			Mode:     info.Mode(),
+			ModTime:  info.ModTime(),
+			IsDir:    info.IsDir(),
+			IsLink:   info.Mode()&os.ModeSymlink != 0,
+			Xattrs:   xattrs,
+			HardLink: job.hardLink,
+			Owner:    job.owner,
+			DevMajor: job.devMajor,
+			DevMinor: job.devMinor,
 		}
 		if info.Mode().IsRegular() {
 			file.Size = info.Size()
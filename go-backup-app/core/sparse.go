@@ -0,0 +1,111 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+var zeroBlock [copyBufferSize]byte
+
+// openEntryData 返回普通文件在归档中的数据流。
+// 文件含有空洞时只读取数据段，并在 meta 中记录这些数据段。
+func openEntryData(file *os.File, meta *FileMetadata) io.Reader {
+	if meta.Size > 0 {
+		extents, err := sparseExtents(file, meta.Size)
+		if err != nil {
+			log.Printf("Warn: could not detect holes in %s: %v", file.Name(), err)
+		} else if extents != nil {
+			meta.Sparse = true
+			meta.Extents = extents
+			readers := make([]io.Reader, 0, len(extents))
+			for _, e := range extents {
+				readers = append(readers, io.NewSectionReader(file, e.Offset, e.Length))
+			}
+			return bufio.NewReaderSize(io.MultiReader(readers...), copyBufferSize)
+		}
+	}
+	return bufio.NewReaderSize(file, copyBufferSize)
+}
+
+// writeSparse 按数据段写入稀疏文件，空洞部分只移动写入位置，最后截断到文件的逻辑大小
+func writeSparse(f *os.File, r io.Reader, meta *FileMetadata, buffer []byte) error {
+	for _, e := range meta.Extents {
+		if _, err := f.Seek(e.Offset, io.SeekStart); err != nil {
+			return err
+		}
+		n, err := io.CopyBuffer(f, io.LimitReader(r, e.Length), buffer)
+		if err != nil {
+			return err
+		}
+		if n != e.Length {
+			return fmt.Errorf("sparse extent at %d is truncated: expected %d, got %d", e.Offset, e.Length, n)
+		}
+	}
+	return f.Truncate(meta.Size)
+}
+
+// copyEntryContent 与 copyEntryData 相同，但会把稀疏文件的空洞展开为零，写入 w 的是文件的完整内容
+func (ar *ArchiveReader) copyEntryContent(meta *FileMetadata, w io.Writer, buffer []byte) error {
+	if !meta.Sparse {
+		return ar.copyEntryData(meta, w, buffer)
+	}
+	sw := &sparseExpander{w: w, extents: meta.Extents}
+	if err := ar.copyEntryData(meta, sw, buffer); err != nil {
+		return err
+	}
+	return sw.fillTo(meta.Size)
+}
+
+// sparseExpander 接收按顺序排列的数据段内容，在数据段之间补齐空洞对应的零
+type sparseExpander struct {
+	w       io.Writer
+	extents []SparseExtent
+	pos     int64
+}
+
+func (s *sparseExpander) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		for len(s.extents) > 0 && s.pos >= s.extents[0].Offset+s.extents[0].Length {
+			s.extents = s.extents[1:]
+		}
+		if len(s.extents) == 0 {
+			return written, fmt.Errorf("sparse data exceeds recorded extents")
+		}
+		e := s.extents[0]
+		if err := s.fillTo(e.Offset); err != nil {
+			return written, err
+		}
+		n := int64(len(p))
+		if remaining := e.Offset + e.Length - s.pos; n > remaining {
+			n = remaining
+		}
+		m, err := s.w.Write(p[:n])
+		s.pos += int64(m)
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// fillTo 写入零直到逻辑位置 offset
+func (s *sparseExpander) fillTo(offset int64) error {
+	for s.pos < offset {
+		n := int64(len(zeroBlock))
+		if n > offset-s.pos {
+			n = offset - s.pos
+		}
+		m, err := s.w.Write(zeroBlock[:n])
+		s.pos += int64(m)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
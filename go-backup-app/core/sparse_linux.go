@@ -0,0 +1,65 @@
+//go:build linux
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// sparseExtents 使用 SEEK_DATA/SEEK_HOLE 找出文件中的数据段。
+// 文件没有空洞或文件系统不支持时返回 nil；返回前会把读取位置重置到文件开头。
+func sparseExtents(f *os.File, size int64) ([]SparseExtent, error) {
+	fd := int(f.Fd())
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", f.Name(), err)
+	}
+	// 分配的块足以覆盖整个文件时不可能存在空洞
+	if st.Blocks*512 >= size {
+		return nil, nil
+	}
+
+	var extents []SparseExtent
+	var dataBytes int64
+	for offset := int64(0); offset < size; {
+		dataStart, err := unix.Seek(fd, offset, unix.SEEK_DATA)
+		if err != nil {
+			if errors.Is(err, unix.ENXIO) {
+				break // 之后全部是空洞
+			}
+			if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EOPNOTSUPP) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to seek data in %s: %w", f.Name(), err)
+		}
+		if dataStart >= size {
+			break
+		}
+		holeStart, err := unix.Seek(fd, dataStart, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, fmt.Errorf("failed to seek hole in %s: %w", f.Name(), err)
+		}
+		if holeStart > size {
+			holeStart = size
+		}
+		extents = append(extents, SparseExtent{Offset: dataStart, Length: holeStart - dataStart})
+		dataBytes += holeStart - dataStart
+		offset = holeStart
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind %s: %w", f.Name(), err)
+	}
+	if dataBytes == size {
+		return nil, nil
+	}
+	if extents == nil {
+		extents = []SparseExtent{}
+	}
+	return extents, nil
+}
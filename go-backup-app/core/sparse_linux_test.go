@@ -0,0 +1,66 @@
+//go:build linux
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupRestore_SparseFile(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+
+	const logicalSize = 64 << 20
+	chunk := bytes.Repeat([]byte("sparse!"), 1000)
+	srcPath := filepath.Join(srcDir, "disk.img")
+	f, err := os.Create(srcPath)
+	require.NoError(t, err)
+	_, err = f.WriteAt(chunk, 1<<20)
+	require.NoError(t, err)
+	_, err = f.WriteAt(chunk, 40<<20)
+	require.NoError(t, err)
+	require.NoError(t, f.Truncate(logicalSize))
+	extents, err := sparseExtents(f, logicalSize)
+	require.NoError(t, f.Close())
+	require.NoError(t, err)
+	if extents == nil {
+		t.Skip("filesystem does not report holes")
+	}
+
+	expected := make([]byte, logicalSize)
+	copy(expected[1<<20:], chunk)
+	copy(expected[40<<20:], chunk)
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	backupFile := filepath.Join(tempDir, "sparse.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, FilterConfig{MaxSize: -1}, CodecStore, false, 0, ""))
+	info, err := os.Stat(backupFile)
+	require.NoError(t, err)
+	require.Less(t, info.Size(), int64(1<<20), "holes should not be stored in the archive")
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	require.NoError(t, manager.Restore(backupFile, restoreDir, ""))
+	restored := filepath.Join(restoreDir, "disk.img")
+	got, err := os.ReadFile(restored)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(expected, got))
+
+	info, err = os.Stat(restored)
+	require.NoError(t, err)
+	st := info.Sys().(*syscall.Stat_t)
+	require.Less(t, st.Blocks*512, int64(logicalSize/2), "restored file should keep its holes")
+
+	var buf bytes.Buffer
+	require.NoError(t, manager.ExtractFile(backupFile, "disk.img", "", &buf))
+	require.True(t, bytes.Equal(expected, buf.Bytes()))
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package core
+
+import "os"
+
+// 非 Linux 平台不检测空洞，稀疏文件按普通文件归档
+
+func sparseExtents(f *os.File, size int64) ([]SparseExtent, error) {
+	return nil, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func mknod(path string, mode os.FileMode, major, minor uint32) error {
+	return fmt.Errorf("special files are not supported on %s", runtime.GOOS)
+}
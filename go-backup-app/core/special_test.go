@@ -0,0 +1,80 @@
+//go:build linux || darwin
+
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestBackupRestore_SpecialFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+	require.NoError(t, unix.Mkfifo(filepath.Join(srcDir, "pipe"), 0640))
+
+	ln, err := net.Listen("unix", filepath.Join(srcDir, "app.sock"))
+	require.NoError(t, err)
+	defer ln.Close()
+
+	hasDevice := unix.Mknod(filepath.Join(srcDir, "null"), unix.S_IFCHR|0666, int(unix.Mkdev(1, 3))) == nil
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	backupFile := filepath.Join(tempDir, "special.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, FilterConfig{MaxSize: -1}, CodecHuffman, false, 0, ""))
+
+	root, err := manager.ListBackup(backupFile, "")
+	require.NoError(t, err)
+	require.Nil(t, findNode(root, "app.sock"), "sockets are skipped")
+	require.NotNil(t, findNode(root, "pipe"))
+
+	// 默认不重建特殊文件
+	plainDir := filepath.Join(tempDir, "plain")
+	require.NoError(t, manager.Restore(backupFile, plainDir, ""))
+	require.NoFileExists(t, filepath.Join(plainDir, "pipe"))
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	require.NoError(t, manager.RestoreWithOptions(backupFile, restoreDir, "", RestoreOptions{SpecialFiles: true}))
+	info, err := os.Lstat(filepath.Join(restoreDir, "pipe"))
+	require.NoError(t, err)
+	require.NotZero(t, info.Mode()&os.ModeNamedPipe)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	if hasDevice {
+		info, err := os.Lstat(filepath.Join(restoreDir, "null"))
+		require.NoError(t, err)
+		require.NotZero(t, info.Mode()&os.ModeCharDevice)
+		rdev := uint64(info.Sys().(*syscall.Stat_t).Rdev)
+		require.Equal(t, uint32(1), unix.Major(rdev))
+		require.Equal(t, uint32(3), unix.Minor(rdev))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, manager.ExportTar(backupFile, "", &buf))
+	types := map[string]byte{}
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		types[hdr.Name] = hdr.Typeflag
+	}
+	require.Equal(t, byte(tar.TypeFifo), types["pipe"])
+	if hasDevice {
+		require.Equal(t, byte(tar.TypeChar), types["null"])
+	}
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin
+
+package core
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mknod 按 mode 中的类型创建 FIFO、字符设备或块设备
+func mknod(path string, mode os.FileMode, major, minor uint32) error {
+	perm := uint32(mode.Perm())
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return unix.Mkfifo(path, perm)
+	case mode&os.ModeCharDevice != 0:
+		return unix.Mknod(path, unix.S_IFCHR|perm, int(unix.Mkdev(major, minor)))
+	default:
+		return unix.Mknod(path, unix.S_IFBLK|perm, int(unix.Mkdev(major, minor)))
+	}
+}
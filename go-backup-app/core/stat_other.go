@@ -0,0 +1,23 @@
+//go:build windows
+
+package core
+
+import "os"
+
+// hardLinkKey 在 Windows 上 Lstat 不提供文件索引号，暂不检测硬链接
+func hardLinkKey(info os.FileInfo) (inodeKey, bool) {
+	return inodeKey{}, false
+}
+
+// fileOwnerIDs 在 Windows 上没有 uid/gid，不记录属主
+func fileOwnerIDs(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+func applyOwner(path string, uid, gid int) error {
+	return nil
+}
+
+func deviceNumbers(info os.FileInfo) (major, minor uint32) {
+	return 0, 0
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+
+package core
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// hardLinkKey 返回有多个硬链接的普通文件的 inode 标识
+func hardLinkKey(info os.FileInfo) (inodeKey, bool) {
+	if !info.Mode().IsRegular() {
+		return inodeKey{}, false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || uint64(st.Nlink) < 2 {
+		return inodeKey{}, false
+	}
+	return inodeKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+// fileOwnerIDs 返回文件的 uid/gid
+func fileOwnerIDs(info os.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
+
+func applyOwner(path string, uid, gid int) error {
+	return os.Lchown(path, uid, gid)
+}
+
+// deviceNumbers 返回设备节点的主、次设备号
+func deviceNumbers(info os.FileInfo) (major, minor uint32) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return unix.Major(uint64(st.Rdev)), unix.Minor(uint64(st.Rdev))
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type closeTrackingWriter struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *closeTrackingWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestBackupTo_RestoreFrom_Pipe(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "a.txt"), bytes.Repeat([]byte("stream"), 10000), 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+
+	for _, tc := range []struct {
+		codec   string
+		encrypt bool
+	}{{CodecStore, false}, {CodecHuffman, false}, {CodecDeflate, false}, {CodecStore, true}, {CodecDeflate, true}} {
+		pr, pw := io.Pipe()
+		backupErr := make(chan error, 1)
+		go func() {
+			err := manager.BackupTo([]string{srcDir}, pw, FilterConfig{MaxSize: -1}, tc.codec, tc.encrypt, AlgoChaCha20, "pw")
+			pw.CloseWithError(err)
+			backupErr <- err
+		}()
+
+		restoreDir := filepath.Join(tempDir, "restore-"+tc.codec+boolName(tc.encrypt))
+		require.NoError(t, manager.RestoreFrom(pr, restoreDir, "pw", RestoreOptions{}))
+		require.NoError(t, <-backupErr)
+
+		got, err := os.ReadFile(filepath.Join(restoreDir, "sub", "a.txt"))
+		require.NoError(t, err)
+		require.Equal(t, bytes.Repeat([]byte("stream"), 10000), got)
+	}
+}
+
+func boolName(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func TestBackupIncrementalTo_StreamChain(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("v1"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("b"), 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	filters := FilterConfig{MaxSize: -1}
+
+	// 增量备份仍需从文件读取父备份的清单
+	baseFile := filepath.Join(tempDir, "base.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, baseFile, filters, CodecHuffman, true, AlgoAES256_CTR, "pw"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("v2!"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "b.txt")))
+
+	inc := &closeTrackingWriter{}
+	require.NoError(t, manager.BackupIncrementalTo([]string{srcDir}, inc, baseFile, filters, CodecHuffman, true, AlgoAES256_CTR, "pw"))
+	require.False(t, inc.closed, "caller-owned writer must not be closed")
+
+	base, err := os.Open(baseFile)
+	require.NoError(t, err)
+	defer base.Close()
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	require.NoError(t, manager.RestoreFrom(base, restoreDir, "pw", RestoreOptions{}))
+	require.NoError(t, manager.RestoreFrom(bytes.NewReader(inc.Bytes()), restoreDir, "pw", RestoreOptions{}))
+
+	got, err := os.ReadFile(filepath.Join(restoreDir, "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "v2!", string(got))
+	require.NoFileExists(t, filepath.Join(restoreDir, "b.txt"))
+
+	err = manager.RestoreFrom(bytes.NewReader(inc.Bytes()), restoreDir, "", RestoreOptions{})
+	require.ErrorIs(t, err, ErrPasswordRequired)
+}
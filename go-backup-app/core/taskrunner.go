@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -23,7 +24,7 @@ type TaskConfig struct {
 	SourcePaths     []string     `json:"sourcePaths"`
 	DestinationDir  string       `json:"destinationDir"`
 	Filters         FilterConfig  `json:"filters"`
-	UseCompression  bool         `json:"useCompression"`
+	Compression     string       `json:"compression"` // 压缩方式，见 Codecs
 	UseEncryption   bool         `json:"useEncryption"`
 	Algorithm       uint8        `json:"algorithm"`
 	Password        string       `json:"password"`
@@ -34,6 +35,25 @@ type TaskConfig struct {
 	CreatedAt       time.Time    `json:"createdAt"`
 	UpdatedAt       time.Time    `json:"updatedAt"`
 	LastBackupPath  string       `json:"lastBackupPath"`
+	// CompressionPolicy 决定压缩时哪些文件按原样保存，为空时使用默认策略
+	CompressionPolicy *CompressionPolicy `json:"compressionPolicy,omitempty"`
+}
+
+// UnmarshalJSON 兼容旧版本保存的任务配置: 旧配置只有 useCompression 开关，开启时对应 huffman
+func (c *TaskConfig) UnmarshalJSON(data []byte) error {
+	type plain TaskConfig
+	var cfg struct {
+		plain
+		UseCompression *bool `json:"useCompression"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	*c = TaskConfig(cfg.plain)
+	if c.Compression == "" && cfg.UseCompression != nil && *cfg.UseCompression {
+		c.Compression = CodecHuffman
+	}
+	return nil
 }
 
 type BackupTask struct {
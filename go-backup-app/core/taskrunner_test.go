@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
@@ -104,3 +105,24 @@ func TestTaskRunner_ScheduleTriggersExecutor(t *testing.T) {
 	}
 }
 
+
+func TestTaskConfig_LegacyUseCompression(t *testing.T) {
+	var cfg TaskConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"destinationDir":"/backups","useCompression":true,"incremental":true}`), &cfg))
+	require.Equal(t, CodecHuffman, cfg.Compression)
+	require.Equal(t, "/backups", cfg.DestinationDir)
+	require.True(t, cfg.Incremental)
+
+	cfg = TaskConfig{}
+	require.NoError(t, json.Unmarshal([]byte(`{"useCompression":false}`), &cfg))
+	require.Equal(t, "", cfg.Compression)
+
+	cfg = TaskConfig{}
+	require.NoError(t, json.Unmarshal([]byte(`{"compression":"deflate","useCompression":true}`), &cfg))
+	require.Equal(t, CodecDeflate, cfg.Compression)
+
+	data, err := json.Marshal(TaskConfig{Compression: CodecDeflate})
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"compression":"deflate"`)
+	require.NotContains(t, string(data), "useCompression")
+}
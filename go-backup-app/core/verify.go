@@ -0,0 +1,297 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VerifyIssueKind 区分校验发现的问题类型
+type VerifyIssueKind string
+
+const (
+	VerifyCorrupt    VerifyIssueKind = "corrupt"    // 条目头部或数据损坏，例如 CRC 不符
+	VerifyMissing    VerifyIssueKind = "missing"    // 清单中记录的条目不在备份中
+	VerifyUnexpected VerifyIssueKind = "unexpected" // 备份中有但清单中没有记录的条目
+	VerifyMismatch   VerifyIssueKind = "mismatch"   // 条目的类型或大小与清单不一致
+	VerifyUnreadable VerifyIssueKind = "unreadable" // 备份文件无法打开，或从某个位置开始无法继续读取
+)
+
+// VerifyIssue 是校验发现的一个问题，Path 为空表示问题属于整个备份文件
+type VerifyIssue struct {
+	Backup  string          `json:"backup"`
+	Path    string          `json:"path,omitempty"`
+	Kind    VerifyIssueKind `json:"kind"`
+	Message string          `json:"message"`
+}
+
+// VerifyReport 是 Verify 的结果
+type VerifyReport struct {
+	Backups []string      `json:"backups"` // 校验过的备份，从完整备份到目标备份
+	Entries int           `json:"entries"` // 读取的条目数
+	Bytes   int64         `json:"bytes"`   // 校验的数据字节数
+	Issues  []VerifyIssue `json:"issues"`
+	OK      bool          `json:"ok"`
+}
+
+func (r *VerifyReport) add(backup, relPath string, kind VerifyIssueKind, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, VerifyIssue{Backup: backup, Path: relPath, Kind: kind, Message: fmt.Sprintf(format, args...)})
+}
+
+// Verify 读取备份 (增量备份则读取整条备份链) 的所有条目但不写入任何文件，
+// 检查条目头部、数据 CRC 与内容哈希、归档索引以及清单与实际内容是否一致。
+// 损坏和缺失的条目记录在报告中；只有密码错误、取消等无法开始校验的情况才返回 error。
+func (m *BackupManager) Verify(backupFile, password string) (*VerifyReport, error) {
+	report := &VerifyReport{Backups: []string{}, Issues: []VerifyIssue{}}
+	m.emitProgressDetail("正在校验备份...", 0, 0, 0, 0, "verifying")
+
+	chain, err := m.resolveRestoreChain(backupFile, password)
+	if err != nil {
+		if isPasswordError(err) || m.ctx.Err() != nil {
+			return nil, err
+		}
+		report.Backups = append(report.Backups, backupFile)
+		report.add(backupFile, "", VerifyUnreadable, "%v", err)
+		return report, nil
+	}
+	report.Backups = chain
+
+	// state 是备份链到当前位置为止合并后的内容；前面的备份没有读完时，后面备份的清单比较没有意义
+	state := make(map[string]*FileMetadata, 1024)
+	complete := true
+	for _, file := range chain {
+		readAll, err := m.verifyArchive(file, password, state, complete, report)
+		if err != nil {
+			return nil, err
+		}
+		complete = complete && readAll
+	}
+
+	report.OK = len(report.Issues) == 0
+	m.emitProgressDetail("校验完成", report.Entries, report.Entries, report.Bytes, report.Bytes, "verifying")
+	return report, nil
+}
+
+func isPasswordError(err error) bool {
+	return errors.Is(err, ErrPasswordRequired) || errors.Is(err, ErrInvalidPassword)
+}
+
+// verifyArchive 校验单个备份文件并把它的内容合并到 state，返回是否读完了整个文件
+func (m *BackupManager) verifyArchive(backupFile, password string, state map[string]*FileMetadata, checkManifest bool, report *VerifyReport) (bool, error) {
+	reader, err := m.getReaderPipe(backupFile, password)
+	if err != nil {
+		if isPasswordError(err) {
+			return false, err
+		}
+		report.add(backupFile, "", VerifyUnreadable, "%v", err)
+		return false, nil
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-m.ctx.Done():
+			_ = reader.Close()
+		case <-done:
+		}
+	}()
+	defer close(done)
+	defer reader.Close()
+
+	var lastEmit time.Time
+	emit := func(relPath string) {
+		if time.Since(lastEmit) < 150*time.Millisecond {
+			return
+		}
+		lastEmit = time.Now()
+		m.emitProgressDetail(fmt.Sprintf("正在校验: %s", relPath), report.Entries, 0, report.Bytes, 0, "verifying")
+	}
+
+	archiveReader := NewArchiveReader(reader)
+	buffer := make([]byte, copyBufferSize)
+	offsets := make(map[string]int64, 1024)
+	var manifest *BackupManifest
+
+	for {
+		if m.ctx.Err() != nil {
+			return false, m.ctx.Err()
+		}
+
+		offset := archiveReader.Offset()
+		meta, err := archiveReader.NextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if m.ctx.Err() != nil {
+				return false, m.ctx.Err()
+			}
+			// 头部损坏之后无法确定后续条目的位置
+			report.add(backupFile, "", VerifyUnreadable, "cannot read entry header at offset %d: %v", offset, err)
+			return false, nil
+		}
+		// v2 归档开头的魔数在读取第一个头部时才读出，头部位于魔数之后
+		if offset == 0 && archiveReader.version == archiveVersion2 {
+			offset = int64(len(archiveMagicV2))
+		}
+		report.Entries++
+		emit(meta.Path)
+
+		for _, problem := range checkEntryHeader(meta, state) {
+			report.add(backupFile, meta.Path, VerifyCorrupt, "%s", problem)
+		}
+
+		var payload bytes.Buffer
+		var dst io.Writer = writeCallbackWriter{w: io.Discard, onWrite: func(n int) { report.Bytes += int64(n) }}
+		if isInternalPath(meta.Path) {
+			dst = &payload
+		}
+		if err := archiveReader.copyEntryData(meta, dst, buffer); err != nil {
+			if !errors.Is(err, ErrChecksumMismatch) && !errors.Is(err, ErrContentHashMismatch) {
+				if m.ctx.Err() != nil {
+					return false, m.ctx.Err()
+				}
+				report.add(backupFile, meta.Path, VerifyUnreadable, "%v", err)
+				return false, nil
+			}
+			// 数据已经完整读出，流仍然对齐，可以继续校验后续条目
+			report.add(backupFile, meta.Path, VerifyCorrupt, "%v", err)
+		}
+
+		switch {
+		case meta.Path == manifestEntryPath:
+			offsets[meta.Path] = offset
+			manifest, err = UnmarshalManifest(payload.Bytes())
+			if err != nil {
+				report.add(backupFile, meta.Path, VerifyCorrupt, "invalid manifest: %v", err)
+			}
+		case meta.Path == archiveIndexPath:
+			verifyArchiveIndex(backupFile, payload.Bytes(), offset, offsets, report)
+		case isInternalPath(meta.Path):
+		case meta.Deleted:
+			prefix := meta.Path + "/"
+			for p := range state {
+				if p == meta.Path || strings.HasPrefix(p, prefix) {
+					delete(state, p)
+				}
+			}
+			offsets[meta.Path] = offset
+		default:
+			state[meta.Path] = meta
+			offsets[meta.Path] = offset
+		}
+	}
+
+	if manifest != nil && checkManifest {
+		verifyManifest(backupFile, manifest, state, report)
+	}
+	return true, nil
+}
+
+// checkEntryHeader 检查头部字段是否自洽；state 为 nil 时不检查硬链接的目标
+func checkEntryHeader(meta *FileMetadata, state map[string]*FileMetadata) []string {
+	var problems []string
+	cleaned := path.Clean(meta.Path)
+	switch {
+	case meta.Path == "":
+		problems = append(problems, "empty path")
+	case cleaned != meta.Path || path.IsAbs(meta.Path) || cleaned == ".." || strings.HasPrefix(cleaned, "../"):
+		problems = append(problems, "path is not a clean relative path")
+	}
+	if meta.Size < 0 {
+		problems = append(problems, fmt.Sprintf("negative size %d", meta.Size))
+	}
+	if meta.Deleted {
+		return problems
+	}
+	if meta.IsDir && meta.IsLink {
+		problems = append(problems, "entry is both a directory and a symbolic link")
+	}
+	if meta.IsLink && meta.LinkDest == "" {
+		problems = append(problems, "symbolic link without target")
+	}
+	if !meta.Mode.IsRegular() && meta.payloadSize() > 0 {
+		problems = append(problems, fmt.Sprintf("%s entry carries %d bytes of data", meta.Mode.Type(), meta.payloadSize()))
+	}
+	if meta.HardLink != "" && state != nil {
+		if _, ok := state[meta.HardLink]; !ok {
+			problems = append(problems, fmt.Sprintf("hard link target %s not found", meta.HardLink))
+		}
+	}
+	return problems
+}
+
+// verifyArchiveIndex 检查归档索引记录的偏移是否与实际读到的条目位置一致
+func verifyArchiveIndex(backupFile string, payload []byte, indexOffset int64, offsets map[string]int64, report *VerifyReport) {
+	if len(payload) < archiveIndexLocatorLen {
+		report.add(backupFile, archiveIndexPath, VerifyCorrupt, "archive index is too short")
+		return
+	}
+	locator := payload[len(payload)-archiveIndexLocatorLen:]
+	if !bytes.Equal(locator[:len(archiveIndexMagic)], archiveIndexMagic) ||
+		int64(binary.BigEndian.Uint64(locator[len(archiveIndexMagic):])) != indexOffset {
+		report.add(backupFile, archiveIndexPath, VerifyCorrupt, "archive index locator does not point to the index")
+	}
+
+	var index archiveIndex
+	if err := json.Unmarshal(payload[:len(payload)-archiveIndexLocatorLen], &index); err != nil {
+		report.add(backupFile, archiveIndexPath, VerifyCorrupt, "invalid archive index: %v", err)
+		return
+	}
+	// 同一路径出现多次时以最后一次为准，与 offsets 一致
+	last := make(map[string]int64, len(index.Entries))
+	for _, e := range index.Entries {
+		last[e.Path] = e.Offset
+	}
+	for p, offset := range last {
+		if actual, ok := offsets[p]; !ok || actual != offset {
+			report.add(backupFile, p, VerifyCorrupt, "archive index points to offset %d, entry is at %d", offset, actual)
+		}
+	}
+	if index.Manifest != 0 {
+		if actual, ok := offsets[manifestEntryPath]; !ok || actual != index.Manifest {
+			report.add(backupFile, manifestEntryPath, VerifyCorrupt, "archive index points to the manifest at offset %d, manifest is at %d", index.Manifest, actual)
+		}
+	}
+}
+
+// verifyManifest 比较清单记录的文件列表与备份链合并后的实际内容
+func verifyManifest(backupFile string, manifest *BackupManifest, state map[string]*FileMetadata, report *VerifyReport) {
+	listed := make(map[string]struct{}, len(manifest.Files))
+	for _, f := range manifest.Files {
+		listed[f.Path] = struct{}{}
+		meta, ok := state[f.Path]
+		if !ok {
+			report.add(backupFile, f.Path, VerifyMissing, "listed in manifest but not found in backup")
+			continue
+		}
+		if meta.IsDir != f.IsDir || meta.IsLink != f.IsLink || meta.HardLink != f.HardLink {
+			report.add(backupFile, f.Path, VerifyMismatch, "entry type differs from manifest")
+			continue
+		}
+		if meta.Mode.IsRegular() && meta.HardLink == "" && meta.Size != f.Size {
+			report.add(backupFile, f.Path, VerifyMismatch, "size %d differs from manifest size %d (file changed during backup?)", meta.Size, f.Size)
+			continue
+		}
+		if meta.SHA256 != "" && f.SHA256 != "" && meta.SHA256 != f.SHA256 {
+			report.add(backupFile, f.Path, VerifyMismatch, "content hash differs from manifest")
+		}
+	}
+
+	unexpected := make([]string, 0)
+	for p := range state {
+		if _, ok := listed[p]; !ok && p != "." {
+			unexpected = append(unexpected, p)
+		}
+	}
+	sort.Strings(unexpected)
+	for _, p := range unexpected {
+		report.add(backupFile, p, VerifyUnexpected, "found in backup but not listed in manifest")
+	}
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify_ChainAndCorruption(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0755))
+	content := bytes.Repeat([]byte("verify me "), 1000)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "a.txt"), content, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "b.txt"), []byte("b"), 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	filters := FilterConfig{MaxSize: -1}
+
+	baseFile := filepath.Join(tempDir, "base.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, baseFile, filters, CodecHuffman, true, AlgoAES256_CTR, "pw"))
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "b.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "c.txt"), []byte("c"), 0644))
+	incFile := filepath.Join(tempDir, "inc.qbak")
+	require.NoError(t, manager.BackupIncremental([]string{srcDir}, incFile, baseFile, filters, CodecHuffman, true, AlgoAES256_CTR, "pw"))
+
+	report, err := manager.Verify(incFile, "pw")
+	require.NoError(t, err)
+	require.True(t, report.OK, "%+v", report.Issues)
+	require.Equal(t, []string{baseFile, incFile}, report.Backups)
+	require.GreaterOrEqual(t, report.Bytes, int64(len(content)))
+
+	_, err = manager.Verify(incFile, "wrong")
+	require.ErrorIs(t, err, ErrInvalidPassword)
+
+	// 缺少父备份
+	require.NoError(t, os.Rename(baseFile, baseFile+".bak"))
+	report, err = manager.Verify(incFile, "pw")
+	require.NoError(t, err)
+	require.False(t, report.OK)
+	require.Equal(t, VerifyUnreadable, report.Issues[0].Kind)
+	require.NoError(t, os.Rename(baseFile+".bak", baseFile))
+
+	// 翻转未压缩、未加密备份中的一个数据字节
+	plainFile := filepath.Join(tempDir, "plain.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, plainFile, filters, CodecStore, false, 0, ""))
+	raw, err := os.ReadFile(plainFile)
+	require.NoError(t, err)
+	pos := bytes.Index(raw, content)
+	require.Greater(t, pos, 0)
+	raw[pos+10] ^= 0xFF
+	require.NoError(t, os.WriteFile(plainFile, raw, 0644))
+
+	report, err = manager.Verify(plainFile, "")
+	require.NoError(t, err)
+	require.False(t, report.OK)
+	require.Len(t, report.Issues, 1)
+	require.Equal(t, VerifyCorrupt, report.Issues[0].Kind)
+	require.Equal(t, "sub/a.txt", report.Issues[0].Path)
+}
+
+func TestVerify_ManifestConsistency(t *testing.T) {
+	tempDir := t.TempDir()
+	backupFile := filepath.Join(tempDir, "inconsistent.qbak")
+
+	manifest := BackupManifest{Version: manifestVersion, Type: BackupTypeFull, CreatedAt: time.Now(), Files: []ManifestFile{
+		{Path: "a.txt", Size: 1, Mode: 0644},
+		{Path: "b.txt", Size: 1, Mode: 0644},
+	}}
+	manifestBytes, err := json.Marshal(manifest)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	aw := NewArchiveWriter(&buf)
+	buffer := make([]byte, 4096)
+	require.NoError(t, aw.WriteEntry(FileMetadata{Path: manifestEntryPath, Size: int64(len(manifestBytes)), Mode: 0644}, bytes.NewReader(manifestBytes), buffer, nil))
+	for _, name := range []string{"a.txt", "c.txt"} {
+		require.NoError(t, aw.WriteEntry(FileMetadata{Path: name, Size: 1, Mode: 0644, HasCRC: true}, bytes.NewReader([]byte("x")), buffer, nil))
+	}
+	require.NoError(t, aw.WriteEntry(FileMetadata{Path: "link", Mode: 0644, HardLink: "missing.txt"}, nil, buffer, nil))
+	require.NoError(t, aw.WriteIndex())
+	require.NoError(t, os.WriteFile(backupFile, buf.Bytes(), 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	report, err := manager.Verify(backupFile, "")
+	require.NoError(t, err)
+
+	kinds := map[string]VerifyIssueKind{}
+	for _, issue := range report.Issues {
+		kinds[issue.Path] = issue.Kind
+	}
+	require.Equal(t, map[string]VerifyIssueKind{
+		"b.txt": VerifyMissing,
+		"c.txt": VerifyUnexpected,
+		"link":  VerifyUnexpected,
+	}, kinds)
+	require.Len(t, report.Issues, 4, "the dangling hard link is also reported as corrupt")
+}
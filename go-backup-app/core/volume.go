@@ -0,0 +1,418 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 分卷格式: 备份流 (加密、压缩之后的最终字节) 按大小切分为 name.qbak.001、name.qbak.002 ...
+// 每个分卷以 16 字节的头部开始:
+//
+//	[QVOL][version u8][flags u8][reserved 2][volume number u32][set id u32]
+//
+// 最后一个分卷带有 volumeFlagLast 标记，读取时据此判断分卷是否完整。
+var volumeMagic = []byte("QVOL")
+
+const (
+	volumeVersion    = 1
+	volumeHeaderLen  = 16
+	volumeFlagLast   = 0x01
+	volumeFlagOffset = 5
+
+	// MinVolumeSize 是允许的最小分卷大小 (包括分卷头部)
+	MinVolumeSize = 64 * 1024
+)
+
+// volumeName 返回第 n 个分卷的文件名，从 1 开始
+func volumeName(base string, n int) string {
+	return fmt.Sprintf("%s.%03d", base, n)
+}
+
+type volumeHeader struct {
+	number int
+	last   bool
+	setID  uint32
+}
+
+func (h volumeHeader) marshal() []byte {
+	buf := make([]byte, volumeHeaderLen)
+	copy(buf, volumeMagic)
+	buf[4] = volumeVersion
+	if h.last {
+		buf[volumeFlagOffset] = volumeFlagLast
+	}
+	binary.BigEndian.PutUint32(buf[8:12], uint32(h.number))
+	binary.BigEndian.PutUint32(buf[12:16], h.setID)
+	return buf
+}
+
+func parseVolumeHeader(buf []byte) (volumeHeader, error) {
+	if len(buf) < volumeHeaderLen || !bytes.Equal(buf[:len(volumeMagic)], volumeMagic) {
+		return volumeHeader{}, fmt.Errorf("not a backup volume")
+	}
+	if buf[4] != volumeVersion {
+		return volumeHeader{}, fmt.Errorf("unsupported volume version: %d", buf[4])
+	}
+	return volumeHeader{
+		number: int(binary.BigEndian.Uint32(buf[8:12])),
+		last:   buf[volumeFlagOffset]&volumeFlagLast != 0,
+		setID:  binary.BigEndian.Uint32(buf[12:16]),
+	}, nil
+}
+
+// volumeWriter 把写入的数据依次写入各个分卷，当前分卷写满之后才创建下一个分卷，因此最后一个分卷不会为空
+type volumeWriter struct {
+	base        string
+	payloadSize int64
+	setID       uint32
+	// setIDHash 不为 nil 时 (可复现备份) 分卷集合 ID 取第一个分卷内容的 CRC32，在第一个分卷写完时填入
+	setIDHash hash.Hash32
+
+	number  int
+	file    *os.File
+	written int64
+}
+
+func newVolumeWriter(base string, volumeSize int64, deterministic bool) (*volumeWriter, error) {
+	if volumeSize < MinVolumeSize {
+		return nil, fmt.Errorf("volume size must be at least %d bytes", MinVolumeSize)
+	}
+	w := &volumeWriter{base: base, payloadSize: volumeSize - volumeHeaderLen}
+	if deterministic {
+		w.setIDHash = crc32.NewIEEE()
+	} else {
+		var id [4]byte
+		if _, err := rand.Read(id[:]); err != nil {
+			return nil, fmt.Errorf("failed to generate volume set id: %w", err)
+		}
+		w.setID = binary.BigEndian.Uint32(id[:])
+	}
+	if err := w.next(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *volumeWriter) next() error {
+	if w.file != nil {
+		if err := w.finishSetID(); err != nil {
+			return err
+		}
+		if err := w.file.Close(); err != nil {
+			return fmt.Errorf("failed to close volume %s: %w", w.file.Name(), err)
+		}
+		w.file = nil
+	}
+	w.number++
+	f, err := os.Create(volumeName(w.base, w.number))
+	if err != nil {
+		return fmt.Errorf("failed to create volume: %w", err)
+	}
+	if _, err := f.Write(volumeHeader{number: w.number, setID: w.setID}.marshal()); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write volume header %s: %w", f.Name(), err)
+	}
+	w.file = f
+	w.written = 0
+	return nil
+}
+
+func (w *volumeWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if w.written == w.payloadSize {
+			if err := w.next(); err != nil {
+				return total, err
+			}
+		}
+		chunk := p
+		if remaining := w.payloadSize - w.written; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		n, err := w.file.Write(chunk)
+		if w.setIDHash != nil {
+			w.setIDHash.Write(chunk[:n])
+		}
+		total += n
+		w.written += int64(n)
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// finishSetID 在第一个分卷写完时计算可复现备份的分卷集合 ID 并写入它的头部
+func (w *volumeWriter) finishSetID() error {
+	if w.setIDHash == nil {
+		return nil
+	}
+	w.setID = w.setIDHash.Sum32()
+	w.setIDHash = nil
+	var id [4]byte
+	binary.BigEndian.PutUint32(id[:], w.setID)
+	if _, err := w.file.WriteAt(id[:], 12); err != nil {
+		return fmt.Errorf("failed to write volume header %s: %w", w.file.Name(), err)
+	}
+	return nil
+}
+
+// Close 标记最后一个分卷，并删除之前同名备份遗留的多余分卷
+func (w *volumeWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.finishSetID()
+	if err == nil {
+		_, err = w.file.WriteAt([]byte{volumeFlagLast}, volumeFlagOffset)
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to finish volume %s: %w", volumeName(w.base, w.number), err)
+	}
+	for n := w.number + 1; ; n++ {
+		if os.Remove(volumeName(w.base, n)) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// backupSource 是单个备份文件或一组分卷的只读视图
+type backupSource interface {
+	io.Reader
+	io.ReaderAt
+	io.Closer
+	Size() int64
+}
+
+type fileSource struct {
+	*os.File
+	size int64
+}
+
+func (f *fileSource) Size() int64 { return f.size }
+
+// openBackupSource 打开备份文件。path 可以是普通备份文件、分卷集合的基础名 (name.qbak) 或其中任意一个分卷 (name.qbak.001)。
+func openBackupSource(path string) (backupSource, error) {
+	if base, ok := volumeSetBase(path); ok {
+		return openVolumeSet(base)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &fileSource{File: f, size: info.Size()}, nil
+}
+
+// volumeSetBase 判断 path 是否指向一个分卷集合，并返回集合的基础名
+func volumeSetBase(path string) (string, bool) {
+	if _, err := os.Stat(path); err != nil {
+		// 基础名本身不存在时查找第一个分卷
+		if _, err := os.Stat(volumeName(path, 1)); err == nil {
+			return path, true
+		}
+		return "", false
+	}
+	dot := strings.LastIndexByte(path, '.')
+	if dot < 0 || len(path)-dot-1 != 3 {
+		return "", false
+	}
+	if _, err := strconv.Atoi(path[dot+1:]); err != nil {
+		return "", false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	header := make([]byte, volumeHeaderLen)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return "", false
+	}
+	if _, err := parseVolumeHeader(header); err != nil {
+		return "", false
+	}
+	return path[:dot], true
+}
+
+// BackupExists 判断备份文件或分卷集合的第一个分卷是否存在
+func BackupExists(backupFile string) bool {
+	if _, err := os.Stat(backupFile); err == nil {
+		return true
+	}
+	_, err := os.Stat(volumeName(backupFile, 1))
+	return err == nil
+}
+
+type volumePart struct {
+	path   string
+	offset int64 // 在整个备份流中的起始位置
+	size   int64 // 不包括分卷头部
+}
+
+// volumeSet 把一组分卷拼接为连续的备份流，同一时间只打开一个分卷
+type volumeSet struct {
+	parts []volumePart
+	size  int64
+
+	mu      sync.Mutex
+	cur     *os.File
+	curPart int
+	pos     int64
+}
+
+func openVolumeSet(base string) (*volumeSet, error) {
+	vs := &volumeSet{curPart: -1}
+	var setID uint32
+	header := make([]byte, volumeHeaderLen)
+	for n := 1; ; n++ {
+		name := volumeName(base, n)
+		f, err := os.Open(name)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("%w: %s", ErrVolumeMissing, name)
+			}
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err == nil {
+			_, err = io.ReadFull(f, header)
+		}
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read volume %s: %w", name, err)
+		}
+		h, err := parseVolumeHeader(header)
+		if err != nil {
+			return nil, fmt.Errorf("invalid volume %s: %w", name, err)
+		}
+		if n == 1 {
+			setID = h.setID
+		}
+		if h.number != n || h.setID != setID {
+			return nil, fmt.Errorf("volume %s does not belong to this volume set", name)
+		}
+
+		size := info.Size() - volumeHeaderLen
+		vs.parts = append(vs.parts, volumePart{path: name, offset: vs.size, size: size})
+		vs.size += size
+		if h.last {
+			return vs, nil
+		}
+	}
+}
+
+func (vs *volumeSet) Size() int64 { return vs.size }
+
+func (vs *volumeSet) ReadAt(p []byte, off int64) (int, error) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	total := 0
+	for len(p) > 0 {
+		if off >= vs.size {
+			return total, io.EOF
+		}
+		i := vs.partAt(off)
+		part := vs.parts[i]
+		if err := vs.openPart(i); err != nil {
+			return total, err
+		}
+		chunk := p
+		if remaining := part.offset + part.size - off; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		n, err := vs.cur.ReadAt(chunk, volumeHeaderLen+off-part.offset)
+		total += n
+		off += int64(n)
+		if err != nil && !(err == io.EOF && n == len(chunk)) {
+			if err == io.EOF {
+				err = fmt.Errorf("volume %s is truncated", part.path)
+			}
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+func (vs *volumeSet) Read(p []byte) (int, error) {
+	if vs.pos >= vs.size {
+		return 0, io.EOF
+	}
+	if remaining := vs.size - vs.pos; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := vs.ReadAt(p, vs.pos)
+	vs.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// partAt 返回包含 off 的分卷下标
+func (vs *volumeSet) partAt(off int64) int {
+	lo, hi := 0, len(vs.parts)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if vs.parts[mid].offset <= off {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
+
+func (vs *volumeSet) openPart(i int) error {
+	if vs.curPart == i {
+		return nil
+	}
+	if vs.cur != nil {
+		_ = vs.cur.Close()
+		vs.cur = nil
+	}
+	f, err := os.Open(vs.parts[i].path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrVolumeMissing, vs.parts[i].path)
+		}
+		return err
+	}
+	vs.cur = f
+	vs.curPart = i
+	return nil
+}
+
+func (vs *volumeSet) Close() error {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if vs.cur == nil {
+		return nil
+	}
+	err := vs.cur.Close()
+	vs.cur = nil
+	vs.curPart = -1
+	return err
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupRestore_Volumes(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+	data := make([]byte, 300*1024)
+	rand.New(rand.NewSource(3)).Read(data)
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "random.bin"), data, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "small.txt"), []byte("v1"), 0644))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	manager.VolumeSize = MinVolumeSize
+	filters := FilterConfig{MaxSize: -1}
+
+	backupFile := filepath.Join(tempDir, "vol.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, filters, CodecHuffman, true, AlgoChaCha20, "pw"))
+	require.NoFileExists(t, backupFile)
+	require.True(t, BackupExists(backupFile))
+
+	volumes, err := filepath.Glob(backupFile + ".*")
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(volumes), 5)
+	for _, v := range volumes {
+		info, err := os.Stat(v)
+		require.NoError(t, err)
+		require.LessOrEqual(t, info.Size(), int64(MinVolumeSize))
+	}
+
+	// 基础名和第一个分卷都可以作为备份路径
+	for _, name := range []string{backupFile, volumeName(backupFile, 1)} {
+		restoreDir := filepath.Join(tempDir, "restore-"+filepath.Base(name))
+		require.NoError(t, manager.Restore(name, restoreDir, "pw"))
+		got, err := os.ReadFile(filepath.Join(restoreDir, "random.bin"))
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(data, got))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, manager.ExtractFile(backupFile, "random.bin", "pw", &buf))
+	require.True(t, bytes.Equal(data, buf.Bytes()))
+
+	// 增量备份同样分卷，并能通过分卷集合的基础名找到父备份
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "small.txt"), []byte("v2"), 0644))
+	incFile := filepath.Join(tempDir, "inc.qbak")
+	require.NoError(t, manager.BackupIncremental([]string{srcDir}, incFile, backupFile, filters, CodecHuffman, true, AlgoChaCha20, "pw"))
+	require.FileExists(t, volumeName(incFile, 1))
+	chainDir := filepath.Join(tempDir, "restore-chain")
+	require.NoError(t, manager.Restore(incFile, chainDir, "pw"))
+	got, err := os.ReadFile(filepath.Join(chainDir, "small.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(got))
+
+	// 缺少中间或最后一个分卷时报告缺少的是哪个分卷
+	last := volumeName(backupFile, len(volumes))
+	for _, missing := range []string{volumeName(backupFile, 2), last} {
+		require.NoError(t, os.Rename(missing, missing+".bak"))
+		err := manager.Restore(backupFile, filepath.Join(tempDir, "missing"), "pw")
+		require.ErrorIs(t, err, ErrVolumeMissing)
+		require.Contains(t, err.Error(), filepath.Base(missing))
+		require.NoError(t, os.Rename(missing+".bak", missing))
+	}
+
+	// 重新写入更小的备份时删除多余的旧分卷
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "random.bin")))
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, filters, CodecHuffman, true, AlgoChaCha20, "pw"))
+	require.FileExists(t, volumeName(backupFile, 1))
+	require.NoFileExists(t, volumeName(backupFile, 2))
+}
@@ -0,0 +1,85 @@
+//go:build linux
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs 读取 path 本身 (不跟随符号链接) 的所有扩展属性。
+// POSIX ACL (system.posix_acl_*)、SELinux 标签 (security.selinux) 和文件能力 (security.capability) 都以扩展属性的形式保存。
+func readXattrs(path string) (map[string][]byte, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil {
+		if isXattrUnsupported(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list xattrs of %s: %w", path, err)
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list xattrs of %s: %w", path, err)
+	}
+
+	xattrs := make(map[string][]byte)
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+		if name == "" {
+			continue
+		}
+		value, err := lgetxattr(path, name)
+		if err != nil {
+			// 属性可能在两次调用之间被删除，或者当前用户无权读取
+			if errors.Is(err, unix.ENODATA) || errors.Is(err, unix.EACCES) || errors.Is(err, unix.EPERM) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read xattr %s of %s: %w", name, path, err)
+		}
+		xattrs[name] = value
+	}
+	if len(xattrs) == 0 {
+		return nil, nil
+	}
+	return xattrs, nil
+}
+
+func lgetxattr(path, name string) ([]byte, error) {
+	for {
+		size, err := unix.Lgetxattr(path, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, size)
+		n, err := unix.Lgetxattr(path, name, value)
+		if errors.Is(err, unix.ERANGE) {
+			continue // 属性在两次调用之间变大了
+		}
+		if err != nil {
+			return nil, err
+		}
+		return value[:n], nil
+	}
+}
+
+// applyXattrs 将扩展属性写回 path 本身 (不跟随符号链接)，返回第一个失败的属性的错误
+func applyXattrs(path string, xattrs map[string][]byte) error {
+	var firstErr error
+	for name, value := range xattrs {
+		if err := unix.Lsetxattr(path, name, value, 0); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to set xattr %s on %s: %w", name, path, err)
+		}
+	}
+	return firstErr
+}
+
+func isXattrUnsupported(err error) bool {
+	return errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP)
+}
@@ -0,0 +1,62 @@
+//go:build linux
+
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestBackupRestore_Xattrs(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "dir"), 0755))
+	filePath := filepath.Join(srcDir, "dir", "tagged.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("data"), 0644))
+
+	if err := unix.Lsetxattr(filePath, "user.qbak.test", []byte("file-value"), 0); err != nil {
+		if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) {
+			t.Skipf("user xattrs not supported here: %v", err)
+		}
+		require.NoError(t, err)
+	}
+	require.NoError(t, unix.Lsetxattr(filepath.Join(srcDir, "dir"), "user.qbak.dir", []byte{0, 1, 2}, 0))
+
+	manager := NewBackupManager(context.Background())
+	manager.DisableEvents()
+	filters := FilterConfig{MaxSize: -1}
+
+	backupFile := filepath.Join(tempDir, "full.qbak")
+	require.NoError(t, manager.Backup([]string{srcDir}, backupFile, filters, CodecHuffman, false, 0, ""))
+
+	restoreDir := filepath.Join(tempDir, "restore")
+	require.NoError(t, manager.Restore(backupFile, restoreDir, ""))
+
+	xattrs, err := readXattrs(filepath.Join(restoreDir, "dir", "tagged.txt"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("file-value"), xattrs["user.qbak.test"])
+	xattrs, err = readXattrs(filepath.Join(restoreDir, "dir"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 1, 2}, xattrs["user.qbak.dir"])
+
+	skipDir := filepath.Join(tempDir, "restore-skip")
+	require.NoError(t, manager.RestoreWithOptions(backupFile, skipDir, "", RestoreOptions{SkipXattrs: true}))
+	xattrs, err = readXattrs(filepath.Join(skipDir, "dir", "tagged.txt"))
+	require.NoError(t, err)
+	require.NotContains(t, xattrs, "user.qbak.test")
+
+	// 只修改扩展属性也应该被增量备份识别为变化
+	require.NoError(t, unix.Lsetxattr(filePath, "user.qbak.test", []byte("changed"), 0))
+	incFile := filepath.Join(tempDir, "inc.qbak")
+	require.NoError(t, manager.BackupIncremental([]string{srcDir}, incFile, backupFile, filters, CodecHuffman, false, 0, ""))
+	require.NoError(t, manager.Restore(incFile, restoreDir, ""))
+	xattrs, err = readXattrs(filepath.Join(restoreDir, "dir", "tagged.txt"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("changed"), xattrs["user.qbak.test"])
+}
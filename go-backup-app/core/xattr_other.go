@@ -0,0 +1,13 @@
+//go:build !linux
+
+package core
+
+// 非 Linux 平台暂不支持扩展属性
+
+func readXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func applyXattrs(path string, xattrs map[string][]byte) error {
+	return nil
+}
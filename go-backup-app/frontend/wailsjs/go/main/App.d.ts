@@ -11,14 +11,20 @@ export function CreateTask(arg1:core.BackupTask):Promise<core.BackupTask>;
 
 export function DeleteTask(arg1:string):Promise<void>;
 
+export function DiffBackups(arg1:string,arg2:string,arg3:string):Promise<core.BackupDiff>;
+
 export function GetBackupHistory():Promise<Array<main.BackupRecord>>;
 
+export function GetDefaultCompressionPolicy():Promise<core.CompressionPolicy>;
+
 export function GetFileMetadata(arg1:Array<string>):Promise<Array<main.FileInfo>>;
 
 export function GetProfiles():Promise<Array<main.Profile>>;
 
 export function GetTasks():Promise<Array<core.BackupTask>>;
 
+export function ListBackup(arg1:string,arg2:string):Promise<core.BackupEntryNode>;
+
 export function ListDirectory(arg1:string):Promise<Array<main.FileInfo>>;
 
 export function OpenInExplorer(arg1:string):Promise<void>;
@@ -27,6 +33,8 @@ export function ResolveConflict(arg1:string,arg2:string):Promise<void>;
 
 export function RunTaskNow(arg1:string):Promise<void>;
 
+export function SalvageRestore(arg1:main.RestoreConfig):Promise<core.SalvageReport>;
+
 export function SelectDirectory():Promise<string>;
 
 export function SelectFiles(arg1:boolean):Promise<Array<string>>;
@@ -38,3 +46,5 @@ export function StartRestore(arg1:main.RestoreConfig):Promise<string>;
 export function StopOperation():Promise<void>;
 
 export function UpdateTask(arg1:core.BackupTask):Promise<void>;
+
+export function VerifyBackup(arg1:string,arg2:string):Promise<core.VerifyReport>;
@@ -18,10 +18,18 @@ export function DeleteTask(arg1) {
   return window['go']['main']['App']['DeleteTask'](arg1);
 }
 
+export function DiffBackups(arg1, arg2, arg3) {
+  return window['go']['main']['App']['DiffBackups'](arg1, arg2, arg3);
+}
+
 export function GetBackupHistory() {
   return window['go']['main']['App']['GetBackupHistory']();
 }
 
+export function GetDefaultCompressionPolicy() {
+  return window['go']['main']['App']['GetDefaultCompressionPolicy']();
+}
+
 export function GetFileMetadata(arg1) {
   return window['go']['main']['App']['GetFileMetadata'](arg1);
 }
@@ -34,6 +42,10 @@ export function GetTasks() {
   return window['go']['main']['App']['GetTasks']();
 }
 
+export function ListBackup(arg1, arg2) {
+  return window['go']['main']['App']['ListBackup'](arg1, arg2);
+}
+
 export function ListDirectory(arg1) {
   return window['go']['main']['App']['ListDirectory'](arg1);
 }
@@ -50,6 +62,10 @@ export function RunTaskNow(arg1) {
   return window['go']['main']['App']['RunTaskNow'](arg1);
 }
 
+export function SalvageRestore(arg1) {
+  return window['go']['main']['App']['SalvageRestore'](arg1);
+}
+
 export function SelectDirectory() {
   return window['go']['main']['App']['SelectDirectory']();
 }
@@ -73,3 +89,7 @@ export function StopOperation() {
 export function UpdateTask(arg1) {
   return window['go']['main']['App']['UpdateTask'](arg1);
 }
+
+export function VerifyBackup(arg1, arg2) {
+  return window['go']['main']['App']['VerifyBackup'](arg1, arg2);
+}
@@ -1,5 +1,164 @@
 export namespace core {
 	
+	export class DiffEntry {
+	    path: string;
+	    kind: string;
+	    oldSize: number;
+	    newSize: number;
+	    sizeDelta: number;
+	    contentChanged: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new DiffEntry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.kind = source["kind"];
+	        this.oldSize = source["oldSize"];
+	        this.newSize = source["newSize"];
+	        this.sizeDelta = source["sizeDelta"];
+	        this.contentChanged = source["contentChanged"];
+	    }
+	}
+	export class BackupDiff {
+	    oldBackups: string[];
+	    newBackups: string[];
+	    entries: DiffEntry[];
+	    added: number;
+	    removed: number;
+	    modified: number;
+	    typeChanged: number;
+	    sizeDelta: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupDiff(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.oldBackups = source["oldBackups"];
+	        this.newBackups = source["newBackups"];
+	        this.entries = this.convertValues(source["entries"], DiffEntry);
+	        this.added = source["added"];
+	        this.removed = source["removed"];
+	        this.modified = source["modified"];
+	        this.typeChanged = source["typeChanged"];
+	        this.sizeDelta = source["sizeDelta"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class BackupEntryNode {
+	    path: string;
+	    size: number;
+	    mode: number;
+	    // Go type: time
+	    modTime: any;
+	    isDir: boolean;
+	    isLink: boolean;
+	    linkDest?: string;
+	    xattrs?: Record<string, number[]>;
+	    hardLink?: string;
+	    owner?: FileOwner;
+	    devMajor?: number;
+	    devMinor?: number;
+	    sha256?: string;
+	    name: string;
+	    totalSize: number;
+	    children?: BackupEntryNode[];
+	
+	    static createFrom(source: any = {}) {
+	        return new BackupEntryNode(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.size = source["size"];
+	        this.mode = source["mode"];
+	        this.modTime = this.convertValues(source["modTime"], null);
+	        this.isDir = source["isDir"];
+	        this.isLink = source["isLink"];
+	        this.linkDest = source["linkDest"];
+	        this.xattrs = source["xattrs"];
+	        this.hardLink = source["hardLink"];
+	        this.owner = this.convertValues(source["owner"], FileOwner);
+	        this.devMajor = source["devMajor"];
+	        this.devMinor = source["devMinor"];
+	        this.sha256 = source["sha256"];
+	        this.name = source["name"];
+	        this.totalSize = source["totalSize"];
+	        this.children = this.convertValues(source["children"], BackupEntryNode);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class CompressionPolicy {
+	    storeExtensions: string[];
+	    storeTypes: string[];
+	
+	    static createFrom(source: any = {}) {
+	        return new CompressionPolicy(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.storeExtensions = source["storeExtensions"];
+	        this.storeTypes = source["storeTypes"];
+	    }
+	}
+	export class FileOwner {
+	    uid: number;
+	    gid: number;
+	    user?: string;
+	    group?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new FileOwner(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.uid = source["uid"];
+	        this.gid = source["gid"];
+	        this.user = source["user"];
+	        this.group = source["group"];
+	    }
+	}
 	export class FilterConfig {
 	    includePaths: string[];
 	    excludePaths: string[];
@@ -50,7 +209,7 @@ export namespace core {
 	    sourcePaths: string[];
 	    destinationDir: string;
 	    filters: FilterConfig;
-	    useCompression: boolean;
+	    compression: string;
 	    useEncryption: boolean;
 	    algorithm: number;
 	    password: string;
@@ -63,6 +222,7 @@ export namespace core {
 	    // Go type: time
 	    updatedAt: any;
 	    lastBackupPath: string;
+	    compressionPolicy?: CompressionPolicy;
 	
 	    static createFrom(source: any = {}) {
 	        return new TaskConfig(source);
@@ -73,7 +233,7 @@ export namespace core {
 	        this.sourcePaths = source["sourcePaths"];
 	        this.destinationDir = source["destinationDir"];
 	        this.filters = this.convertValues(source["filters"], FilterConfig);
-	        this.useCompression = source["useCompression"];
+	        this.compression = source["compression"];
 	        this.useEncryption = source["useEncryption"];
 	        this.algorithm = source["algorithm"];
 	        this.password = source["password"];
@@ -84,6 +244,7 @@ export namespace core {
 	        this.createdAt = this.convertValues(source["createdAt"], null);
 	        this.updatedAt = this.convertValues(source["updatedAt"], null);
 	        this.lastBackupPath = source["lastBackupPath"];
+	        this.compressionPolicy = this.convertValues(source["compressionPolicy"], CompressionPolicy);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -142,6 +303,116 @@ export namespace core {
 		    return a;
 		}
 	}
+	export class SalvageLoss {
+	    backup: string;
+	    path?: string;
+	    offset: number;
+	    reason: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SalvageLoss(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.backup = source["backup"];
+	        this.path = source["path"];
+	        this.offset = source["offset"];
+	        this.reason = source["reason"];
+	    }
+	}
+	export class SalvageReport {
+	    backups: string[];
+	    recovered: string[];
+	    lost: SalvageLoss[];
+	    skippedBytes: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new SalvageReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.backups = source["backups"];
+	        this.recovered = source["recovered"];
+	        this.lost = this.convertValues(source["lost"], SalvageLoss);
+	        this.skippedBytes = source["skippedBytes"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class VerifyIssue {
+	    backup: string;
+	    path?: string;
+	    kind: string;
+	    message: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new VerifyIssue(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.backup = source["backup"];
+	        this.path = source["path"];
+	        this.kind = source["kind"];
+	        this.message = source["message"];
+	    }
+	}
+	export class VerifyReport {
+	    backups: string[];
+	    entries: number;
+	    bytes: number;
+	    issues: VerifyIssue[];
+	    ok: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new VerifyReport(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.backups = source["backups"];
+	        this.entries = source["entries"];
+	        this.bytes = source["bytes"];
+	        this.issues = this.convertValues(source["issues"], VerifyIssue);
+	        this.ok = source["ok"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	
 
 }
@@ -152,10 +423,14 @@ export namespace main {
 	    sourcePaths: string[];
 	    destinationDir: string;
 	    filters: core.FilterConfig;
-	    useCompression: boolean;
+	    compression: string;
 	    useEncryption: boolean;
 	    encryptionAlgorithm: string;
 	    encryptionPassword: string;
+	    volumeSize: number;
+	    deterministic: boolean;
+	    salt: string;
+	    compressionPolicy?: core.CompressionPolicy;
 	
 	    static createFrom(source: any = {}) {
 	        return new BackupConfig(source);
@@ -166,10 +441,14 @@ export namespace main {
 	        this.sourcePaths = source["sourcePaths"];
 	        this.destinationDir = source["destinationDir"];
 	        this.filters = this.convertValues(source["filters"], core.FilterConfig);
-	        this.useCompression = source["useCompression"];
+	        this.compression = source["compression"];
 	        this.useEncryption = source["useEncryption"];
 	        this.encryptionAlgorithm = source["encryptionAlgorithm"];
 	        this.encryptionPassword = source["encryptionPassword"];
+	        this.volumeSize = source["volumeSize"];
+	        this.deterministic = source["deterministic"];
+	        this.salt = source["salt"];
+	        this.compressionPolicy = this.convertValues(source["compressionPolicy"], core.CompressionPolicy);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -290,6 +569,14 @@ export namespace main {
 	    backupFile: string;
 	    restoreDir: string;
 	    password: string;
+	    include: string[];
+	    exclude: string[];
+	    skipXattrs: boolean;
+	    specialFiles: boolean;
+	    refuseEscapingSymlinks: boolean;
+	    ownership: string;
+	    uidMap: Record<number, number>;
+	    gidMap: Record<number, number>;
 	
 	    static createFrom(source: any = {}) {
 	        return new RestoreConfig(source);
@@ -300,6 +587,14 @@ export namespace main {
 	        this.backupFile = source["backupFile"];
 	        this.restoreDir = source["restoreDir"];
 	        this.password = source["password"];
+	        this.include = source["include"];
+	        this.exclude = source["exclude"];
+	        this.skipXattrs = source["skipXattrs"];
+	        this.specialFiles = source["specialFiles"];
+	        this.refuseEscapingSymlinks = source["refuseEscapingSymlinks"];
+	        this.ownership = source["ownership"];
+	        this.uidMap = source["uidMap"];
+	        this.gidMap = source["gidMap"];
 	    }
 	}
 
@@ -216,6 +216,7 @@ func (a *App) executeTask(ctx context.Context, task core.BackupTask) (string, er
 
 	manager := core.NewBackupManager(ctx)
 	manager.DisableEvents()
+	manager.CompressionPolicy = task.Config.CompressionPolicy
 
 	var backupErr error
 	if task.Config.Incremental && task.Config.LastBackupPath != "" {
@@ -224,7 +225,7 @@ func (a *App) executeTask(ctx context.Context, task core.BackupTask) (string, er
 			destinationFile,
 			task.Config.LastBackupPath,
 			task.Config.Filters,
-			task.Config.UseCompression,
+			task.Config.Compression,
 			task.Config.UseEncryption,
 			task.Config.Algorithm,
 			task.Config.Password,
@@ -237,7 +238,7 @@ func (a *App) executeTask(ctx context.Context, task core.BackupTask) (string, er
 			task.Config.SourcePaths,
 			destinationFile,
 			task.Config.Filters,
-			task.Config.UseCompression,
+			task.Config.Compression,
 			task.Config.UseEncryption,
 			task.Config.Algorithm,
 			task.Config.Password,